@@ -0,0 +1,97 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ChatRole is the author of a chat message
+type ChatRole string
+
+// Enumerate roles
+const (
+	RoleSystem    ChatRole = "system"
+	RoleUser      ChatRole = "user"
+	RoleAssistant ChatRole = "assistant"
+	RoleTool      ChatRole = "tool"
+)
+
+// ChatMessage is a single message of a conversation
+type ChatMessage struct {
+	Role      ChatRole       `json:"role"`
+	Content   string         `json:"content"`
+	Thinking  string         `json:"thinking,omitempty"`   // Reasoning of thinking models, when ChatRequest.Think is set
+	Images    []RequestImage `json:"images,omitempty"`     // (optional) a list of images attached to this message (for multimodal models)
+	ToolCalls []ToolCall     `json:"tool_calls,omitempty"` // Tools the assistant wants to call
+	ToolName  string         `json:"tool_name,omitempty"`  // Name of the tool whose result a RoleTool message carries
+
+	ToolCallID string `json:"tool_call_id,omitempty"` // ID of the ToolCall a RoleTool message answers, needed by BackendOpenAI
+}
+
+// ChatRequest is a request to the /api/chat endpoint.
+// The model applies its own chat template to Messages, so there is no need
+// to format the conversation into a single prompt.
+type ChatRequest struct {
+	Model     string                   `json:"model"`
+	Messages  []ChatMessage            `json:"messages"`             // See: https://github.com/ollama/ollama/blob/main/docs/api.md#generate-a-chat-completion
+	Tools     []Tool                   `json:"tools,omitempty"`      // (optional) tools the model may call, see RunTools
+	Format    *RequestFormat           `json:"format,omitempty"`     // By default is text, but can be json or a JSON Schema (see SchemaFormat)
+	Options   *RequestOptions          `json:"options,omitempty"`    // (optional) the options to use for the model
+	KeepAlive *string                  `json:"keep_alive,omitempty"` // (optional) controls how long the model will stay loaded into memory following the request (default: 5m)
+	Stream    *bool                    `json:"stream,omitempty"`     // (optional) if true, the response will be streamed line by line
+	Think     *bool                    `json:"think,omitempty"`      // (optional) for thinking models, return the reasoning in ChatMessage.Thinking
+	OnJson    func(ChatResponse) error `json:"-"`
+}
+
+// ChatResponse is a streamed fragment of the /api/chat response.
+// Message carries the next piece of the assistant's reply.
+type ChatResponse struct {
+	Model      *string      `json:"model,omitempty"`
+	CreatedAt  *time.Time   `json:"created_at,omitempty"`
+	Message    *ChatMessage `json:"message,omitempty"`
+	Done       *bool        `json:"done,omitempty"`
+	DoneReason *string      `json:"done_reason,omitempty"` // Why the generation stopped: "stop", "length", "load", ...
+	Metrics
+}
+
+// ToJson converts the ChatRequest to a JSON string
+func (r *ChatRequest) ToJson() string {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// Chat sends a conversation to the ollama chat API.
+// The request goes to the "chat" endpoint, see EndpointURL.
+func (c *Client) Chat(request ChatRequest) error {
+	return c.ChatContext(context.Background(), request)
+}
+
+// ChatContext is like Chat but aborts the request when ctx is done.
+func (c *Client) ChatContext(ctx context.Context, request ChatRequest) error {
+	if c.ds.Backend == BackendOpenAI {
+		return c.openAIChat(ctx, request)
+	}
+	done := false
+	err := c.stream(ctx, "chat", c.EndpointURL("chat"), request.ToJson(), func(line []byte) error {
+		var res ChatResponse
+		if err := json.Unmarshal(line, &res); err != nil {
+			return fmt.Errorf("failed to unmarshal chat response: %w", err)
+		}
+		done = res.Done != nil && *res.Done
+		if request.OnJson != nil {
+			if err := request.OnJson(res); err != nil {
+				return fmt.Errorf("failed to process chat response: %w", err)
+			}
+		}
+		return nil
+	})
+	if err == nil && !done {
+		err = fmt.Errorf("chat response: %w", ErrStreamTruncated)
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package ollama
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChat_StreamsMessages(t *testing.T) {
+	var gotPath string
+	var gotReq ChatRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&gotReq)
+		fmt.Fprint(w, `{"model":"m","message":{"role":"assistant","content":"Hi"},"done":false}`+"\n")
+		fmt.Fprint(w, `{"model":"m","message":{"role":"assistant","content":" Alice"},"done":false}`+"\n")
+		fmt.Fprint(w, `{"model":"m","message":{"role":"assistant","content":""},"done":true,"eval_count":2}`+"\n")
+	}))
+	defer srv.Close()
+
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/ollama/api/generate"})
+
+	var reply strings.Builder
+	var done bool
+	err := client.Chat(ChatRequest{
+		Model: "m",
+		Messages: []ChatMessage{
+			{Role: RoleSystem, Content: "Be brief."},
+			{Role: RoleUser, Content: "My name is Alice"},
+			{Role: RoleAssistant, Content: "Nice to meet you!"},
+			{Role: RoleUser, Content: "What is my name?", Images: []RequestImage{[]byte("img")}},
+		},
+		OnJson: func(res ChatResponse) error {
+			if res.Message != nil {
+				reply.WriteString(res.Message.Content)
+			}
+			if res.Done != nil && *res.Done {
+				done = true
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Chat error: %v", err)
+	}
+
+	if gotPath != "/ollama/api/chat" {
+		t.Errorf("path = %q, want /ollama/api/chat", gotPath)
+	}
+	if len(gotReq.Messages) != 4 {
+		t.Fatalf("server got %d messages, want 4", len(gotReq.Messages))
+	}
+	if gotReq.Messages[0].Role != RoleSystem || gotReq.Messages[2].Role != RoleAssistant {
+		t.Errorf("roles = %q, %q", gotReq.Messages[0].Role, gotReq.Messages[2].Role)
+	}
+	if reply.String() != "Hi Alice" {
+		t.Errorf("reply = %q, want %q", reply.String(), "Hi Alice")
+	}
+	if !done {
+		t.Error("never received done=true")
+	}
+}
+
+func TestChatRequest_ImagesBase64(t *testing.T) {
+	r := ChatRequest{
+		Model:    "m",
+		Messages: []ChatMessage{{Role: RoleUser, Content: "look", Images: []RequestImage{[]byte("abc")}}},
+	}
+	js := r.ToJson()
+	if !strings.Contains(js, `"images":["YWJj"]`) {
+		t.Errorf("images not base64-encoded: %s", js)
+	}
+}
@@ -5,13 +5,15 @@
 package ollama
 
 import (
-	"crypto/tls"
+	"bytes"
+	"context"
 	base64 "encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"iter"
 	"net/http"
-	"regexp"
 	"strings"
 	"time"
 )
@@ -22,14 +24,15 @@ const DefaultGenerateURL = "http://localhost:11434/api/generate"
 
 // Client is a client for the ollama Web UI to use Authenticated API calls
 type Client struct {
-	client *http.Client // HTTP client
-	ds     *DSN         // Data source name
-}
-
-// DSN is a data source name for the ollama API
-type DSN struct {
-	URL   string // URL of the ollama API
-	Token string // Token for the ollama API
+	client     *http.Client // HTTP client
+	ds         *DSN         // Data source name
+	routes     routes       // Endpoint URLs derived from ds, see EndpointURL
+	err        error        // Configuration error reported by every request, see NewClient
+	retry      *RetryPolicy // Retry policy for transient failures, nil disables retries
+	embedCache *EmbedCache  // Cache in front of the embed endpoint, nil disables caching
+
+	responseCache ResponseCache // Cache of deterministic generate streams, nil disables caching
+	replayTiming  float64       // Scale of the recorded timing when replaying from responseCache, 0 replays at once
 }
 
 // RequestOptions are options for the ollama API
@@ -66,7 +69,8 @@ type RequestOptions struct {
 	UseMmap          *bool    `json:"use_mmap,omitempty"`          // Use mmap means that the model will be memory-mapped
 }
 
-// RequestFormat is a format of the request
+// RequestFormat is a format of the request: one of the named formats
+// or a JSON Schema document created by SchemaFormat
 type RequestFormat string
 
 // Enumerate formats
@@ -75,19 +79,58 @@ const (
 	FormatText RequestFormat = "text"
 )
 
+// SchemaFormat returns a format constraining the model output to the given JSON Schema.
+// See: https://github.com/ollama/ollama/blob/main/docs/api.md#request-structured-outputs
+func SchemaFormat(schema *Schema) *RequestFormat {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return nil
+	}
+	f := RequestFormat(data)
+	return &f
+}
+
+// IsSchema reports whether the format holds a JSON Schema rather than a named format
+func (f RequestFormat) IsSchema() bool {
+	return strings.HasPrefix(strings.TrimSpace(string(f)), "{") && json.Valid([]byte(f))
+}
+
+// MarshalJSON writes a schema format as a JSON object and named formats as strings
+func (f RequestFormat) MarshalJSON() ([]byte, error) {
+	if f.IsSchema() {
+		return []byte(f), nil
+	}
+	return json.Marshal(string(f))
+}
+
+// UnmarshalJSON accepts both a format name and a JSON Schema object
+func (f *RequestFormat) UnmarshalJSON(data []byte) error {
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		*f = RequestFormat(data)
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	*f = RequestFormat(name)
+	return nil
+}
+
 // Request is a request to the ollama API
 type Request struct {
 	Model       string                   `json:"model"`
 	Prompt      string                   `json:"prompt"`               // See: https://github.com/ollama/ollama/blob/main/docs/api.md#generate-a-completion
 	System      *string                  `json:"system,omitempty"`     // (optional) system message to override the model's default system prompt
-	Format      *RequestFormat           `json:"format,omitempty"`     // By default is text, but can be json
+	Format      *RequestFormat           `json:"format,omitempty"`     // By default is text, but can be json or a JSON Schema (see SchemaFormat)
 	Options     *RequestOptions          `json:"options,omitempty"`    // (optional) the options to use for the model
 	Suffix      *string                  `json:"suffix,omitempty"`     //  the text after the model response
 	Images      []RequestImage           `json:"images,omitempty"`     // (optional) a list of base64-encoded images (for multimodal models such as llava)
-	Context     []int                    `json:"-"`                    // (optional) the context to use for the model
+	Context     []int                    `json:"context,omitempty"`    // (optional) the context returned by a previous Response, to continue that conversation
 	KeepAlive   *string                  `json:"keep_alive,omitempty"` // (optional) controls how long the model will stay loaded into memory following the request (default: 5m)
 	Raw         *bool                    `json:"raw,omitempty"`        // (optional) controls how long the model will stay loaded into memory following the request (default: 5m)
 	Stream      *bool                    `json:"stream,omitempty"`     // (optional) if true, the response will be streamed line by line
+	Think       *bool                    `json:"think,omitempty"`      // (optional) for thinking models, return the reasoning in Response.Thinking
 	OnJson      func(Response) error     `json:"-"`
 	OnCodeBlock func([]*CodeBlock) error `json:"-"`
 }
@@ -100,13 +143,57 @@ func (i RequestImage) MarshalJSON() ([]byte, error) {
 	return json.Marshal(base64.StdEncoding.EncodeToString(i))
 }
 
+// Response is a streamed fragment of the /api/generate response.
+// The final fragment (Done) carries DoneReason, Context and the Metrics.
 type Response struct {
-	Model           *string    `json:"model,omitempty"`
-	CreatedAt       *time.Time `json:"created_at,omitempty"`
-	Response        *string    `json:"response,omitempty"`
-	Done            *bool      `json:"done,omitempty"`
-	PromptEvalCount *int       `json:"prompt_eval_count,omitempty"`
-	EvalCount       *int       `json:"eval_count,omitempty"`
+	Model      *string    `json:"model,omitempty"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+	Response   *string    `json:"response,omitempty"`
+	Thinking   *string    `json:"thinking,omitempty"` // Reasoning of thinking models, when Request.Think is set
+	Done       *bool      `json:"done,omitempty"`
+	DoneReason *string    `json:"done_reason,omitempty"` // Why the generation stopped: "stop", "length", "load", ...
+	Context    []int      `json:"context,omitempty"`     // Encoding of the conversation, pass it as Request.Context to continue it
+	Metrics
+}
+
+// Metrics are the token counts and timings of a generation, sent with the final response
+type Metrics struct {
+	TotalDuration      *time.Duration `json:"total_duration,omitempty"`       // Time spent generating the response
+	LoadDuration       *time.Duration `json:"load_duration,omitempty"`        // Time spent loading the model
+	PromptEvalCount    *int           `json:"prompt_eval_count,omitempty"`    // Number of tokens in the prompt
+	PromptEvalDuration *time.Duration `json:"prompt_eval_duration,omitempty"` // Time spent evaluating the prompt
+	EvalCount          *int           `json:"eval_count,omitempty"`           // Number of tokens in the response
+	EvalDuration       *time.Duration `json:"eval_duration,omitempty"`        // Time spent generating the response tokens
+}
+
+// TokensPerSecond returns the generation speed, or 0 if the metrics are not known yet
+func (m Metrics) TokensPerSecond() float64 {
+	return perSecond(m.EvalCount, m.EvalDuration)
+}
+
+// PromptTokensPerSecond returns the prompt evaluation speed, or 0 if the metrics are not known yet
+func (m Metrics) PromptTokensPerSecond() float64 {
+	return perSecond(m.PromptEvalCount, m.PromptEvalDuration)
+}
+
+// TimeToFirstToken returns the time spent before the first response token:
+// loading the model plus evaluating the prompt
+func (m Metrics) TimeToFirstToken() time.Duration {
+	var d time.Duration
+	if m.LoadDuration != nil {
+		d += *m.LoadDuration
+	}
+	if m.PromptEvalDuration != nil {
+		d += *m.PromptEvalDuration
+	}
+	return d
+}
+
+func perSecond(count *int, duration *time.Duration) float64 {
+	if count == nil || duration == nil || *duration <= 0 {
+		return 0
+	}
+	return float64(*count) / duration.Seconds()
 }
 
 // ToJson converts the Request to a JSON string
@@ -128,25 +215,51 @@ func (r *Request) ToJson() string {
 }
 
 // NewOpenWebUiClient creates a new Client.
-// If dsn is nil or dsn.URL is empty (after trimming space), URL defaults to DefaultGenerateURL (local Ollama).
-func NewOpenWebUiClient(dsn *DSN) *Client {
+// If dsn is nil or dsn.URL is empty (after trimming space), URL defaults to DefaultGenerateURL (local Ollama),
+// or to DefaultOpenAIURL for BackendOpenAI.
+// TLS certificates are verified unless WithInsecureSkipVerify is given or DSN.Insecure is set.
+// An option that fails (e.g. an unreadable CA bundle) makes every request return its error;
+// use NewClient to check options up front.
+func NewOpenWebUiClient(dsn *DSN, opts ...Option) *Client {
+	c, err := NewClient(dsn, opts...)
+	c.err = err
+	return c
+}
+
+// NewClient is like NewOpenWebUiClient but reports option errors immediately.
+// The returned Client is never nil.
+func NewClient(dsn *DSN, opts ...Option) (*Client, error) {
 	var resolved DSN
 	if dsn != nil {
 		resolved = *dsn
 	}
+	if resolved.Backend == "" {
+		resolved.Backend = detectBackend(resolved.URL)
+	}
 	if strings.TrimSpace(resolved.URL) == "" {
 		resolved.URL = DefaultGenerateURL
+		if resolved.Backend == BackendOpenAI {
+			resolved.URL = DefaultOpenAIURL
+		}
 	}
-	return &Client{
-		// Ignore tls
-		client: &http.Client{
-			Timeout: 0,
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-			},
-		},
-		ds: &resolved,
+
+	o, err := applyOptions(opts)
+	if resolved.Timeout > 0 && o.timeout == 0 {
+		o.timeout = resolved.Timeout
 	}
+	if resolved.Insecure {
+		o.tls().InsecureSkipVerify = true
+	}
+	return &Client{
+		client:     o.newHTTPClient(),
+		ds:         &resolved,
+		routes:     newRoutes(resolved),
+		retry:      o.retry,
+		embedCache: o.embedCache,
+
+		responseCache: o.responseCache,
+		replayTiming:  o.replayTiming,
+	}, err
 }
 
 // EmbedRequest is a request to the /api/embed endpoint.
@@ -167,40 +280,28 @@ type EmbedResponse struct {
 }
 
 // Embed generates embeddings for the given input texts.
-// The URL is derived from the DSN by replacing the last path segment with "embed".
+// The request goes to the "embed" endpoint, see EndpointURL.
 func (c *Client) Embed(request EmbedRequest) (*EmbedResponse, error) {
-	embedURL := strings.TrimSuffix(c.ds.URL, "/")
-	if i := strings.LastIndex(embedURL, "/"); i >= 0 {
-		embedURL = embedURL[:i] + "/embed"
-	}
-
-	body, err := json.Marshal(request)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal embed request: %w", err)
-	}
-
-	req, err := http.NewRequest("POST", embedURL, strings.NewReader(string(body)))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create embed request: %w", err)
-	}
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.ds.Token)
+	return c.EmbedContext(context.Background(), request)
+}
 
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send embed request: %w", err)
+// EmbedContext is like Embed but aborts the request when ctx is done.
+// With WithEmbedCache only the inputs missing from the cache are sent.
+func (c *Client) EmbedContext(ctx context.Context, request EmbedRequest) (*EmbedResponse, error) {
+	if c.embedCache != nil {
+		return c.embedCache.embed(ctx, request, c.embed)
 	}
-	defer resp.Body.Close()
+	return c.embed(ctx, request)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("embed request failed, status code: %d, body: %s", resp.StatusCode, respBody)
+// embed sends request to the embed endpoint of the client's backend.
+func (c *Client) embed(ctx context.Context, request EmbedRequest) (*EmbedResponse, error) {
+	if c.ds.Backend == BackendOpenAI {
+		return c.openAIEmbed(ctx, request)
 	}
-
 	var result EmbedResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode embed response: %w", err)
+	if err := c.doJSON(ctx, "embed", "POST", c.EndpointURL("embed"), request, &result); err != nil {
+		return nil, err
 	}
 	return &result, nil
 }
@@ -233,136 +334,244 @@ type ProcessStatus struct {
 }
 
 // Ps returns the list of models currently loaded in memory.
-// The URL is derived from the DSN by replacing the last path segment with "ps".
+// The request goes to the "ps" endpoint, see EndpointURL.
 func (c *Client) Ps() (*ProcessStatus, error) {
-	psURL := strings.TrimSuffix(c.ds.URL, "/")
-	if i := strings.LastIndex(psURL, "/"); i >= 0 {
-		psURL = psURL[:i] + "/ps"
-	}
-
-	req, err := http.NewRequest("GET", psURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create ps request: %w", err)
-	}
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.ds.Token)
-
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send ps request: %w", err)
-	}
-	defer resp.Body.Close()
+	return c.PsContext(context.Background())
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("ps request failed, status code: %d, body: %s", resp.StatusCode, body)
+// PsContext is like Ps but aborts the request when ctx is done.
+func (c *Client) PsContext(ctx context.Context) (*ProcessStatus, error) {
+	if err := c.supports("ps"); err != nil {
+		return nil, err
 	}
-
 	var status ProcessStatus
-	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
-		return nil, fmt.Errorf("failed to decode ps response: %w", err)
+	if err := c.doJSON(ctx, "ps", "GET", c.EndpointURL("ps"), nil, &status); err != nil {
+		return nil, err
 	}
 	return &status, nil
 }
 
 // Query sends a request to the ollama API
 func (c *Client) Query(request Request) (err error) {
-	js := request.ToJson()
-	req, err := http.NewRequest("POST", c.ds.URL, strings.NewReader(js))
+	return c.QueryContext(context.Background(), request)
+}
 
-	if err != nil {
-		return fmt.Errorf("failed to create ollama request: %w", err)
+// QueryContext is like Query but aborts the request when ctx is done.
+// Cancelling ctx closes the in-flight response body and stops the stream;
+// the returned error then wraps context.Canceled or context.DeadlineExceeded.
+func (c *Client) QueryContext(ctx context.Context, request Request) (err error) {
+	// Extract code blocks as the text streams in
+	var blocks *CodeBlockStreamer
+	if request.OnCodeBlock != nil {
+		blocks = &CodeBlockStreamer{
+			OnCodeBlockEnd: func(block *CodeBlock) error {
+				return request.OnCodeBlock([]*CodeBlock{block})
+			},
+		}
 	}
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Content-type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.ds.Token)
 
-	// Response comes line by line
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send ollama request: %w", err)
-	}
+	for res, err := range c.Stream(ctx, request) {
+		if err != nil {
+			return err
+		}
 
-	// Check if response code is 200
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to send ollama request, status code: %d, body: %s", resp.StatusCode, body)
-	}
+		// Call OnJson handler
+		if request.OnJson != nil {
+			if err = request.OnJson(res); err != nil {
+				return fmt.Errorf("failed to process ollama response: %w", err)
+			}
+		}
 
-	defer resp.Body.Close()
+		if blocks != nil && res.Response != nil {
+			if _, err = blocks.WriteString(*res.Response); err != nil {
+				return fmt.Errorf("failed to process ollama response code block: %w", err)
+			}
+		}
+	}
 
-	var (
-		scanner = NewSplitScanner(resp.Body, "\n") // Scanner to split response by new line which is JSON terminated by new line
-		res     Response                           // Response of the ollama API
-	)
+	// A block left open by the end of the answer ends with it
+	if blocks != nil {
+		if err := blocks.Close(); err != nil {
+			return fmt.Errorf("failed to process ollama response code block: %w", err)
+		}
+	}
+	return nil
+}
 
-	shouldAnalyse := false
-	// Collect responseses for code blocks
+// errStopIteration is returned from a stream callback when the consumer of an iterator breaks out of the loop.
+var errStopIteration = errors.New("iteration stopped")
+
+// Stream sends a request to the ollama API and returns an iterator over the streamed responses.
+// A failure is yielded once as the last element, with a zero Response.
+// Breaking out of the loop closes the HTTP response body.
+// The request callbacks OnJson and OnCodeBlock are not called; use Query for them.
+//
+//	for res, err := range client.Stream(ctx, request) {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Print(*res.Response)
+//	}
+//
+// With WithResponseCache, deterministic requests are replayed from the cache when recorded before.
+func (c *Client) Stream(ctx context.Context, request Request) iter.Seq2[Response, error] {
+	if c.responseCache != nil && cacheable(request) {
+		return c.cachedStream(ctx, request)
+	}
+	return c.generate(ctx, request)
+}
 
-	var text string
-	if request.OnCodeBlock != nil {
-		shouldAnalyse = true
+// generate streams the responses to request from the server.
+func (c *Client) generate(ctx context.Context, request Request) iter.Seq2[Response, error] {
+	if c.ds.Backend == BackendOpenAI {
+		return c.openAIGenerate(ctx, request)
+	}
+	return func(yield func(Response, error) bool) {
+		done := false
+		err := c.stream(ctx, "generate", c.EndpointURL("generate"), request.ToJson(), func(line []byte) error {
+			var res Response // Response of the ollama API
+			if err := json.Unmarshal(line, &res); err != nil {
+				return fmt.Errorf("failed to unmarshal ollama response: %w", err)
+			}
+			done = res.Done != nil && *res.Done
+			if !yield(res, nil) {
+				return errStopIteration
+			}
+			return nil
+		})
+		if err == nil && !done {
+			err = fmt.Errorf("generate response: %w", ErrStreamTruncated)
+		}
+		if err != nil && !errors.Is(err, errStopIteration) {
+			yield(Response{}, err)
+		}
+	}
+}
 
+// stream POSTs body to url and calls onLine for each line of the
+// newline-delimited JSON response, as it arrives.
+// name identifies the endpoint in error messages.
+func (c *Client) stream(ctx context.Context, name, url, body string, onLine func(line []byte) error) error {
+	// Response comes line by line
+	resp, err := c.send(ctx, name, "POST", url, []byte(body))
+	if err != nil {
+		return err
 	}
+	defer resp.Body.Close()
 
+	// Scanner to split response by new line which is JSON terminated by new line
+	scanner := NewSplitScanner(resp.Body, "\n")
 	for scanner.Scan() {
-		// Check for errors
-		if err = scanner.Err(); err != nil {
-			return fmt.Errorf("failed to read ollama response: %w", err)
+		// Stop promptly even if the scanner still has buffered lines
+		if err = ctx.Err(); err != nil {
+			return contextError(ctx, name, err)
 		}
-
-		if err = json.Unmarshal(scanner.Bytes(), &res); err != nil {
-			return fmt.Errorf("failed to unmarshal ollama response: %w", err)
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
 		}
-
-		// Unmarshal JSON response and call OnJson handler
-		if request.OnJson != nil {
-			if err = request.OnJson(res); err != nil {
-				return fmt.Errorf("failed to process ollama response: %w", err)
-			}
+		// Errors after the headers were sent arrive as {"error": "..."} lines
+		if apiErr := streamError(name, url, line); apiErr != nil {
+			return apiErr
 		}
+		if err = onLine(line); err != nil {
+			return err
+		}
+	}
 
-		// Do we need to analyse the response, for blocks of code?
-		if shouldAnalyse {
-			// Join responses into a single string and find all markdown code blocks by extracting text inside "```" blocks
-			text = strings.Join([]string{text, *res.Response}, "")
-			blocks := ParseCodeBlock(&text)
-			if len(blocks) > 0 {
-				// Clear text
-				text = ""
-				err = request.OnCodeBlock(blocks)
-				if err != nil {
-					return fmt.Errorf("failed to process ollama response code block: %w", err)
-				}
-			}
+	// Check for read errors, e.g. a body closed by a cancelled context
+	if err = scanner.Err(); err != nil {
+		return contextError(ctx, name, fmt.Errorf("failed to read %s response: %w", name, err))
+	}
+	return nil
+}
 
+// doJSON sends request (if not nil) as the JSON body and decodes the JSON response into result (if not nil).
+// name identifies the endpoint in error messages.
+func (c *Client) doJSON(ctx context.Context, name, method, url string, request, result any) error {
+	var body []byte
+	if request != nil {
+		data, err := json.Marshal(request)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s request: %w", name, err)
 		}
+		body = data
 	}
-	return
-}
 
-// CodeBlock is a code block extracted from the response
-type CodeBlock struct {
-	Type string
-	Code string
+	resp, err := c.send(ctx, name, method, url, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return contextError(ctx, name, fmt.Errorf("failed to decode %s response: %w", name, err))
+	}
+	return nil
 }
 
-// CodeBlockRegExp is a regular expression to extract code blocks from the text
-var CodeBlockRegExp = regexp.MustCompile("(?s)``+(\\S+)(.+?)\n``+")
+// send performs an authenticated request and checks the response status.
+// Transient failures are retried according to the client's RetryPolicy;
+// this happens before any of the response body is read, so a retried stream
+// never delivers a chunk twice.
+// A nil body sends no request body. On success the caller must close the response body.
+func (c *Client) send(ctx context.Context, name, method, url string, body []byte) (*http.Response, error) {
+	if c.err != nil {
+		return nil, fmt.Errorf("invalid client configuration: %w", c.err)
+	}
 
-// ParseCodeBlock parses the code block from the response
-// Use regular expressions to extract code blocks from the text
-func ParseCodeBlock(text *string) (blocks []*CodeBlock) {
-	for _, match := range CodeBlockRegExp.FindAllStringSubmatch(*text, -1) {
-		if len(match) > 2 {
-			block := &CodeBlock{
-				Type: match[1],
-				Code: match[2],
+	for attempt := 1; ; attempt++ {
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, url, reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s request: %w", name, err)
+		}
+		req.Header.Set("Accept", "application/json")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("Authorization", "Bearer "+c.ds.Token)
+
+		resp, err := c.client.Do(req)
+		if ctx.Err() == nil && c.retry.shouldRetry(attempt, resp, err) {
+			delay := c.retry.delay(attempt, resp)
+			if resp != nil {
+				// Drain so the connection can be reused
+				_, _ = io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+			if err = sleepContext(ctx, delay); err != nil {
+				return nil, contextError(ctx, name, err)
 			}
-			blocks = append(blocks, block)
-			//codeFile, err := oolama.OpenFileDescriptor(fmt.Sprintf("%s_%d.%s", fileName, i+1, lang))
+			continue
 		}
+		if err != nil {
+			return nil, contextError(ctx, name, fmt.Errorf("failed to send %s request: %w", name, err))
+		}
+
+		// Check if response code is 200
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			respBody, _ := io.ReadAll(resp.Body)
+			return nil, newAPIError(name, url, resp.StatusCode, resp.Header, respBody)
+		}
+		return resp, nil
 	}
+}
 
-	return blocks
+// contextError reports a cancelled or expired ctx in place of err, so callers can
+// tell an aborted request from a failed one with errors.Is(err, context.Canceled)
+// or errors.Is(err, context.DeadlineExceeded).
+// When ctx is still live, err is returned unchanged.
+func contextError(ctx context.Context, name string, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("%s request aborted: %w", name, ctxErr)
+	}
+	return err
 }
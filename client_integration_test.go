@@ -2,24 +2,46 @@ package ollama
 
 import (
 	"math"
+	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/eslider/go-ollama/ollamatest"
 )
 
 // Integration tests that hit a live Ollama / Open WebUI instance.
-// When OPEN_WEB_API_GENERATE_URL is unset, NewOpenWebUiClient uses local Ollama (DefaultGenerateURL).
-// Skipped in CI where no Ollama service is available.
+// The server is configured by the environment, see DSNFromEnv; by default it is local Ollama (DefaultGenerateURL).
+// With OLLAMA_RECORD set, each test records its interactions to testdata/cassettes/<test>.json;
+// a test with a cassette replays it offline, also in CI. Tests without one are skipped in CI.
+// Record and replay with the same OPEN_WEB_API_GENERATE_URL path, as requests are matched by path.
 
 func integrationClient(t *testing.T) *Client {
 	t.Helper()
+	dsn, err := DSNFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cassettePath := filepath.Join("testdata", "cassettes", t.Name()+".json")
+
+	if os.Getenv("OLLAMA_RECORD") != "" {
+		rec := ollamatest.NewRecorder(nil)
+		t.Cleanup(func() {
+			if err := rec.Save(cassettePath); err != nil {
+				t.Errorf("failed to save cassette: %v", err)
+			}
+		})
+		return NewOpenWebUiClient(dsn, WithHTTPClient(&http.Client{Transport: rec}))
+	}
+	if cassette, err := ollamatest.LoadCassette(cassettePath); err == nil {
+		return NewOpenWebUiClient(&DSN{URL: dsn.URL, Backend: dsn.Backend}, WithHTTPClient(&http.Client{Transport: ollamatest.NewReplayer(cassette)}))
+	}
 	if os.Getenv("CI") != "" {
-		t.Skip("integration tests require a live Ollama instance; skipped in CI")
+		t.Skip("integration tests require a live Ollama instance or a recorded cassette; skipped in CI")
 	}
-	url := os.Getenv("OPEN_WEB_API_GENERATE_URL")
-	token := os.Getenv("OPEN_WEB_API_TOKEN")
-	return NewOpenWebUiClient(&DSN{URL: url, Token: token})
+	return NewOpenWebUiClient(dsn)
 }
 
 func TestIntegration_StreamTokenByToken(t *testing.T) {
@@ -138,27 +160,28 @@ func TestIntegration_TokensPerSecond(t *testing.T) {
 func TestIntegration_ConversationContext(t *testing.T) {
 	client := integrationClient(t)
 
-	// Build a conversation prompt like the TUI does.
-	conversation := "User: My name is Alice\n\nAssistant: Nice to meet you, Alice!\n\nUser: What is my name?\n\nAssistant: "
-
 	var full strings.Builder
 
-	err := client.Query(Request{
-		Model:  "gemma3:1b",
-		Prompt: conversation,
+	err := client.Chat(ChatRequest{
+		Model: "gemma3:1b",
+		Messages: []ChatMessage{
+			{Role: RoleUser, Content: "My name is Alice"},
+			{Role: RoleAssistant, Content: "Nice to meet you, Alice!"},
+			{Role: RoleUser, Content: "What is my name?"},
+		},
 		Options: &RequestOptions{
 			Temperature: new(float64(0)),
 			NumPredict:  new(30),
 		},
-		OnJson: func(res Response) error {
-			if res.Response != nil {
-				full.WriteString(*res.Response)
+		OnJson: func(res ChatResponse) error {
+			if res.Message != nil {
+				full.WriteString(res.Message.Content)
 			}
 			return nil
 		},
 	})
 	if err != nil {
-		t.Fatalf("Query error: %v", err)
+		t.Fatalf("Chat error: %v", err)
 	}
 
 	resp := full.String()
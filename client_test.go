@@ -1,7 +1,9 @@
 package ollama
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -418,6 +420,152 @@ func TestQuery_RequestJSON(t *testing.T) {
 	}
 }
 
+func TestQueryContext_CancelStopsStream(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"response":"first","done":false}`+"\n")
+		w.(http.Flusher).Flush()
+		// Hang like a stuck model until the client goes away.
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls int
+	done := make(chan error, 1)
+	go func() {
+		done <- client.QueryContext(ctx, Request{
+			Model:  "m",
+			Prompt: "test",
+			OnJson: func(res Response) error {
+				calls++
+				cancel()
+				return nil
+			},
+		})
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("error = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("QueryContext did not return after cancel")
+	}
+	if calls != 1 {
+		t.Errorf("got %d OnJson calls, want 1", calls)
+	}
+}
+
+func TestEmbedContext_DeadlineExceeded(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := client.EmbedContext(ctx, EmbedRequest{Model: "m", Input: []string{"x"}})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestStream_YieldsResponses(t *testing.T) {
+	body := simulateStreamBody([]string{"a", "b", "c"}, "m")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL})
+
+	var text strings.Builder
+	var n int
+	for res, err := range client.Stream(context.Background(), Request{Model: "m", Prompt: "p"}) {
+		if err != nil {
+			t.Fatalf("Stream error: %v", err)
+		}
+		n++
+		text.WriteString(*res.Response)
+	}
+	if n != 4 || text.String() != "abc" {
+		t.Errorf("got %d responses %q, want 4 responses \"abc\"", n, text.String())
+	}
+}
+
+func TestStream_BreakClosesBody(t *testing.T) {
+	closed := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(closed)
+		for i := 0; ; i++ {
+			if _, err := fmt.Fprintf(w, `{"response":"%d","done":false}`+"\n", i); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}))
+	defer srv.Close()
+
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL})
+
+	var got []string
+	for res, err := range client.Stream(context.Background(), Request{Model: "m", Prompt: "p"}) {
+		if err != nil {
+			t.Fatalf("Stream error: %v", err)
+		}
+		got = append(got, *res.Response)
+		if len(got) == 2 {
+			break
+		}
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d responses, want 2", len(got))
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server still streaming after the loop stopped")
+	}
+}
+
+func TestStream_YieldsHTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL})
+
+	var errs []error
+	for _, err := range client.Stream(context.Background(), Request{Model: "m", Prompt: "p"}) {
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || errs[0] == nil || !strings.Contains(errs[0].Error(), "502") {
+		t.Errorf("errors = %v, want one 502 error", errs)
+	}
+}
+
 func readAll(r interface{ Read([]byte) (int, error) }) ([]byte, error) {
 	var buf strings.Builder
 	b := make([]byte, 1024)
@@ -432,3 +580,64 @@ func readAll(r interface{ Read([]byte) (int, error) }) ([]byte, error) {
 	}
 	return []byte(buf.String()), nil
 }
+
+func TestResponse_FinalMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"model":"m","response":"hi","done":false}`+"\n")
+		fmt.Fprint(w, `{"model":"m","response":"","done":true,"done_reason":"stop","context":[1,2,3],`+
+			`"total_duration":5000000000,"load_duration":1000000000,"prompt_eval_count":20,`+
+			`"prompt_eval_duration":500000000,"eval_count":100,"eval_duration":2000000000}`+"\n")
+	}))
+	defer srv.Close()
+
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"})
+
+	var final Response
+	for res, err := range client.Stream(context.Background(), Request{Model: "m", Prompt: "p"}) {
+		if err != nil {
+			t.Fatalf("Stream error: %v", err)
+		}
+		final = res
+	}
+
+	if final.DoneReason == nil || *final.DoneReason != "stop" {
+		t.Errorf("DoneReason = %v, want stop", final.DoneReason)
+	}
+	if len(final.Context) != 3 {
+		t.Errorf("Context = %v, want 3 tokens", final.Context)
+	}
+	if final.TotalDuration == nil || *final.TotalDuration != 5*time.Second {
+		t.Errorf("TotalDuration = %v, want 5s", final.TotalDuration)
+	}
+	if got := final.TokensPerSecond(); got != 50 {
+		t.Errorf("TokensPerSecond = %v, want 50", got)
+	}
+	if got := final.PromptTokensPerSecond(); got != 40 {
+		t.Errorf("PromptTokensPerSecond = %v, want 40", got)
+	}
+	if got := final.TimeToFirstToken(); got != 1500*time.Millisecond {
+		t.Errorf("TimeToFirstToken = %v, want 1.5s", got)
+	}
+}
+
+func TestMetrics_UnknownIsZero(t *testing.T) {
+	var m Metrics
+	if m.TokensPerSecond() != 0 || m.PromptTokensPerSecond() != 0 || m.TimeToFirstToken() != 0 {
+		t.Errorf("empty metrics = %v tok/s, %v prompt tok/s, %v ttft, want zeros",
+			m.TokensPerSecond(), m.PromptTokensPerSecond(), m.TimeToFirstToken())
+	}
+}
+
+func TestRequest_ContextRoundTrip(t *testing.T) {
+	r := Request{Model: "m", Prompt: "and then?", Context: []int{1, 2, 3}, Think: new(true)}
+	js := r.ToJson()
+	if !strings.Contains(js, `"context":[1,2,3]`) {
+		t.Errorf("context not sent: %s", js)
+	}
+	if !strings.Contains(js, `"think":true`) {
+		t.Errorf("think not sent: %s", js)
+	}
+	if js := (&Request{Model: "m"}).ToJson(); strings.Contains(js, "context") {
+		t.Errorf("empty context sent: %s", js)
+	}
+}
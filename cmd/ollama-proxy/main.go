@@ -0,0 +1,93 @@
+// Command ollama-proxy serves an OpenAI-compatible API in front of an Ollama or
+// Open WebUI instance, for tools that only speak the OpenAI API.
+//
+//	go run ./cmd/ollama-proxy -config proxy.json
+//
+// The JSON config file maps caller API keys to upstream tokens, see proxy.Config:
+//
+//	{
+//	  "upstream": "https://ai.example.com/ollama/api/generate",
+//	  "keys": {"sk-team-a": "owui-token-of-team-a"}
+//	}
+//
+// Without -config the upstream is read from the environment by ollama.DSNFromEnv
+// (OPEN_WEB_API_GENERATE_URL, OPEN_WEB_API_TOKEN, OLLAMA_HOST). A config without keys,
+// like this one, is refused unless -allow-anonymous lets every caller in with the upstream token.
+// The proxy listens on proxy.DefaultListen, the local host only, unless -listen or the config says otherwise.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	ollama "github.com/eslider/go-ollama"
+	"github.com/eslider/go-ollama/proxy"
+)
+
+func main() {
+	configPath := flag.String("config", "", "path of the JSON config file")
+	listen := flag.String("listen", "", "address to listen on, overrides the config (default "+proxy.DefaultListen+")")
+	allowAnonymous := flag.Bool("allow-anonymous", false, "let callers without a key in when the config has no keys")
+	flag.Parse()
+
+	var config *proxy.Config
+	opts := []ollama.Option{ollama.WithRetry(ollama.DefaultRetryPolicy)}
+	if *configPath != "" {
+		var err error
+		if config, err = proxy.LoadConfig(*configPath); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		dsn, err := ollama.DSNFromEnv()
+		if err != nil {
+			log.Fatal(err)
+		}
+		config = &proxy.Config{Upstream: dsn.URL, Backend: dsn.Backend, Endpoints: dsn.Endpoints, Token: dsn.Token}
+		if dsn.Timeout > 0 {
+			opts = append(opts, ollama.WithTimeout(dsn.Timeout))
+		}
+		if dsn.Insecure {
+			opts = append(opts, ollama.WithInsecureSkipVerify())
+		}
+	}
+	if *listen != "" {
+		config.Listen = *listen
+	}
+	if *allowAnonymous {
+		config.AllowAnonymous = true
+	}
+	if config.Listen == "" {
+		config.Listen = proxy.DefaultListen
+	}
+
+	handler, err := proxy.New(*config, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	server := &http.Server{
+		Addr:              config.Listen,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdown)
+	}()
+
+	log.Printf("serving the OpenAI API on %s", config.Listen)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,235 @@
+package ollama
+
+import (
+	"regexp"
+	"strings"
+)
+
+// CodeBlock is a fenced code block extracted from the response
+type CodeBlock struct {
+	Type string // Language, the first word of the info string (e.g. "go"); empty for unlabeled fences
+	Info string // Full info string after the opening fence, e.g. "go filename=main.go"
+	Code string // Content between the fences
+}
+
+// Attr returns the value of a key=value attribute of the info string,
+// e.g. Attr("filename") is "main.go" for "go filename=main.go".
+// Quoted values are unquoted. Returns "" if the attribute is not set.
+func (b *CodeBlock) Attr(key string) string {
+	for _, field := range strings.Fields(b.Info) {
+		if name, value, ok := strings.Cut(field, "="); ok && name == key {
+			return strings.Trim(value, `"'`)
+		}
+	}
+	return ""
+}
+
+// CodeBlockStreamer extracts fenced code blocks from markdown text as it is streamed.
+//
+// Text is fed with Write or WriteString in pieces of any size, e.g. token by token;
+// each piece is processed once, so long answers stay linear. Fences follow CommonMark:
+// three or more backticks or tildes, indented by at most three spaces, with an optional
+// info string. A block is closed by a fence of the same character that is at least as
+// long as the opening one, so a ```` block may contain ``` fences.
+//
+// Content is passed to OnCodeBlockChunk as soon as it is known not to be a closing fence.
+// Call Close at the end of the text: a block left open there ends with the text.
+type CodeBlockStreamer struct {
+	OnCodeBlockStart func(block *CodeBlock) error               // (optional) called after the opening fence, Code is empty
+	OnCodeBlockChunk func(block *CodeBlock, chunk string) error // (optional) called with each new piece of the content
+	OnCodeBlockEnd   func(block *CodeBlock) error               // (optional) called after the closing fence, Code is complete
+
+	line    strings.Builder // start of the current line, not classified yet
+	content bool            // the rest of the current line is content already passed on
+	block   *CodeBlock      // open block, nil outside of code
+	fence   string          // opening fence of the open block
+	indent  int             // indentation of the opening fence, stripped from content lines
+	code    strings.Builder // content of the open block
+}
+
+// Write implements io.Writer
+func (s *CodeBlockStreamer) Write(p []byte) (int, error) {
+	return s.WriteString(string(p))
+}
+
+// WriteString feeds the next piece of text, calling the callbacks for the blocks it starts, continues or ends
+func (s *CodeBlockStreamer) WriteString(text string) (int, error) {
+	n := len(text)
+	for text != "" {
+		i := strings.IndexByte(text, '\n')
+		if i < 0 {
+			if err := s.partial(text); err != nil {
+				return 0, err
+			}
+			break
+		}
+		piece := text[:i+1]
+		text = text[i+1:]
+
+		if s.content {
+			s.content = false
+			if err := s.chunk(piece); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		s.line.WriteString(piece)
+		line := s.line.String()
+		s.line.Reset()
+		if err := s.processLine(line); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// Close processes the last unterminated line and ends a block left open
+func (s *CodeBlockStreamer) Close() error {
+	if s.line.Len() > 0 {
+		line := s.line.String()
+		s.line.Reset()
+		if err := s.processLine(line); err != nil {
+			return err
+		}
+	}
+	s.content = false
+	if s.block != nil {
+		return s.end()
+	}
+	return nil
+}
+
+// partial handles the start of a line whose end has not arrived yet
+func (s *CodeBlockStreamer) partial(text string) error {
+	if s.content {
+		return s.chunk(text)
+	}
+	s.line.WriteString(text)
+	if s.block == nil || s.mayClose(s.line.String()) {
+		return nil
+	}
+	// Not a closing fence, whatever follows: pass it on without waiting for the newline
+	line := s.line.String()
+	s.line.Reset()
+	s.content = true
+	return s.chunk(stripIndent(line, s.indent))
+}
+
+// processLine handles a complete line, including its newline if any
+func (s *CodeBlockStreamer) processLine(line string) error {
+	if s.block == nil {
+		fence, info, indent, ok := openingFence(line)
+		if !ok {
+			return nil
+		}
+		typ, _, _ := strings.Cut(info, " ")
+		s.block = &CodeBlock{Type: typ, Info: info}
+		s.fence = fence
+		s.indent = indent
+		if s.OnCodeBlockStart != nil {
+			return s.OnCodeBlockStart(s.block)
+		}
+		return nil
+	}
+	if isClosingFence(line, s.fence) {
+		return s.end()
+	}
+	return s.chunk(stripIndent(line, s.indent))
+}
+
+func (s *CodeBlockStreamer) chunk(text string) error {
+	s.code.WriteString(text)
+	if s.OnCodeBlockChunk != nil {
+		return s.OnCodeBlockChunk(s.block, text)
+	}
+	return nil
+}
+
+func (s *CodeBlockStreamer) end() error {
+	block := s.block
+	block.Code = s.code.String()
+	s.block = nil
+	s.fence = ""
+	s.code.Reset()
+	if s.OnCodeBlockEnd != nil {
+		return s.OnCodeBlockEnd(block)
+	}
+	return nil
+}
+
+// mayClose reports whether the start of a line could still become the closing fence
+func (s *CodeBlockStreamer) mayClose(start string) bool {
+	rest, ok := cutIndent(start)
+	if !ok {
+		return false
+	}
+	rest = strings.TrimLeft(rest, s.fence[:1])
+	return strings.TrimRight(rest, " \t\r") == ""
+}
+
+// openingFence parses a line opening a code block, e.g. "```go filename=main.go"
+func openingFence(line string) (fence, info string, indent int, ok bool) {
+	line = strings.TrimRight(line, "\r\n")
+	rest, ok := cutIndent(line)
+	if !ok || rest == "" || (rest[0] != '`' && rest[0] != '~') {
+		return "", "", 0, false
+	}
+	n := len(rest) - len(strings.TrimLeft(rest, rest[:1]))
+	if n < 3 {
+		return "", "", 0, false
+	}
+	info = strings.TrimSpace(rest[n:])
+	if rest[0] == '`' && strings.Contains(info, "`") {
+		// Inline code such as ```foo``` rather than a fence
+		return "", "", 0, false
+	}
+	return rest[:n], info, len(line) - len(rest), true
+}
+
+// isClosingFence reports whether line closes a block opened by fence
+func isClosingFence(line, fence string) bool {
+	rest, ok := cutIndent(strings.TrimRight(line, "\r\n"))
+	if !ok {
+		return false
+	}
+	tail := strings.TrimLeft(rest, fence[:1])
+	return len(rest)-len(tail) >= len(fence) && strings.TrimSpace(tail) == ""
+}
+
+// cutIndent removes up to three leading spaces; more make the line indented code, not a fence
+func cutIndent(line string) (string, bool) {
+	rest := strings.TrimLeft(line, " ")
+	if len(line)-len(rest) > 3 {
+		return "", false
+	}
+	return rest, true
+}
+
+// stripIndent removes up to n leading spaces
+func stripIndent(line string, n int) string {
+	for i := 0; i < n && strings.HasPrefix(line, " "); i++ {
+		line = line[1:]
+	}
+	return line
+}
+
+// CodeBlockRegExp is a regular expression to extract code blocks from the text
+var CodeBlockRegExp = regexp.MustCompile("(?s)``+(\\S+)(.+?)\n``+")
+
+// ParseCodeBlock parses the code block from the response
+// Use regular expressions to extract code blocks from the text.
+// Only labeled ``` fences are found; use CodeBlockStreamer for streamed text.
+func ParseCodeBlock(text *string) (blocks []*CodeBlock) {
+	for _, match := range CodeBlockRegExp.FindAllStringSubmatch(*text, -1) {
+		if len(match) > 2 {
+			block := &CodeBlock{
+				Type: match[1],
+				Info: match[1],
+				Code: match[2],
+			}
+			blocks = append(blocks, block)
+		}
+	}
+
+	return blocks
+}
@@ -0,0 +1,161 @@
+package ollama
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// streamBlocks feeds text to a CodeBlockStreamer in pieces of size n and returns the ended blocks
+func streamBlocks(t *testing.T, text string, n int) []*CodeBlock {
+	t.Helper()
+	var blocks []*CodeBlock
+	s := &CodeBlockStreamer{
+		OnCodeBlockEnd: func(block *CodeBlock) error {
+			blocks = append(blocks, block)
+			return nil
+		},
+	}
+	for len(text) > 0 {
+		piece := text[:min(n, len(text))]
+		text = text[len(piece):]
+		if _, err := s.WriteString(piece); err != nil {
+			t.Fatalf("WriteString error: %v", err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+	return blocks
+}
+
+func TestCodeBlockStreamer_PieceSizes(t *testing.T) {
+	text := "Intro\n```go\npackage main\n\nfunc main() {}\n```\nbetween\n```bash\necho hi\n```\nend"
+	for _, n := range []int{1, 2, 3, 7, len(text)} {
+		blocks := streamBlocks(t, text, n)
+		if len(blocks) != 2 {
+			t.Fatalf("n=%d: got %d blocks, want 2", n, len(blocks))
+		}
+		if blocks[0].Type != "go" || blocks[0].Code != "package main\n\nfunc main() {}\n" {
+			t.Errorf("n=%d: block[0] = %q %q", n, blocks[0].Type, blocks[0].Code)
+		}
+		if blocks[1].Type != "bash" || blocks[1].Code != "echo hi\n" {
+			t.Errorf("n=%d: block[1] = %q %q", n, blocks[1].Type, blocks[1].Code)
+		}
+	}
+}
+
+func TestCodeBlockStreamer_Unlabeled(t *testing.T) {
+	blocks := streamBlocks(t, "```\nplain\n```\n", 1)
+	if len(blocks) != 1 {
+		t.Fatalf("got %d blocks, want 1", len(blocks))
+	}
+	if blocks[0].Type != "" || blocks[0].Code != "plain\n" {
+		t.Errorf("block = %q %q", blocks[0].Type, blocks[0].Code)
+	}
+}
+
+func TestCodeBlockStreamer_TildeFence(t *testing.T) {
+	blocks := streamBlocks(t, "~~~python\nprint('```')\n```\n~~~\n", 4)
+	if len(blocks) != 1 {
+		t.Fatalf("got %d blocks, want 1", len(blocks))
+	}
+	if blocks[0].Type != "python" || blocks[0].Code != "print('```')\n```\n" {
+		t.Errorf("block = %q %q", blocks[0].Type, blocks[0].Code)
+	}
+}
+
+func TestCodeBlockStreamer_NestedFence(t *testing.T) {
+	text := "````markdown\nExample:\n```go\nx := 1\n```\n````\n"
+	blocks := streamBlocks(t, text, 1)
+	if len(blocks) != 1 {
+		t.Fatalf("got %d blocks, want 1", len(blocks))
+	}
+	if blocks[0].Type != "markdown" || blocks[0].Code != "Example:\n```go\nx := 1\n```\n" {
+		t.Errorf("block = %q %q", blocks[0].Type, blocks[0].Code)
+	}
+}
+
+func TestCodeBlockStreamer_InfoString(t *testing.T) {
+	blocks := streamBlocks(t, "```go filename=cmd/main.go title=\"Main file\"\nx\n```\n", 5)
+	if len(blocks) != 1 {
+		t.Fatalf("got %d blocks, want 1", len(blocks))
+	}
+	b := blocks[0]
+	if b.Type != "go" {
+		t.Errorf("Type = %q, want go", b.Type)
+	}
+	if b.Info != `go filename=cmd/main.go title="Main file"` {
+		t.Errorf("Info = %q", b.Info)
+	}
+	if got := b.Attr("filename"); got != "cmd/main.go" {
+		t.Errorf("Attr(filename) = %q, want cmd/main.go", got)
+	}
+	if got := b.Attr("missing"); got != "" {
+		t.Errorf("Attr(missing) = %q, want empty", got)
+	}
+}
+
+func TestCodeBlockStreamer_IndentedFence(t *testing.T) {
+	blocks := streamBlocks(t, "1. Run:\n   ```sh\n   make\n    make test\n   ```\n", 3)
+	if len(blocks) != 1 {
+		t.Fatalf("got %d blocks, want 1", len(blocks))
+	}
+	if blocks[0].Code != "make\n make test\n" {
+		t.Errorf("Code = %q", blocks[0].Code)
+	}
+}
+
+func TestCodeBlockStreamer_UnclosedBlockEndsOnClose(t *testing.T) {
+	blocks := streamBlocks(t, "```go\nfunc f() {}", 4)
+	if len(blocks) != 1 {
+		t.Fatalf("got %d blocks, want 1", len(blocks))
+	}
+	if blocks[0].Code != "func f() {}" {
+		t.Errorf("Code = %q", blocks[0].Code)
+	}
+}
+
+func TestCodeBlockStreamer_ChunksBeforeNewline(t *testing.T) {
+	var events []string
+	s := &CodeBlockStreamer{
+		OnCodeBlockStart: func(b *CodeBlock) error {
+			events = append(events, "start "+b.Type)
+			return nil
+		},
+		OnCodeBlockChunk: func(b *CodeBlock, chunk string) error {
+			events = append(events, "chunk "+chunk)
+			return nil
+		},
+		OnCodeBlockEnd: func(b *CodeBlock) error {
+			events = append(events, "end "+b.Code)
+			return nil
+		},
+	}
+	for _, tok := range []string{"```js\n", "con", "sole", ".log()\n", "`", "``\n"} {
+		if _, err := s.WriteString(tok); err != nil {
+			t.Fatalf("WriteString error: %v", err)
+		}
+	}
+	want := []string{"start js", "chunk con", "chunk sole", "chunk .log()\n", "end console.log()\n"}
+	if strings.Join(events, "|") != strings.Join(want, "|") {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+}
+
+func TestCodeBlockStreamer_CallbackError(t *testing.T) {
+	sentinel := errors.New("stop")
+	s := &CodeBlockStreamer{
+		OnCodeBlockStart: func(*CodeBlock) error { return sentinel },
+	}
+	if _, err := s.WriteString("```go\n"); !errors.Is(err, sentinel) {
+		t.Errorf("err = %v, want %v", err, sentinel)
+	}
+}
+
+func TestCodeBlockStreamer_InlineBackticksAreNotFences(t *testing.T) {
+	blocks := streamBlocks(t, "```not a fence```\ntext\n", 1)
+	if len(blocks) != 0 {
+		t.Errorf("got %d blocks, want 0", len(blocks))
+	}
+}
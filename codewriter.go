@@ -0,0 +1,239 @@
+package ollama
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// WritePolicy decides what CodeBlockWriter does with a file that already exists
+type WritePolicy int
+
+// Enumerate write policies
+const (
+	WriteOverwrite WritePolicy = iota // replace the file
+	WriteSkip                         // keep the file, do not write the block
+	WriteBackup                       // rename the file to <path>.bak (or .bak.N), then write
+)
+
+// FileAction is what CodeBlockWriter did, or would do in dry-run mode, with a block
+type FileAction string
+
+// Enumerate file actions
+const (
+	FileCreated     FileAction = "created"
+	FileOverwritten FileAction = "overwritten"
+	FileBackedUp    FileAction = "backed up"
+	FileSkipped     FileAction = "skipped"
+)
+
+// CodeFile is a manifest entry of CodeBlockWriter
+type CodeFile struct {
+	Path   string     // Path of the file, joined with the writer's Root
+	Backup string     // Path the previous file was moved to, for FileBackedUp
+	Action FileAction // What happened to the file
+	Size   int        // Number of bytes written
+	Block  *CodeBlock // Block the file was written from
+}
+
+// CodeBlockWriter writes extracted code blocks to files below a root directory.
+//
+// The path of a block is taken from, in this order:
+//   - a header comment on its first line, e.g. "// file: cmd/main.go" or "# file: app.py";
+//     the header line is not written
+//   - its info string: a filename=, file=, path= or title= attribute, or a second word
+//     that looks like a path, e.g. "```go cmd/main.go"
+//   - a fallback "<Name>_<N>.<ext>" with the extension derived from the block's Type
+//
+// Paths must stay below Root: absolute paths, paths climbing out with ".." and paths
+// following a symlink out of Root are refused.
+type CodeBlockWriter struct {
+	Root   string      // Directory the files are written to, the working directory if empty
+	Name   string      // Base name of fallback files, "code" if empty
+	Policy WritePolicy // What to do with existing files
+	DryRun bool        // Only report what would be written
+
+	fallbacks int
+	manifest  []CodeFile
+}
+
+// NewCodeBlockWriter creates a CodeBlockWriter writing below root with the WriteOverwrite policy
+func NewCodeBlockWriter(root string) *CodeBlockWriter {
+	return &CodeBlockWriter{Root: root}
+}
+
+// Manifest returns the files handled so far, in order
+func (w *CodeBlockWriter) Manifest() []CodeFile {
+	return append([]CodeFile(nil), w.manifest...)
+}
+
+// WriteAll writes the blocks in order, stopping at the first error.
+// Use it from an OnCodeBlock callback:
+//
+//	OnCodeBlock: func(blocks []*ollama.CodeBlock) error { _, err := w.WriteAll(blocks); return err }
+func (w *CodeBlockWriter) WriteAll(blocks []*CodeBlock) ([]CodeFile, error) {
+	files := make([]CodeFile, 0, len(blocks))
+	for _, block := range blocks {
+		file, err := w.Write(block)
+		if err != nil {
+			return files, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// Write writes a block to its file according to the Policy and records it in the manifest
+func (w *CodeBlockWriter) Write(block *CodeBlock) (CodeFile, error) {
+	rel, code := w.resolve(block)
+	if !filepath.IsLocal(rel) {
+		return CodeFile{}, fmt.Errorf("refusing to write code block to %q: path escapes the root directory", rel)
+	}
+	file := CodeFile{
+		Path:   filepath.Join(w.Root, rel),
+		Action: FileCreated,
+		Size:   len(code),
+		Block:  block,
+	}
+
+	root, err := w.openRoot()
+	if errors.Is(err, fs.ErrNotExist) && w.DryRun {
+		// Nothing exists below a root that does not exist yet
+		w.manifest = append(w.manifest, file)
+		return file, nil
+	} else if err != nil {
+		return CodeFile{}, err
+	}
+	defer root.Close()
+
+	if _, err := root.Stat(rel); err == nil {
+		switch w.Policy {
+		case WriteSkip:
+			file.Action = FileSkipped
+			file.Size = 0
+		case WriteBackup:
+			file.Action = FileBackedUp
+			backup, err := backupPath(root, rel)
+			if err != nil {
+				return CodeFile{}, err
+			}
+			file.Backup = filepath.Join(w.Root, backup)
+			if !w.DryRun {
+				if err := root.Rename(rel, backup); err != nil {
+					return CodeFile{}, fmt.Errorf("failed to back up %s: %w", file.Path, err)
+				}
+			}
+		default:
+			file.Action = FileOverwritten
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return CodeFile{}, fmt.Errorf("failed to stat %s: %w", file.Path, err)
+	}
+
+	if !w.DryRun && file.Action != FileSkipped {
+		if err := WriteRootFile(root, rel, []byte(code)); err != nil {
+			return CodeFile{}, err
+		}
+	}
+	w.manifest = append(w.manifest, file)
+	return file, nil
+}
+
+// openRoot opens the root directory, creating it unless in dry-run mode.
+// Files are accessed through it so that symlinks below Root cannot lead outside.
+func (w *CodeBlockWriter) openRoot() (*os.Root, error) {
+	dir := cmp.Or(w.Root, ".")
+	if !w.DryRun {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open root directory %s: %w", dir, err)
+	}
+	return root, nil
+}
+
+// fileHeaderRegExp matches a "file: path" comment in the common comment syntaxes
+var fileHeaderRegExp = regexp.MustCompile(`(?i)^\s*(?://|#|--|;|/\*|<!--)\s*(?:file(?:name)?|path)\s*:\s*(\S+?)\s*(?:\*/|-->)?\s*$`)
+
+// resolve returns the path of a block relative to the root and the code to write
+func (w *CodeBlockWriter) resolve(block *CodeBlock) (path, code string) {
+	code = block.Code
+	first, rest, _ := strings.Cut(code, "\n")
+	if match := fileHeaderRegExp.FindStringSubmatch(first); match != nil {
+		return filepath.FromSlash(match[1]), rest
+	}
+
+	for _, key := range []string{"filename", "file", "path", "title"} {
+		if path := block.Attr(key); path != "" {
+			return filepath.FromSlash(path), code
+		}
+	}
+	if fields := strings.Fields(block.Info); len(fields) > 1 && !strings.Contains(fields[1], "=") &&
+		strings.ContainsAny(fields[1], "./") {
+		return filepath.FromSlash(fields[1]), code
+	}
+
+	w.fallbacks++
+	name := w.Name
+	if name == "" {
+		name = "code"
+	}
+	return fmt.Sprintf("%s_%d.%s", name, w.fallbacks, extensionOf(block.Type)), code
+}
+
+// extensions maps fence languages to file extensions where they differ
+var extensions = map[string]string{
+	"bash":       "sh",
+	"shell":      "sh",
+	"zsh":        "sh",
+	"python":     "py",
+	"python3":    "py",
+	"javascript": "js",
+	"typescript": "ts",
+	"ruby":       "rb",
+	"rust":       "rs",
+	"golang":     "go",
+	"kotlin":     "kt",
+	"csharp":     "cs",
+	"c#":         "cs",
+	"c++":        "cpp",
+	"markdown":   "md",
+	"yml":        "yaml",
+	"text":       "txt",
+	"plaintext":  "txt",
+	"dockerfile": "dockerfile",
+	"makefile":   "mk",
+}
+
+// extensionOf returns the file extension of a fence language, "txt" if there is none
+func extensionOf(lang string) string {
+	lang = strings.ToLower(lang)
+	if ext, ok := extensions[lang]; ok {
+		return ext
+	}
+	if lang == "" || strings.ContainsAny(lang, `/\.`) {
+		return "txt"
+	}
+	return lang
+}
+
+// backupPath returns the first free backup name of path below root: path.bak, path.bak.1, ...
+func backupPath(root *os.Root, path string) (string, error) {
+	backup := path + ".bak"
+	for i := 1; ; i++ {
+		if _, err := root.Lstat(backup); errors.Is(err, fs.ErrNotExist) {
+			return backup, nil
+		} else if err != nil {
+			return "", fmt.Errorf("failed to stat %s: %w", backup, err)
+		}
+		backup = fmt.Sprintf("%s.bak.%d", path, i)
+	}
+}
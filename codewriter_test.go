@@ -0,0 +1,161 @@
+package ollama
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	return string(data)
+}
+
+func TestCodeBlockWriter_Paths(t *testing.T) {
+	root := t.TempDir()
+	w := NewCodeBlockWriter(root)
+
+	files, err := w.WriteAll([]*CodeBlock{
+		{Type: "go", Info: "go", Code: "// file: cmd/app/main.go\npackage main\n"},
+		{Type: "yaml", Info: "yaml filename=deploy/app.yaml", Code: "a: 1\n"},
+		{Type: "go", Info: "go internal/x.go", Code: "package x\n"},
+		{Type: "python", Info: "python", Code: "print(1)\n"},
+		{Type: "", Info: "", Code: "notes\n"},
+	})
+	if err != nil {
+		t.Fatalf("WriteAll error: %v", err)
+	}
+
+	want := []string{"cmd/app/main.go", "deploy/app.yaml", "internal/x.go", "code_1.py", "code_2.txt"}
+	if len(files) != len(want) {
+		t.Fatalf("got %d files, want %d", len(files), len(want))
+	}
+	for i, f := range files {
+		if f.Path != filepath.Join(root, filepath.FromSlash(want[i])) {
+			t.Errorf("file[%d].Path = %q, want %q", i, f.Path, want[i])
+		}
+		if f.Action != FileCreated {
+			t.Errorf("file[%d].Action = %q, want created", i, f.Action)
+		}
+	}
+	if got := readFile(t, files[0].Path); got != "package main\n" {
+		t.Errorf("header line not stripped: %q", got)
+	}
+	if got := readFile(t, files[1].Path); got != "a: 1\n" {
+		t.Errorf("yaml content = %q", got)
+	}
+	if len(w.Manifest()) != len(want) {
+		t.Errorf("manifest has %d entries, want %d", len(w.Manifest()), len(want))
+	}
+}
+
+func TestCodeBlockWriter_RefusesEscapingPaths(t *testing.T) {
+	root := t.TempDir()
+	w := NewCodeBlockWriter(root)
+
+	for _, block := range []*CodeBlock{
+		{Code: "// file: ../evil.go\nx\n"},
+		{Code: "# file: /etc/passwd\nx\n"},
+		{Info: "go filename=a/../../evil.go", Code: "x\n"},
+	} {
+		if _, err := w.Write(block); err == nil || !strings.Contains(err.Error(), "escapes the root") {
+			t.Errorf("Write(%q) error = %v, want escape error", block.Code, err)
+		}
+	}
+	if len(w.Manifest()) != 0 {
+		t.Errorf("manifest = %v, want empty", w.Manifest())
+	}
+}
+
+func TestCodeBlockWriter_RefusesSymlinkEscape(t *testing.T) {
+	root, outside := t.TempDir(), t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(root, "out")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	w := NewCodeBlockWriter(root)
+
+	if _, err := w.Write(&CodeBlock{Info: "txt filename=out/evil.txt", Code: "x\n"}); err == nil {
+		t.Error("Write through a symlink out of the root succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "evil.txt")); !os.IsNotExist(err) {
+		t.Errorf("file written outside the root: %v", err)
+	}
+	if len(w.Manifest()) != 0 {
+		t.Errorf("manifest = %v, want empty", w.Manifest())
+	}
+}
+
+func TestCodeBlockWriter_OverwriteTruncates(t *testing.T) {
+	root := t.TempDir()
+	w := NewCodeBlockWriter(root)
+	block := &CodeBlock{Info: "txt filename=a.txt", Code: "a much longer first version\n"}
+	if _, err := w.Write(block); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+
+	file, err := w.Write(&CodeBlock{Info: "txt filename=a.txt", Code: "short\n"})
+	if err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	if file.Action != FileOverwritten {
+		t.Errorf("Action = %q, want overwritten", file.Action)
+	}
+	if got := readFile(t, file.Path); got != "short\n" {
+		t.Errorf("content = %q, want %q", got, "short\n")
+	}
+}
+
+func TestCodeBlockWriter_SkipAndBackup(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "a.txt")
+	if err := os.WriteFile(path, []byte("original\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	block := &CodeBlock{Info: "txt filename=a.txt", Code: "new\n"}
+
+	w := &CodeBlockWriter{Root: root, Policy: WriteSkip}
+	file, err := w.Write(block)
+	if err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	if file.Action != FileSkipped || readFile(t, path) != "original\n" {
+		t.Errorf("skip: action %q, content %q", file.Action, readFile(t, path))
+	}
+
+	w = &CodeBlockWriter{Root: root, Policy: WriteBackup}
+	for i, wantBackup := range []string{"a.txt.bak", "a.txt.bak.1"} {
+		file, err = w.Write(block)
+		if err != nil {
+			t.Fatalf("Write error: %v", err)
+		}
+		if file.Action != FileBackedUp || file.Backup != filepath.Join(root, wantBackup) {
+			t.Errorf("backup %d: action %q, backup %q, want %s", i, file.Action, file.Backup, wantBackup)
+		}
+	}
+	if got := readFile(t, filepath.Join(root, "a.txt.bak")); got != "original\n" {
+		t.Errorf("backup content = %q, want original", got)
+	}
+	if got := readFile(t, path); got != "new\n" {
+		t.Errorf("content = %q, want new", got)
+	}
+}
+
+func TestCodeBlockWriter_DryRun(t *testing.T) {
+	root := t.TempDir()
+	w := &CodeBlockWriter{Root: root, DryRun: true}
+	file, err := w.Write(&CodeBlock{Type: "go", Info: "go", Code: "package main\n"})
+	if err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	if file.Action != FileCreated || file.Size != len("package main\n") {
+		t.Errorf("file = %+v", file)
+	}
+	if _, err := os.Stat(file.Path); !os.IsNotExist(err) {
+		t.Errorf("dry run wrote %s", file.Path)
+	}
+}
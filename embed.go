@@ -0,0 +1,197 @@
+package ollama
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultEmbedBatchSize is the number of inputs EmbedAll sends per request when EmbedOptions.BatchSize is not positive
+const DefaultEmbedBatchSize = 64
+
+// EmbedOptions controls how EmbedAll splits and sends its inputs
+type EmbedOptions struct {
+	BatchSize         int                   // Inputs per request, DefaultEmbedBatchSize if not positive
+	Concurrency       int                   // Requests in flight at once, 1 if not positive
+	RequestsPerSecond float64               // Upper bound of requests started per second, retries included; 0 means no limit
+	Retry             *RetryPolicy          // Retries of a batch failed by a transient error, on top of the client's own retries; nil for none
+	Truncate          *bool                 // (optional) see EmbedRequest
+	KeepAlive         *string               // (optional) see EmbedRequest
+	OnProgress        func(done, total int) // (optional) called after each batch with the number of inputs finished, failed ones included; calls are serialized
+}
+
+// EmbedAllError reports the inputs EmbedAll failed to embed
+type EmbedAllError struct {
+	Failed []int   // Indices of the inputs without an embedding, ascending
+	Errs   []error // Error of each failed batch, in input order
+}
+
+// Error implements the error interface
+func (e *EmbedAllError) Error() string {
+	return fmt.Sprintf("failed to embed %d inputs in %d batches, first error: %v", len(e.Failed), len(e.Errs), e.Errs[0])
+}
+
+// Unwrap returns the batch errors, so errors.Is and errors.As look into them
+func (e *EmbedAllError) Unwrap() []error {
+	return e.Errs
+}
+
+// batchFailure is a range of inputs EmbedAll failed to embed
+type batchFailure struct {
+	start, end int
+	err        error
+}
+
+// EmbedAll embeds any number of inputs with model, sending them in batches from concurrent workers.
+// The embeddings are returned in input order. If some batches still fail after their retries,
+// or ctx is done before all are sent, the embeddings of the other inputs are returned anyway:
+// the failed ones are nil and the error is an *EmbedAllError listing their indices.
+//
+//	embeddings, err := client.EmbedAll(ctx, "nomic-embed-text", texts, ollama.EmbedOptions{Concurrency: 4})
+//	var embedErr *ollama.EmbedAllError
+//	if errors.As(err, &embedErr) { log.Println("failed:", embedErr.Failed) }
+func (c *Client) EmbedAll(ctx context.Context, model string, inputs []string, opts EmbedOptions) ([][]float64, error) {
+	size := opts.BatchSize
+	if size <= 0 {
+		size = DefaultEmbedBatchSize
+	}
+	limiter := newRateLimiter(opts.RequestsPerSecond)
+
+	embeddings := make([][]float64, len(inputs))
+	var (
+		mu       sync.Mutex
+		failures []batchFailure
+		done     int
+	)
+	starts := make(chan int)
+	var wg sync.WaitGroup
+	workers := min(max(opts.Concurrency, 1), (len(inputs)+size-1)/size)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range starts {
+				end := min(start+size, len(inputs))
+				result, err := c.embedBatch(ctx, EmbedRequest{
+					Model:     model,
+					Input:     inputs[start:end],
+					Truncate:  opts.Truncate,
+					KeepAlive: opts.KeepAlive,
+				}, opts.Retry, limiter)
+
+				mu.Lock()
+				if err != nil {
+					failures = append(failures, batchFailure{start, end, fmt.Errorf("inputs %d-%d: %w", start, end-1, err)})
+				} else {
+					copy(embeddings[start:end], result)
+				}
+				done += end - start
+				if opts.OnProgress != nil {
+					opts.OnProgress(done, len(inputs))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	unsent := len(inputs)
+dispatch:
+	for start := 0; start < len(inputs); start += size {
+		select {
+		case starts <- start:
+		case <-ctx.Done():
+			unsent = start
+			break dispatch
+		}
+	}
+	close(starts)
+	wg.Wait()
+
+	if unsent < len(inputs) {
+		failures = append(failures, batchFailure{unsent, len(inputs), contextError(ctx, "embed", ctx.Err())})
+	}
+	if len(failures) == 0 {
+		return embeddings, nil
+	}
+	slices.SortFunc(failures, func(a, b batchFailure) int { return a.start - b.start })
+	embedErr := &EmbedAllError{}
+	for _, f := range failures {
+		for i := f.start; i < f.end; i++ {
+			embedErr.Failed = append(embedErr.Failed, i)
+		}
+		embedErr.Errs = append(embedErr.Errs, f.err)
+	}
+	return embeddings, embedErr
+}
+
+// embedBatch embeds one batch, retrying transient failures according to retry, if not nil.
+// A batch answered with the wrong number of embeddings is not retried.
+func (c *Client) embedBatch(ctx context.Context, request EmbedRequest, retry *RetryPolicy, limiter *rateLimiter) ([][]float64, error) {
+	for attempt := 1; ; attempt++ {
+		if err := limiter.wait(ctx); err != nil {
+			return nil, contextError(ctx, "embed", err)
+		}
+		res, err := c.EmbedContext(ctx, request)
+		if err == nil && len(res.Embeddings) != len(request.Input) {
+			err = fmt.Errorf("embed returned %d embeddings for %d inputs", len(res.Embeddings), len(request.Input))
+		}
+		if err == nil {
+			return res.Embeddings, nil
+		}
+
+		// Judge API errors by their status and connection errors by their cause,
+		// like the client's own retries do; anything else would fail again
+		var resp *http.Response
+		var cause error
+		var apiErr *APIError
+		var urlErr *url.Error
+		switch {
+		case errors.As(err, &apiErr):
+			resp = &http.Response{StatusCode: apiErr.StatusCode, Header: apiErr.Header}
+		case errors.As(err, &urlErr):
+			cause = urlErr
+		default:
+			return nil, err
+		}
+		if ctx.Err() != nil || !retry.shouldRetry(attempt, resp, cause) {
+			return nil, err
+		}
+		if err := sleepContext(ctx, retry.delay(attempt, resp)); err != nil {
+			return nil, contextError(ctx, "embed", err)
+		}
+	}
+}
+
+// rateLimiter spaces out events to at most a given number per second; a nil rateLimiter never waits.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// wait blocks until the next event is allowed or ctx is done.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	l.mu.Lock()
+	at := l.next
+	if now := time.Now(); at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+	return sleepContext(ctx, time.Until(at))
+}
@@ -0,0 +1,214 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// embedAllServer embeds each numeric input n as [n]. A batch containing "bad" fails with 400,
+// one containing "flaky" fails with 503 on its first attempt. Records the peak number of requests in flight.
+func embedAllServer(t *testing.T, delay time.Duration, peak *atomic.Int32) *Client {
+	t.Helper()
+	var inFlight atomic.Int32
+	var mu sync.Mutex
+	seen := map[string]bool{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(delay)
+
+		var req EmbedRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		res := EmbedResponse{Model: req.Model}
+		for _, in := range req.Input {
+			switch in {
+			case "bad":
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error":"invalid input"}`))
+				return
+			case "flaky":
+				mu.Lock()
+				first := !seen[in]
+				seen[in] = true
+				mu.Unlock()
+				if first {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+			}
+			f, _ := strconv.ParseFloat(in, 64)
+			res.Embeddings = append(res.Embeddings, []float64{f})
+		}
+		_ = json.NewEncoder(w).Encode(res)
+	}))
+	t.Cleanup(srv.Close)
+	return NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"})
+}
+
+func numberInputs(n int) []string {
+	inputs := make([]string, n)
+	for i := range inputs {
+		inputs[i] = strconv.Itoa(i)
+	}
+	return inputs
+}
+
+func TestEmbedAll_OrderAndConcurrency(t *testing.T) {
+	var peak atomic.Int32
+	client := embedAllServer(t, 5*time.Millisecond, &peak)
+
+	var progress []int
+	embeddings, err := client.EmbedAll(context.Background(), "m", numberInputs(100), EmbedOptions{
+		BatchSize:   7,
+		Concurrency: 4,
+		OnProgress: func(done, total int) {
+			if total != 100 {
+				t.Errorf("total = %d", total)
+			}
+			progress = append(progress, done)
+		},
+	})
+	if err != nil {
+		t.Fatalf("EmbedAll error: %v", err)
+	}
+	for i, e := range embeddings {
+		if len(e) != 1 || e[0] != float64(i) {
+			t.Fatalf("embedding %d = %v, out of order", i, e)
+		}
+	}
+	if p := peak.Load(); p < 2 || p > 4 {
+		t.Errorf("peak concurrency = %d, want 2-4", p)
+	}
+	if len(progress) != 15 || !slices.IsSorted(progress) || progress[14] != 100 {
+		t.Errorf("progress = %v", progress)
+	}
+}
+
+func TestEmbedAll_RetriesAndReportsFailedIndices(t *testing.T) {
+	var peak atomic.Int32
+	client := embedAllServer(t, 0, &peak)
+
+	inputs := numberInputs(10)
+	inputs[1] = "flaky"
+	inputs[7] = "bad"
+	retry := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	embeddings, err := client.EmbedAll(context.Background(), "m", inputs, EmbedOptions{BatchSize: 3, Concurrency: 2, Retry: &retry})
+
+	var embedErr *EmbedAllError
+	if !errors.As(err, &embedErr) {
+		t.Fatalf("err = %v, want *EmbedAllError", err)
+	}
+	if !slices.Equal(embedErr.Failed, []int{6, 7, 8}) || len(embedErr.Errs) != 1 {
+		t.Errorf("failed = %v, errs = %v", embedErr.Failed, embedErr.Errs)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("err = %v, want the 400 APIError inside", err)
+	}
+	for i, e := range embeddings {
+		if failed := slices.Contains(embedErr.Failed, i); failed != (e == nil) {
+			t.Errorf("embedding %d = %v, failed %v", i, e, failed)
+		}
+	}
+	if embeddings[1] == nil {
+		t.Error("flaky batch not retried")
+	}
+}
+
+func TestEmbedAll_RetriesOnlyTransientFailures(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req EmbedRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if requests.Add(1) == 1 && req.Input[0] == "busy" {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		// One embedding too few for every batch but "busy"
+		res := EmbedResponse{Model: req.Model, Embeddings: [][]float64{{1}}}
+		if req.Input[0] == "busy" {
+			res.Embeddings = append(res.Embeddings, []float64{2})
+		}
+		_ = json.NewEncoder(w).Encode(res)
+	}))
+	defer srv.Close()
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL})
+	retry := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+
+	// The wrong number of embeddings is not retried
+	if _, err := client.EmbedAll(context.Background(), "m", []string{"a", "b"}, EmbedOptions{Retry: &retry}); err == nil {
+		t.Fatal("expected an error for a short answer")
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("%d requests for a short answer, want 1", n)
+	}
+
+	// Retry-After is honored over the backoff
+	requests.Store(0)
+	start := time.Now()
+	if _, err := client.EmbedAll(context.Background(), "m", []string{"busy", "x"}, EmbedOptions{Retry: &retry}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond || requests.Load() != 2 {
+		t.Errorf("retried after %v in %d requests, want Retry-After's 1s", elapsed, requests.Load())
+	}
+
+	// Without a policy a batch is sent once
+	requests.Store(0)
+	if _, err := client.EmbedAll(context.Background(), "m", []string{"busy", "x"}, EmbedOptions{}); err == nil || requests.Load() != 1 {
+		t.Errorf("err = %v after %d requests, want the 429 after 1", err, requests.Load())
+	}
+}
+
+func TestEmbedAll_RateLimit(t *testing.T) {
+	var peak atomic.Int32
+	client := embedAllServer(t, 0, &peak)
+
+	start := time.Now()
+	_, err := client.EmbedAll(context.Background(), "m", numberInputs(5), EmbedOptions{BatchSize: 1, Concurrency: 5, RequestsPerSecond: 50})
+	if err != nil {
+		t.Fatalf("EmbedAll error: %v", err)
+	}
+	// 5 requests at 50/s: the last one starts 80ms after the first
+	if elapsed := time.Since(start); elapsed < 75*time.Millisecond {
+		t.Errorf("5 requests took %v, rate limit not applied", elapsed)
+	}
+}
+
+func TestEmbedAll_CancelReportsUnsentInputs(t *testing.T) {
+	var peak atomic.Int32
+	client := embedAllServer(t, 0, &peak)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	embeddings, err := client.EmbedAll(ctx, "m", numberInputs(10), EmbedOptions{
+		BatchSize:  2,
+		OnProgress: func(done, total int) { cancel() },
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	var embedErr *EmbedAllError
+	if !errors.As(err, &embedErr) || len(embedErr.Failed) == 0 || embedErr.Failed[len(embedErr.Failed)-1] != 9 {
+		t.Errorf("failed = %v, want the unsent inputs", embedErr)
+	}
+	if embeddings[0] == nil || embeddings[1] == nil {
+		t.Error("first batch lost after cancel")
+	}
+}
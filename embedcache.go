@@ -0,0 +1,244 @@
+package ollama
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// embedCacheMagic starts an embedding cache file. It is followed by records of a
+// sha256 key, a little-endian uint32 dimension and that many little-endian float64 values.
+const embedCacheMagic = "go-ollama embed cache v1\n"
+
+// maxEmbedCacheDim bounds the dimension of a record; larger ones mark a corrupt file
+const maxEmbedCacheDim = 1 << 16
+
+// embedCacheKey identifies an embedding by model, truncate flag and input
+type embedCacheKey [sha256.Size]byte
+
+// EmbedCacheStats are the counters of an EmbedCache
+type EmbedCacheStats struct {
+	Hits    int64 // Inputs answered from the cache
+	Misses  int64 // Inputs sent to the server
+	Entries int   // Embeddings stored
+	Bytes   int64 // Size of the cache file
+}
+
+// EmbedCache is a persistent, file-backed cache of embeddings, safe for concurrent use.
+// Use it with WithEmbedCache: Embed, EmbedAll and everything built on them then only
+// send the inputs the cache does not know yet. Entries are keyed by model, truncate flag
+// and the sha256 of the input, and appended to the file as they are fetched.
+// A file must not be opened by more than one EmbedCache at a time.
+type EmbedCache struct {
+	mu      sync.Mutex
+	file    *os.File
+	entries map[embedCacheKey][]float64
+	stats   EmbedCacheStats
+	err     error // First failed write, reported by Close
+}
+
+// OpenEmbedCache opens the cache file at path, creating it and its directory if needed.
+// A record cut short by a crash is dropped.
+func OpenEmbedCache(path string) (*EmbedCache, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for embedding cache: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open embedding cache: %w", err)
+	}
+	c := &EmbedCache{file: f, entries: map[embedCacheKey][]float64{}}
+	if err := c.load(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to load embedding cache %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// load reads the records of the file and positions it for appending
+func (c *EmbedCache) load() error {
+	info, err := c.file.Stat()
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(c.file)
+	magic := make([]byte, len(embedCacheMagic))
+	n, err := io.ReadFull(r, magic)
+	switch {
+	case n == 0 && err == io.EOF:
+		if _, err := c.file.WriteString(embedCacheMagic); err != nil {
+			return err
+		}
+		c.stats.Bytes = int64(len(embedCacheMagic))
+		return nil
+	case err != nil || string(magic) != embedCacheMagic:
+		return errors.New("not an embedding cache file")
+	}
+
+	good := int64(len(embedCacheMagic))
+	for {
+		var key embedCacheKey
+		var dim uint32
+		if _, err := io.ReadFull(r, key[:]); err != nil {
+			break
+		}
+		if err := binary.Read(r, binary.LittleEndian, &dim); err != nil {
+			break
+		}
+		if dim > maxEmbedCacheDim {
+			return fmt.Errorf("corrupt embedding cache: record at offset %d has dimension %d", good, dim)
+		}
+		if 8*int64(dim) > info.Size()-good-int64(len(key))-4 {
+			break
+		}
+		embedding := make([]float64, dim)
+		if err := binary.Read(r, binary.LittleEndian, embedding); err != nil {
+			break
+		}
+		c.entries[key] = embedding
+		good += int64(len(key)) + 4 + 8*int64(dim)
+	}
+	// Drop an incomplete last record
+	if err := c.file.Truncate(good); err != nil {
+		return err
+	}
+	if _, err := c.file.Seek(good, io.SeekStart); err != nil {
+		return err
+	}
+	c.stats.Bytes = good
+	return nil
+}
+
+// Stats returns the hit and miss counters since the cache was opened and the size of the store
+func (c *EmbedCache) Stats() EmbedCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	return stats
+}
+
+// Close closes the cache file. It returns the first error of writing to it, if any:
+// embeddings that could not be written were still served from memory.
+func (c *EmbedCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.file.Close(); err != nil && c.err == nil {
+		c.err = fmt.Errorf("failed to close embedding cache: %w", err)
+	}
+	return c.err
+}
+
+// WithEmbedCache answers embedding requests from cache where possible, see EmbedCache
+func WithEmbedCache(cache *EmbedCache) Option {
+	return func(o *clientOptions) error {
+		if cache == nil {
+			return errors.New("embed cache is nil")
+		}
+		o.embedCache = cache
+		return nil
+	}
+}
+
+// embed returns the cached embeddings of request and fetches the others with fetch,
+// sending every missing input once. The result keeps the order of request.Input;
+// its durations and counts are those of the fetch, zero if everything was cached.
+func (c *EmbedCache) embed(ctx context.Context, request EmbedRequest, fetch func(context.Context, EmbedRequest) (*EmbedResponse, error)) (*EmbedResponse, error) {
+	keys := make([]embedCacheKey, len(request.Input))
+	embeddings := make([][]float64, len(request.Input))
+	missing := map[embedCacheKey]int{} // Key to index in the fetch request
+	var fetchInput []string
+
+	c.mu.Lock()
+	for i, input := range request.Input {
+		keys[i] = cacheKey(request.Model, request.Truncate, input)
+		if embedding, ok := c.entries[keys[i]]; ok {
+			embeddings[i] = slices.Clone(embedding)
+			c.stats.Hits++
+			continue
+		}
+		if _, ok := missing[keys[i]]; !ok {
+			missing[keys[i]] = len(fetchInput)
+			fetchInput = append(fetchInput, input)
+		}
+	}
+	c.stats.Misses += int64(len(fetchInput))
+	c.mu.Unlock()
+
+	result := &EmbedResponse{Model: request.Model}
+	if len(fetchInput) > 0 {
+		miss := request
+		miss.Input = fetchInput
+		fetched, err := fetch(ctx, miss)
+		if err != nil {
+			return nil, err
+		}
+		if len(fetched.Embeddings) != len(fetchInput) {
+			return nil, fmt.Errorf("embed returned %d embeddings for %d inputs", len(fetched.Embeddings), len(fetchInput))
+		}
+		c.store(keys, missing, fetched.Embeddings)
+		for i, key := range keys {
+			if embeddings[i] == nil {
+				embeddings[i] = slices.Clone(fetched.Embeddings[missing[key]])
+			}
+		}
+		result = fetched
+	}
+	result.Embeddings = embeddings
+	return result, nil
+}
+
+// store adds the fetched embeddings to the cache and appends them to the file
+func (c *EmbedCache) store(keys []embedCacheKey, missing map[embedCacheKey]int, fetched [][]float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var buf []byte
+	for _, key := range keys {
+		i, ok := missing[key]
+		if _, stored := c.entries[key]; !ok || stored {
+			continue
+		}
+		embedding := slices.Clone(fetched[i])
+		c.entries[key] = embedding
+		buf = append(buf, key[:]...)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(embedding)))
+		for _, v := range embedding {
+			buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(v))
+		}
+	}
+	if len(buf) == 0 || c.err != nil {
+		return
+	}
+	n, err := c.file.Write(buf)
+	c.stats.Bytes += int64(n)
+	if err != nil {
+		c.err = fmt.Errorf("failed to write embedding cache: %w", err)
+	}
+}
+
+// cacheKey hashes the model, the truncate flag (nil is the server default, true) and the input
+func cacheKey(model string, truncate *bool, input string) embedCacheKey {
+	flag := "1"
+	if truncate != nil && !*truncate {
+		flag = "0"
+	}
+	h := sha256.New()
+	h.Write([]byte(model))
+	h.Write([]byte{0})
+	h.Write([]byte(flag))
+	h.Write([]byte{0})
+	h.Write([]byte(input))
+	var key embedCacheKey
+	h.Sum(key[:0])
+	return key
+}
@@ -0,0 +1,184 @@
+package ollama
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// cachedEmbedServer embeds each input as [len(input), model length] and records the inputs it receives
+func cachedEmbedServer(t *testing.T, received *[]string) *httptest.Server {
+	t.Helper()
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req EmbedRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		*received = append(*received, req.Input...)
+		mu.Unlock()
+		res := EmbedResponse{Model: req.Model, PromptEvalCount: len(req.Input)}
+		for _, in := range req.Input {
+			res.Embeddings = append(res.Embeddings, []float64{float64(len(in)), float64(len(req.Model))})
+		}
+		_ = json.NewEncoder(w).Encode(res)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestEmbedCache_OnlySendsMissesAndPersists(t *testing.T) {
+	var received []string
+	srv := cachedEmbedServer(t, &received)
+	path := filepath.Join(t.TempDir(), "cache", "embeddings.bin")
+	ctx := context.Background()
+
+	cache, err := OpenEmbedCache(path)
+	if err != nil {
+		t.Fatalf("OpenEmbedCache error: %v", err)
+	}
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"}, WithEmbedCache(cache))
+	if _, err := client.EmbedContext(ctx, EmbedRequest{Model: "m", Input: []string{"a", "bb"}}); err != nil {
+		t.Fatalf("Embed error: %v", err)
+	}
+	if err := cache.Close(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+
+	// A new process: the cache is loaded from the file
+	cache, err = OpenEmbedCache(path)
+	if err != nil {
+		t.Fatalf("reopen error: %v", err)
+	}
+	defer cache.Close()
+	client = NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"}, WithEmbedCache(cache))
+	received = nil
+	res, err := client.EmbedContext(ctx, EmbedRequest{Model: "m", Input: []string{"bb", "ccc", "a", "ccc"}})
+	if err != nil {
+		t.Fatalf("Embed error: %v", err)
+	}
+	if !slices.Equal(received, []string{"ccc"}) {
+		t.Errorf("server received %q, want only the miss once", received)
+	}
+	for i, want := range []float64{2, 3, 1, 3} {
+		if res.Embeddings[i][0] != want {
+			t.Errorf("embedding %d = %v, want length %v", i, res.Embeddings[i], want)
+		}
+	}
+	if res.PromptEvalCount != 1 {
+		t.Errorf("PromptEvalCount = %d, want that of the miss request", res.PromptEvalCount)
+	}
+
+	stats := cache.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Entries != 3 {
+		t.Errorf("stats = %+v, want 2 hits, 1 miss, 3 entries", stats)
+	}
+	if info, _ := os.Stat(path); stats.Bytes != info.Size() {
+		t.Errorf("Bytes = %d, file has %d", stats.Bytes, info.Size())
+	}
+}
+
+func TestEmbedCache_KeyIncludesModelAndTruncate(t *testing.T) {
+	var received []string
+	srv := cachedEmbedServer(t, &received)
+	cache, err := OpenEmbedCache(filepath.Join(t.TempDir(), "embeddings.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"}, WithEmbedCache(cache))
+
+	no, yes := false, true
+	for _, req := range []EmbedRequest{
+		{Model: "m", Input: []string{"x"}},
+		{Model: "m", Input: []string{"x"}, Truncate: &yes}, // same as the server default
+		{Model: "other", Input: []string{"x"}},
+		{Model: "m", Input: []string{"x"}, Truncate: &no},
+	} {
+		if _, err := client.Embed(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(received) != 3 {
+		t.Errorf("server received %d inputs, want 3", len(received))
+	}
+}
+
+func TestEmbedCache_EmbedAllHitsCache(t *testing.T) {
+	var received []string
+	srv := cachedEmbedServer(t, &received)
+	cache, err := OpenEmbedCache(filepath.Join(t.TempDir(), "embeddings.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"}, WithEmbedCache(cache))
+
+	inputs := numberInputs(20)
+	opts := EmbedOptions{BatchSize: 3, Concurrency: 3}
+	if _, err := client.EmbedAll(context.Background(), "m", inputs, opts); err != nil {
+		t.Fatal(err)
+	}
+	received = nil
+	embeddings, err := client.EmbedAll(context.Background(), "m", inputs, opts)
+	if err != nil || len(embeddings) != 20 || len(received) != 0 {
+		t.Errorf("second run sent %d inputs, err %v", len(received), err)
+	}
+}
+
+func TestEmbedCache_DropsIncompleteRecord(t *testing.T) {
+	var received []string
+	srv := cachedEmbedServer(t, &received)
+	path := filepath.Join(t.TempDir(), "embeddings.bin")
+
+	cache, _ := OpenEmbedCache(path)
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"}, WithEmbedCache(cache))
+	_, _ = client.Embed(EmbedRequest{Model: "m", Input: []string{"a", "b"}})
+	size := cache.Stats().Bytes
+	_ = cache.Close()
+
+	// A crash in the middle of a write
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	_, _ = f.Write([]byte("partial record"))
+	_ = f.Close()
+
+	cache, err := OpenEmbedCache(path)
+	if err != nil {
+		t.Fatalf("reopen error: %v", err)
+	}
+	defer cache.Close()
+	if stats := cache.Stats(); stats.Entries != 2 || stats.Bytes != size {
+		t.Errorf("stats = %+v, want 2 entries in %d bytes", stats, size)
+	}
+}
+
+func TestEmbedCache_RejectsForeignFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	_ = os.WriteFile(path, []byte("not a cache at all, just some notes"), 0644)
+	if _, err := OpenEmbedCache(path); err == nil {
+		t.Error("expected error opening a foreign file")
+	}
+	if _, err := NewClient(nil, WithEmbedCache(nil)); err == nil {
+		t.Error("expected error for a nil cache")
+	}
+}
+
+func TestEmbedCache_RejectsCorruptDimension(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "embeddings.bin")
+	record := make([]byte, sha256.Size+4)
+	binary.LittleEndian.PutUint32(record[sha256.Size:], math.MaxUint32)
+	_ = os.WriteFile(path, append([]byte(embedCacheMagic), record...), 0644)
+
+	if _, err := OpenEmbedCache(path); err == nil || !strings.Contains(err.Error(), "corrupt") {
+		t.Errorf("error = %v, want a corruption error", err)
+	}
+}
@@ -0,0 +1,129 @@
+package ollama
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ollamaEndpoints are the paths of the Ollama API endpoints below the base URL, by endpoint name
+var ollamaEndpoints = map[string]string{
+	"generate": "/api/generate",
+	"chat":     "/api/chat",
+	"embed":    "/api/embed",
+	"ps":       "/api/ps",
+	"tags":     "/api/tags",
+	"show":     "/api/show",
+	"pull":     "/api/pull",
+	"push":     "/api/push",
+	"create":   "/api/create",
+	"copy":     "/api/copy",
+	"delete":   "/api/delete",
+	"version":  "/api/version",
+}
+
+// openAIEndpoints are the paths of the OpenAI-compatible endpoints below the base URL, by endpoint name
+var openAIEndpoints = map[string]string{
+	"chat/completions": "/chat/completions",
+	"embeddings":       "/embeddings",
+	"models":           "/models",
+}
+
+// defaultEndpoints returns the endpoint paths of backend
+func defaultEndpoints(backend Backend) map[string]string {
+	if backend == BackendOpenAI {
+		return openAIEndpoints
+	}
+	return ollamaEndpoints
+}
+
+// routes resolves the endpoint URLs of a Client from its DSN
+type routes struct {
+	base      string            // Base URL without trailing slash and query
+	query     string            // Query of DSN.URL, added to every endpoint URL
+	endpoints map[string]string // Endpoint paths below base or absolute URLs, by name
+}
+
+// newRoutes derives the base URL from d.URL and overrides the default endpoint paths
+// with d.Endpoints. d.URL is either the base URL or, as in DSNs written for earlier
+// versions, the URL of an endpoint: ".../api/generate" has the base before "/api",
+// while an endpoint name below another path, e.g. "https://gw/llm/generate",
+// keeps its siblings there ("https://gw/llm/embed").
+func newRoutes(d DSN) routes {
+	raw, query, _ := strings.Cut(strings.TrimSpace(d.URL), "?")
+	r := routes{base: strings.TrimSuffix(raw, "/"), query: query, endpoints: map[string]string{}}
+	defaults := defaultEndpoints(d.Backend)
+	for name, p := range defaults {
+		r.endpoints[name] = p
+	}
+
+	if u, err := url.Parse(r.base); err == nil {
+		p := u.Path
+		if d.Backend == BackendOpenAI {
+			p = strings.TrimSuffix(p, "/chat/completions")
+		} else if dir, last := path.Split(p); defaults[last] != "" {
+			p = strings.TrimSuffix(dir, "/")
+			if prefix, ok := strings.CutSuffix(p, "/api"); ok {
+				p = prefix
+			} else {
+				for name := range r.endpoints {
+					r.endpoints[name] = "/" + name
+				}
+			}
+		} else {
+			p = strings.TrimSuffix(p, "/api")
+		}
+		u.Path, u.RawPath = p, ""
+		r.base = u.String()
+	}
+
+	for name, p := range d.Endpoints {
+		if !strings.Contains(p, "://") && !strings.HasPrefix(p, "/") {
+			p = "/" + p
+		}
+		r.endpoints[name] = p
+	}
+	return r
+}
+
+// url returns the URL of the endpoint name. Paths are appended to the base URL,
+// absolute URLs are used as they are; the query of DSN.URL is added to both.
+func (r routes) url(name string) string {
+	u, ok := r.endpoints[name]
+	if !ok {
+		u = "/" + name
+	}
+	if !strings.Contains(u, "://") {
+		u = r.base + u
+	}
+	if r.query != "" {
+		sep := "?"
+		if strings.Contains(u, "?") {
+			sep = "&"
+		}
+		u += sep + r.query
+	}
+	return u
+}
+
+// supports returns an error wrapping ErrUnsupported if the backend has no endpoint name.
+// The Ollama backend accepts any name; an endpoint set in DSN.Endpoints is always supported.
+func (c *Client) supports(name string) error {
+	if _, ok := c.routes.endpoints[name]; !ok && c.ds.Backend == BackendOpenAI {
+		return fmt.Errorf("%s request: %w", name, ErrUnsupported)
+	}
+	return nil
+}
+
+// BaseURL returns the base URL the endpoint paths are appended to,
+// e.g. "https://ai.example.com/ollama" for an Open WebUI DSN.
+func (c *Client) BaseURL() string {
+	return c.routes.base
+}
+
+// EndpointURL returns the URL the client sends requests of the endpoint name to,
+// e.g. "embed" or "chat/completions". See DSN.Endpoints for the names.
+func (c *Client) EndpointURL(name string) string {
+	return c.routes.url(name)
+}
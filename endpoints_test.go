@@ -0,0 +1,100 @@
+package ollama
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClient_EndpointURL(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name     string
+		dsn      DSN
+		wantBase string
+		wantURLs map[string]string
+	}{
+		{"generate URL", DSN{URL: "http://localhost:11434/api/generate"}, "http://localhost:11434", map[string]string{
+			"generate": "http://localhost:11434/api/generate",
+			"embed":    "http://localhost:11434/api/embed",
+			"ps":       "http://localhost:11434/api/ps",
+		}},
+		{"base URL", DSN{URL: "http://localhost:11434/"}, "http://localhost:11434", map[string]string{
+			"generate": "http://localhost:11434/api/generate",
+			"tags":     "http://localhost:11434/api/tags",
+		}},
+		{"open webui", DSN{URL: "https://ai.example.com/ollama"}, "https://ai.example.com/ollama", map[string]string{
+			"generate": "https://ai.example.com/ollama/api/generate",
+			"embed":    "https://ai.example.com/ollama/api/embed",
+		}},
+		{"api base", DSN{URL: "https://ai.example.com/ollama/api"}, "https://ai.example.com/ollama", map[string]string{
+			"chat": "https://ai.example.com/ollama/api/chat",
+		}},
+		{"other endpoint URL", DSN{URL: "https://ai.example.com/ollama/api/chat"}, "https://ai.example.com/ollama", map[string]string{
+			"generate": "https://ai.example.com/ollama/api/generate",
+		}},
+		{"query", DSN{URL: "https://gw/api/generate?api-version=2"}, "https://gw", map[string]string{
+			"generate": "https://gw/api/generate?api-version=2",
+			"ps":       "https://gw/api/ps?api-version=2",
+		}},
+		{"sibling routes", DSN{URL: "https://gw/llm/generate"}, "https://gw/llm", map[string]string{
+			"generate": "https://gw/llm/generate",
+			"embed":    "https://gw/llm/embed",
+		}},
+		{"overrides", DSN{URL: "https://gw/llm", Endpoints: map[string]string{"embed": "v2/embed", "ps": "https://status.gw/ps?all=1"}}, "https://gw/llm", map[string]string{
+			"generate": "https://gw/llm/api/generate",
+			"embed":    "https://gw/llm/v2/embed",
+			"ps":       "https://status.gw/ps?all=1",
+		}},
+		{"openai base", DSN{URL: "http://vllm:8000/v1", Backend: BackendOpenAI}, "http://vllm:8000/v1", map[string]string{
+			"chat/completions": "http://vllm:8000/v1/chat/completions",
+			"embeddings":       "http://vllm:8000/v1/embeddings",
+			"models":           "http://vllm:8000/v1/models",
+		}},
+		{"openai endpoint URL", DSN{URL: "https://ai.example.com/api/chat/completions"}, "https://ai.example.com/api", map[string]string{
+			"chat/completions": "https://ai.example.com/api/chat/completions",
+			"embeddings":       "https://ai.example.com/api/embeddings",
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := NewOpenWebUiClient(&tc.dsn)
+			if got := c.BaseURL(); got != tc.wantBase {
+				t.Errorf("BaseURL() = %q, want %q", got, tc.wantBase)
+			}
+			for name, want := range tc.wantURLs {
+				if got := c.EndpointURL(name); got != want {
+					t.Errorf("EndpointURL(%q) = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestClient_EndpointOverrides(t *testing.T) {
+	t.Parallel()
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.RequestURI())
+		switch r.URL.Path {
+		case "/gw/vectors":
+			w.Write([]byte(`{"model":"m","embeddings":[[1,0]]}`))
+		case "/gw/api/ps":
+			w.Write([]byte(`{"models":[]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/gw?tenant=a", Endpoints: map[string]string{"embed": "/vectors"}})
+	if _, err := client.Embed(EmbedRequest{Model: "m", Input: []string{"x"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Ps(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/gw/vectors?tenant=a", "/gw/api/ps?tenant=a"}; len(paths) != 2 || paths[0] != want[0] || paths[1] != want[1] {
+		t.Errorf("requests = %q, want %q", paths, want)
+	}
+}
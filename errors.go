@@ -0,0 +1,130 @@
+package ollama
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Sentinel errors matched by *APIError with errors.Is
+var (
+	ErrModelNotFound   = errors.New("model not found")                     // The requested model is not installed
+	ErrUnauthorized    = errors.New("unauthorized")                        // Missing, invalid or insufficient token (HTTP 401/403)
+	ErrContextOverflow = errors.New("context window exceeded")             // The input does not fit into the model's context window
+	ErrStreamTruncated = errors.New("stream ended before the final chunk") // The connection closed before a "done" response arrived
+)
+
+// ErrUnsupported is returned by methods the backend of a Client has no endpoint for,
+// e.g. Ps, Show or Pull on BackendOpenAI
+var ErrUnsupported = errors.New("not supported by the backend")
+
+// APIError is a failure reported by the Ollama or Open WebUI API,
+// either as a non-200 response or as an {"error": "..."} line inside a stream.
+//
+//	var apiErr *ollama.APIError
+//	if errors.As(err, &apiErr) { log.Println(apiErr.StatusCode, apiErr.Message) }
+//	if errors.Is(err, ollama.ErrModelNotFound) { ... pull the model ... }
+type APIError struct {
+	StatusCode int         // HTTP status code; 200 for an error reported inside a stream
+	Endpoint   string      // Name of the API endpoint, e.g. "generate", "chat", "embed"
+	URL        string      // Requested URL
+	Message    string      // Error message parsed from the body, or the trimmed body itself
+	Body       []byte      // Raw response body or stream line
+	Header     http.Header // Response headers, e.g. Retry-After; nil for an error inside a stream
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	if e.StatusCode == http.StatusOK {
+		return fmt.Sprintf("%s request failed: %s", e.Endpoint, e.Message)
+	}
+	return fmt.Sprintf("%s request failed, status code: %d, body: %s", e.Endpoint, e.StatusCode, e.Body)
+}
+
+// Is matches the sentinel errors by status code and message
+func (e *APIError) Is(target error) bool {
+	msg := strings.ToLower(e.Message)
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrModelNotFound:
+		return strings.Contains(msg, "model") && (strings.Contains(msg, "not found") || strings.Contains(msg, "does not exist"))
+	case ErrContextOverflow:
+		for _, hint := range []string{"context length", "context window", "exceeds the context", "prompt is too long", "too many tokens"} {
+			if strings.Contains(msg, hint) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newAPIError builds an APIError, parsing the message from an Ollama {"error": "..."},
+// OpenAI {"error": {"message": "..."}} or Open WebUI {"detail": "..."} body.
+func newAPIError(name, url string, statusCode int, header http.Header, body []byte) *APIError {
+	var parsed struct {
+		Error  json.RawMessage `json:"error"`
+		Detail any             `json:"detail"`
+	}
+	msg := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &parsed) == nil {
+		switch {
+		case errorMessage(parsed.Error) != "":
+			msg = errorMessage(parsed.Error)
+		case parsed.Detail != nil:
+			if detail, ok := parsed.Detail.(string); ok {
+				msg = detail
+			}
+		}
+	}
+	return &APIError{
+		StatusCode: statusCode,
+		Endpoint:   name,
+		URL:        url,
+		Message:    msg,
+		Body:       body,
+		Header:     header,
+	}
+}
+
+// streamError returns an APIError if a stream line is an {"error": "..."}
+// or {"error": {"message": "..."}} object, nil otherwise.
+func streamError(name, url string, line []byte) *APIError {
+	if !strings.Contains(string(line), `"error"`) {
+		return nil
+	}
+	var parsed struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(line, &parsed) != nil {
+		return nil
+	}
+	msg := errorMessage(parsed.Error)
+	if msg == "" {
+		return nil
+	}
+	return &APIError{
+		StatusCode: http.StatusOK,
+		Endpoint:   name,
+		URL:        url,
+		Message:    msg,
+		Body:       append([]byte(nil), line...),
+	}
+}
+
+// errorMessage returns the message of an "error" value: a string, or an object with a "message".
+func errorMessage(raw json.RawMessage) string {
+	var msg string
+	if json.Unmarshal(raw, &msg) == nil {
+		return msg
+	}
+	var obj struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(raw, &obj) == nil {
+		return obj.Message
+	}
+	return ""
+}
@@ -0,0 +1,110 @@
+package ollama
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIError_StatusAndSentinels(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		status  int
+		body    string
+		wantMsg string
+		is      error
+	}{
+		{"ollama model missing", http.StatusNotFound, `{"error":"model \"nope\" not found, try pulling it first"}`, `model "nope" not found, try pulling it first`, ErrModelNotFound},
+		{"open webui auth", http.StatusUnauthorized, `{"detail":"Not authenticated"}`, "Not authenticated", ErrUnauthorized},
+		{"forbidden plain text", http.StatusForbidden, "forbidden\n", "forbidden", ErrUnauthorized},
+		{"context overflow", http.StatusBadRequest, `{"error":"the input length exceeds the context length"}`, "the input length exceeds the context length", ErrContextOverflow},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				fmt.Fprint(w, tc.body)
+			}))
+			defer srv.Close()
+
+			client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"})
+			_, err := client.Embed(EmbedRequest{Model: "nope", Input: []string{"x"}})
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("error %v is not an *APIError", err)
+			}
+			if apiErr.StatusCode != tc.status || apiErr.Endpoint != "embed" || apiErr.Message != tc.wantMsg {
+				t.Errorf("APIError = %+v", apiErr)
+			}
+			if apiErr.URL != srv.URL+"/api/embed" {
+				t.Errorf("URL = %q", apiErr.URL)
+			}
+			if !errors.Is(err, tc.is) {
+				t.Errorf("errors.Is(%v, %v) = false", err, tc.is)
+			}
+			for _, other := range []error{ErrModelNotFound, ErrUnauthorized, ErrContextOverflow, ErrStreamTruncated} {
+				if other != tc.is && errors.Is(err, other) {
+					t.Errorf("error unexpectedly matches %v", other)
+				}
+			}
+		})
+	}
+}
+
+func TestQuery_InStreamError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"response":"partial","done":false}`+"\n")
+		fmt.Fprint(w, `{"error":"prompt is too long for the context window"}`+"\n")
+	}))
+	defer srv.Close()
+
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL})
+
+	var responses []Response
+	err := client.Query(Request{
+		Model:  "m",
+		Prompt: "p",
+		OnJson: func(res Response) error {
+			responses = append(responses, res)
+			return nil
+		},
+	})
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("error %v is not an *APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusOK || apiErr.Endpoint != "generate" {
+		t.Errorf("APIError = %+v", apiErr)
+	}
+	if !errors.Is(err, ErrContextOverflow) {
+		t.Errorf("error %v does not match ErrContextOverflow", err)
+	}
+	if len(responses) != 1 {
+		t.Errorf("error line was delivered to OnJson: %+v", responses)
+	}
+}
+
+func TestQuery_StreamTruncated(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"response":"cut","done":false}`+"\n")
+	}))
+	defer srv.Close()
+
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"})
+	err := client.Query(Request{Model: "m", Prompt: "p"})
+	if !errors.Is(err, ErrStreamTruncated) {
+		t.Fatalf("error = %v, want ErrStreamTruncated", err)
+	}
+
+	err = client.Chat(ChatRequest{Model: "m"})
+	if !errors.Is(err, ErrStreamTruncated) {
+		t.Fatalf("chat error = %v, want ErrStreamTruncated", err)
+	}
+	if !strings.Contains(err.Error(), "chat") {
+		t.Errorf("error %q does not name the endpoint", err)
+	}
+}
@@ -1,6 +1,6 @@
 // Package main demonstrates basic usage of the ollama client library.
 //
-// By default it uses local Ollama. Optional overrides:
+// By default it uses local Ollama, or OLLAMA_HOST if set. Optional overrides:
 //
 //	export OPEN_WEB_API_GENERATE_URL="https://ai.example.com/ollama/api/generate"
 //	export OPEN_WEB_API_TOKEN="sk-..."
@@ -15,14 +15,16 @@ import (
 )
 
 func main() {
-	client := ollama.NewOpenWebUiClient(&ollama.DSN{
-		URL:   os.Getenv("OPEN_WEB_API_GENERATE_URL"),
-		Token: os.Getenv("OPEN_WEB_API_TOKEN"),
-	})
+	dsn, err := ollama.DSNFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	client := ollama.NewOpenWebUiClient(dsn)
 
 	// Simple text query with streaming output
 	fmt.Println("--- Streaming text response ---")
-	err := client.Query(ollama.Request{
+	err = client.Query(ollama.Request{
 		Model:  "llama3.2:3b",
 		Prompt: "Write a haiku about Go programming",
 		Options: &ollama.RequestOptions{
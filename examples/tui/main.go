@@ -1,6 +1,6 @@
 // Package main provides a TUI chat client for Ollama / Open WebUI.
 //
-// By default it talks to local Ollama (http://localhost:11434). To use Open WebUI or another host:
+// By default it talks to local Ollama (http://localhost:11434, or OLLAMA_HOST). To use Open WebUI or another host:
 //
 //	export OPEN_WEB_API_GENERATE_URL="https://ai.example.com/ollama/api/generate"
 //	export OPEN_WEB_API_TOKEN="sk-..."
@@ -8,6 +8,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -22,6 +24,8 @@ import (
 	ollama "github.com/eslider/go-ollama"
 )
 
+// defaultModels is shown until the installed models are fetched from /api/tags,
+// and kept when that fails.
 var defaultModels = []string{
 	"gemma3:1b",
 	//"gemma3:4b",
@@ -92,13 +96,15 @@ var (
 
 type tokenMsg string
 type doneMsg struct {
-	promptEvalCount int
-	evalCount       int
+	metrics ollama.Metrics
 }
 type errMsg struct{ err error }
 type psMsg struct {
 	models map[string]ollama.ProcessModel
 }
+type tagsMsg struct {
+	names []string
+}
 
 // --- Screen state ----------------------------------------------------------
 
@@ -135,6 +141,7 @@ type model struct {
 	selectedModel string
 	history       []chatEntry
 	streaming     bool
+	cancelStream  context.CancelFunc // aborts the in-flight query (esc while streaming)
 	streamBuf     *strings.Builder
 	textarea      textarea.Model
 	viewport      viewport.Model
@@ -142,9 +149,8 @@ type model struct {
 	err           error
 
 	// Token stats
-	tokenCount  int
-	streamStart time.Time
-	lastTokSec  float64 // final tok/s preserved after stream ends
+	tokenCount int
+	lastStats  ollama.Metrics // metrics of the last finished stream, as reported by the server
 
 	// Context window tracking
 	ctxSize int // total context window size (from /api/ps)
@@ -192,7 +198,21 @@ func initialModel(client *ollama.Client, prog **tea.Program) model {
 }
 
 func (m model) Init() tea.Cmd {
-	return m.fetchPs()
+	return tea.Batch(m.fetchPs(), m.fetchTags())
+}
+
+func (m model) fetchTags() tea.Cmd {
+	return func() tea.Msg {
+		list, err := m.client.Tags()
+		if err != nil {
+			return tagsMsg{}
+		}
+		names := make([]string, 0, len(list.Models))
+		for _, lm := range list.Models {
+			names = append(names, lm.Name)
+		}
+		return tagsMsg{names: names}
+	}
 }
 
 func (m model) fetchPs() tea.Cmd {
@@ -230,6 +250,15 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		return m, nil
 
+	case tagsMsg:
+		if len(msg.names) > 0 {
+			m.models = msg.names
+			if m.cursor >= len(m.models) {
+				m.cursor = len(m.models) - 1
+			}
+		}
+		return m, nil
+
 	case tea.KeyMsg:
 		if msg.String() == "ctrl+c" {
 			return m, tea.Quit
@@ -351,6 +380,9 @@ func (m model) updateChat(msg tea.Msg) (tea.Model, tea.Cmd) {
 		switch msg.String() {
 		case "esc":
 			if m.streaming {
+				if m.cancelStream != nil {
+					m.cancelStream()
+				}
 				return m, nil
 			}
 			m.textarea.Blur()
@@ -377,12 +409,13 @@ func (m model) updateChat(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.history = append(m.history, chatEntry{role: "assistant", text: ""})
 			m.streaming = true
 			m.tokenCount = 0
-			m.lastTokSec = 0
-			m.streamStart = time.Now()
+			m.lastStats = ollama.Metrics{}
 			m.streamBuf.Reset()
 			m.refreshViewport()
 
-			go m.runQuery()
+			ctx, cancel := context.WithCancel(context.Background())
+			m.cancelStream = cancel
+			go m.runQuery(ctx)
 			return m, nil
 		}
 
@@ -396,24 +429,24 @@ func (m model) updateChat(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case doneMsg:
-		elapsed := time.Since(m.streamStart).Seconds()
-		if elapsed > 0 {
-			m.lastTokSec = float64(m.tokenCount) / elapsed
+		m.lastStats = msg.metrics
+		if msg.metrics.PromptEvalCount != nil && msg.metrics.EvalCount != nil {
+			m.ctxUsed = *msg.metrics.PromptEvalCount + *msg.metrics.EvalCount
 		}
-		m.ctxUsed = msg.promptEvalCount + msg.evalCount
 		m.streaming = false
+		m.stopStream()
 		m.refreshViewport()
 		focusCmd := m.textarea.Focus()
 		psCmd := m.fetchPs()
 		return m, tea.Batch(focusCmd, psCmd)
 
 	case errMsg:
-		elapsed := time.Since(m.streamStart).Seconds()
-		if elapsed > 0 {
-			m.lastTokSec = float64(m.tokenCount) / elapsed
-		}
 		m.streaming = false
-		m.err = msg.err
+		m.stopStream()
+		// Stopped by the user: keep the partial answer, it's not an error.
+		if !errors.Is(msg.err, context.Canceled) {
+			m.err = msg.err
+		}
 		if len(m.history) > 0 {
 			last := &m.history[len(m.history)-1]
 			if last.role == "assistant" && last.text == "" {
@@ -438,30 +471,29 @@ func (m model) updateChat(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
-// buildConversationPrompt formats all previous messages into a single prompt
-// so the model has the full conversation context.
-func (m model) buildConversationPrompt() string {
-	var sb strings.Builder
+// stopStream releases the cancel function of the finished query.
+func (m *model) stopStream() {
+	if m.cancelStream != nil {
+		m.cancelStream()
+		m.cancelStream = nil
+	}
+}
+
+// buildMessages converts the chat history into chat API messages
+// so the model sees the full conversation through its own chat template.
+func (m model) buildMessages(system string) []ollama.ChatMessage {
+	msgs := []ollama.ChatMessage{{Role: ollama.RoleSystem, Content: system}}
 	for _, entry := range m.history {
-		switch entry.role {
-		case "user":
-			sb.WriteString("User: ")
-			sb.WriteString(entry.text)
-			sb.WriteString("\n\n")
-		case "assistant":
-			if entry.text != "" {
-				sb.WriteString("Assistant: ")
-				sb.WriteString(entry.text)
-				sb.WriteString("\n\n")
-			}
+		// Skip the empty assistant placeholder that is being streamed into.
+		if entry.text == "" {
+			continue
 		}
+		msgs = append(msgs, ollama.ChatMessage{Role: ollama.ChatRole(entry.role), Content: entry.text})
 	}
-	// The last entry is the empty assistant placeholder — prompt the model to continue.
-	sb.WriteString("Assistant: ")
-	return sb.String()
+	return msgs
 }
 
-func (m model) runQuery() {
+func (m model) runQuery(ctx context.Context) {
 	p := *m.prog
 
 	sysParts := []string{
@@ -471,27 +503,21 @@ func (m model) runQuery() {
 	if m.systemPrompt != "" {
 		sysParts = append(sysParts, m.systemPrompt)
 	}
-	sys := ollama.String(strings.Join(sysParts, "\n"))
+	sys := strings.Join(sysParts, "\n")
 
-	fullPrompt := m.buildConversationPrompt()
-
-	var finalPromptEval, finalEval int
-	err := m.client.Query(ollama.Request{
-		Model:  m.selectedModel,
-		Prompt: fullPrompt,
-		System: sys,
+	var metrics ollama.Metrics
+	err := m.client.ChatContext(ctx, ollama.ChatRequest{
+		Model:    m.selectedModel,
+		Messages: m.buildMessages(sys),
 		Options: &ollama.RequestOptions{
 			Temperature: ollama.Float(0.7),
 		},
-		OnJson: func(res ollama.Response) error {
-			if res.Response != nil {
-				p.Send(tokenMsg(*res.Response))
-			}
-			if res.PromptEvalCount != nil {
-				finalPromptEval = *res.PromptEvalCount
+		OnJson: func(res ollama.ChatResponse) error {
+			if res.Message != nil {
+				p.Send(tokenMsg(res.Message.Content))
 			}
-			if res.EvalCount != nil {
-				finalEval = *res.EvalCount
+			if res.Done != nil && *res.Done {
+				metrics = res.Metrics
 			}
 			return nil
 		},
@@ -500,7 +526,7 @@ func (m model) runQuery() {
 		p.Send(errMsg{err: err})
 		return
 	}
-	p.Send(doneMsg{promptEvalCount: finalPromptEval, evalCount: finalEval})
+	p.Send(doneMsg{metrics: metrics})
 }
 
 func (m *model) refreshViewport() {
@@ -690,25 +716,19 @@ func (m model) statusLine() string {
 	ctx := m.ctxInfo()
 
 	if m.streaming {
-		elapsed := time.Since(m.streamStart).Seconds()
-		tokSec := float64(0)
-		if elapsed > 0 {
-			tokSec = float64(m.tokenCount) / elapsed
-		}
-		stats := statsStyle.Render(
-			fmt.Sprintf("%d tok  •  %.1f tok/s", m.tokenCount, tokSec),
-		)
+		stats := statsStyle.Render(fmt.Sprintf("%d tok", m.tokenCount))
 		line := fmt.Sprintf("⏳ %s", stats)
 		if ctx != "" {
 			line += "  •  " + statsStyle.Render(ctx)
 		}
-		return line + "  •  ctrl+c quit"
+		return line + "  •  esc stop  •  ctrl+c quit"
 	}
 
 	parts := []string{"enter send", "ctrl+m model", "esc back", "ctrl+c quit"}
 	if m.tokenCount > 0 {
 		stats := statsStyle.Render(
-			fmt.Sprintf("%d tok  •  %.1f tok/s", m.tokenCount, m.lastTokSec),
+			fmt.Sprintf("%d tok  •  %.1f tok/s  •  ttft %s",
+				m.tokenCount, m.lastStats.TokensPerSecond(), m.lastStats.TimeToFirstToken().Round(time.Millisecond)),
 		)
 		line := fmt.Sprintf("✓ %s", stats)
 		if ctx != "" {
@@ -736,10 +756,12 @@ func formatBytes(b int64) string {
 // --- Main ------------------------------------------------------------------
 
 func main() {
-	client := ollama.NewOpenWebUiClient(&ollama.DSN{
-		URL:   os.Getenv("OPEN_WEB_API_GENERATE_URL"),
-		Token: os.Getenv("OPEN_WEB_API_TOKEN"),
-	})
+	dsn, err := ollama.DSNFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	client := ollama.NewOpenWebUiClient(dsn)
 
 	var p *tea.Program
 	m := initialModel(client, &p)
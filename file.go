@@ -6,8 +6,9 @@ import (
 	"path/filepath"
 )
 
-// OpenFileDescriptor opens a file descriptor at the given path
+// OpenFileDescriptor opens a file descriptor at the given path for writing
 //   - If the file does not exist, it will be created
+//   - If the file exists, it is truncated
 //   - If the directory does not exist, it will be created
 //   - Returns the file descriptor and an error if any
 //   - The path can be absolute or relative to the current working directory
@@ -27,5 +28,39 @@ func OpenFileDescriptor(path string) (*os.File, error) {
 		return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
 	}
 
-	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+}
+
+// WriteFile replaces the content of the file at path with data
+//   - The file and its parent directories are created if needed
+//   - An existing file is truncated on open, so a shorter content leaves no old tail
+func WriteFile(path string, data []byte) error {
+	f, err := OpenFileDescriptor(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// WriteRootFile is WriteFile for a path relative to root.
+// Neither the file nor its created parent directories can escape root, not even through symlinks.
+func WriteRootFile(root *os.Root, name string, data []byte) error {
+	if dir := filepath.Dir(name); dir != "." {
+		if err := root.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+	}
+	f, err := root.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return f.Close()
 }
@@ -0,0 +1,25 @@
+package ollama
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenFileDescriptor_Truncates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dir", "a.txt")
+	if err := WriteFile(path, []byte("a much longer first version\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := OpenFileDescriptor(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("short\n"); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if got := readFile(t, path); got != "short\n" {
+		t.Errorf("content = %q, want %q", got, "short\n")
+	}
+}
@@ -0,0 +1,228 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ListModel describes an installed model returned by /api/tags.
+type ListModel struct {
+	Name       string              `json:"name"`
+	Model      string              `json:"model"`
+	ModifiedAt *time.Time          `json:"modified_at,omitempty"`
+	Size       int64               `json:"size"`
+	Digest     string              `json:"digest"`
+	Details    ProcessModelDetails `json:"details"`
+}
+
+// ListResponse is the response from /api/tags listing installed models.
+type ListResponse struct {
+	Models []ListModel `json:"models"`
+}
+
+// ShowRequest is a request to the /api/show endpoint.
+type ShowRequest struct {
+	Model   string `json:"model"`
+	Verbose *bool  `json:"verbose,omitempty"` // (optional) include large fields such as the full tokenizer in ModelInfo
+}
+
+// ShowResponse holds the modelfile, template, parameters and metadata of a model.
+type ShowResponse struct {
+	License      string              `json:"license,omitempty"`
+	Modelfile    string              `json:"modelfile,omitempty"`
+	Parameters   string              `json:"parameters,omitempty"`
+	Template     string              `json:"template,omitempty"`
+	System       string              `json:"system,omitempty"`
+	Details      ProcessModelDetails `json:"details"`
+	ModelInfo    map[string]any      `json:"model_info,omitempty"`
+	Capabilities []string            `json:"capabilities,omitempty"`
+	ModifiedAt   *time.Time          `json:"modified_at,omitempty"`
+}
+
+// ProgressResponse is a status line streamed by pull, push and create.
+// Digest, Total and Completed are set while a layer is being transferred.
+type ProgressResponse struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+}
+
+// PullRequest is a request to the /api/pull endpoint.
+type PullRequest struct {
+	Model      string                       `json:"model"`
+	Insecure   *bool                        `json:"insecure,omitempty"` // (optional) allow insecure connections to the library
+	OnProgress func(ProgressResponse) error `json:"-"`
+}
+
+// PushRequest is a request to the /api/push endpoint.
+type PushRequest struct {
+	Model      string                       `json:"model"` // <namespace>/<model>:<tag>
+	Insecure   *bool                        `json:"insecure,omitempty"`
+	OnProgress func(ProgressResponse) error `json:"-"`
+}
+
+// CreateRequest is a request to the /api/create endpoint.
+// See: https://github.com/ollama/ollama/blob/main/docs/api.md#create-a-model
+type CreateRequest struct {
+	Model      string                       `json:"model"`
+	From       string                       `json:"from,omitempty"`       // (optional) existing model to create from
+	Files      map[string]string            `json:"files,omitempty"`      // (optional) file names to blob digests of the GGUF/safetensors files
+	Adapters   map[string]string            `json:"adapters,omitempty"`   // (optional) file names to blob digests of LoRA adapters
+	Template   string                       `json:"template,omitempty"`   // (optional) prompt template
+	License    []string                     `json:"license,omitempty"`    // (optional) license(s) of the model
+	System     string                       `json:"system,omitempty"`     // (optional) system prompt
+	Parameters map[string]any               `json:"parameters,omitempty"` // (optional) model parameters, see RequestOptions
+	Messages   []ChatMessage                `json:"messages,omitempty"`   // (optional) messages to seed the conversation with
+	Quantize   string                       `json:"quantize,omitempty"`   // (optional) quantization type, e.g. q4_K_M
+	OnProgress func(ProgressResponse) error `json:"-"`
+}
+
+// CopyRequest is a request to the /api/copy endpoint.
+type CopyRequest struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+}
+
+// DeleteRequest is a request to the /api/delete endpoint.
+type DeleteRequest struct {
+	Model string `json:"model"`
+}
+
+// VersionResponse is the response from /api/version.
+type VersionResponse struct {
+	Version string `json:"version"`
+}
+
+// Tags returns the list of installed models.
+// The request goes to the "tags" endpoint, see EndpointURL; BackendOpenAI lists the "models" endpoint.
+func (c *Client) Tags() (*ListResponse, error) {
+	return c.TagsContext(context.Background())
+}
+
+// TagsContext is like Tags but aborts the request when ctx is done.
+func (c *Client) TagsContext(ctx context.Context) (*ListResponse, error) {
+	if c.ds.Backend == BackendOpenAI {
+		return c.openAIModels(ctx)
+	}
+	var list ListResponse
+	if err := c.doJSON(ctx, "tags", "GET", c.EndpointURL("tags"), nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// Show returns the details of a model.
+func (c *Client) Show(request ShowRequest) (*ShowResponse, error) {
+	return c.ShowContext(context.Background(), request)
+}
+
+// ShowContext is like Show but aborts the request when ctx is done.
+func (c *Client) ShowContext(ctx context.Context, request ShowRequest) (*ShowResponse, error) {
+	if err := c.supports("show"); err != nil {
+		return nil, err
+	}
+	var show ShowResponse
+	if err := c.doJSON(ctx, "show", "POST", c.EndpointURL("show"), request, &show); err != nil {
+		return nil, err
+	}
+	return &show, nil
+}
+
+// Pull downloads a model from the library, reporting progress through OnProgress.
+func (c *Client) Pull(request PullRequest) error {
+	return c.PullContext(context.Background(), request)
+}
+
+// PullContext is like Pull but aborts the download when ctx is done.
+func (c *Client) PullContext(ctx context.Context, request PullRequest) error {
+	return c.progress(ctx, "pull", request, request.OnProgress)
+}
+
+// Push uploads a model to the library, reporting progress through OnProgress.
+func (c *Client) Push(request PushRequest) error {
+	return c.PushContext(context.Background(), request)
+}
+
+// PushContext is like Push but aborts the upload when ctx is done.
+func (c *Client) PushContext(ctx context.Context, request PushRequest) error {
+	return c.progress(ctx, "push", request, request.OnProgress)
+}
+
+// Create creates a model, reporting progress through OnProgress.
+func (c *Client) Create(request CreateRequest) error {
+	return c.CreateContext(context.Background(), request)
+}
+
+// CreateContext is like Create but aborts the request when ctx is done.
+func (c *Client) CreateContext(ctx context.Context, request CreateRequest) error {
+	return c.progress(ctx, "create", request, request.OnProgress)
+}
+
+// Copy creates a copy of a model under another name.
+func (c *Client) Copy(request CopyRequest) error {
+	return c.CopyContext(context.Background(), request)
+}
+
+// CopyContext is like Copy but aborts the request when ctx is done.
+func (c *Client) CopyContext(ctx context.Context, request CopyRequest) error {
+	if err := c.supports("copy"); err != nil {
+		return err
+	}
+	return c.doJSON(ctx, "copy", "POST", c.EndpointURL("copy"), request, nil)
+}
+
+// Delete removes a model and its data.
+func (c *Client) Delete(request DeleteRequest) error {
+	return c.DeleteContext(context.Background(), request)
+}
+
+// DeleteContext is like Delete but aborts the request when ctx is done.
+func (c *Client) DeleteContext(ctx context.Context, request DeleteRequest) error {
+	if err := c.supports("delete"); err != nil {
+		return err
+	}
+	return c.doJSON(ctx, "delete", "DELETE", c.EndpointURL("delete"), request, nil)
+}
+
+// Version returns the version of the Ollama server.
+func (c *Client) Version() (*VersionResponse, error) {
+	return c.VersionContext(context.Background())
+}
+
+// VersionContext is like Version but aborts the request when ctx is done.
+func (c *Client) VersionContext(ctx context.Context) (*VersionResponse, error) {
+	if err := c.supports("version"); err != nil {
+		return nil, err
+	}
+	var version VersionResponse
+	if err := c.doJSON(ctx, "version", "GET", c.EndpointURL("version"), nil, &version); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// progress streams the status lines of the named endpoint to onProgress.
+func (c *Client) progress(ctx context.Context, name string, request any, onProgress func(ProgressResponse) error) error {
+	if err := c.supports(name); err != nil {
+		return err
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s request: %w", name, err)
+	}
+	return c.stream(ctx, name, c.EndpointURL(name), string(body), func(line []byte) error {
+		var res ProgressResponse
+		if err := json.Unmarshal(line, &res); err != nil {
+			return fmt.Errorf("failed to unmarshal %s response: %w", name, err)
+		}
+		if onProgress != nil {
+			if err := onProgress(res); err != nil {
+				return fmt.Errorf("failed to process %s progress: %w", name, err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,102 @@
+package ollama
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTags_ListsModels(t *testing.T) {
+	var gotPath, gotMethod string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotMethod = r.URL.Path, r.Method
+		fmt.Fprint(w, `{"models":[{"name":"gemma3:1b","model":"gemma3:1b","size":815319791,"digest":"abc","details":{"family":"gemma3","parameter_size":"999.89M"}}]}`)
+	}))
+	defer srv.Close()
+
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/ollama/api/generate"})
+	list, err := client.Tags()
+	if err != nil {
+		t.Fatalf("Tags error: %v", err)
+	}
+	if gotMethod != "GET" || gotPath != "/ollama/api/tags" {
+		t.Errorf("request = %s %s, want GET /ollama/api/tags", gotMethod, gotPath)
+	}
+	if len(list.Models) != 1 || list.Models[0].Name != "gemma3:1b" || list.Models[0].Details.Family != "gemma3" {
+		t.Errorf("models = %+v", list.Models)
+	}
+}
+
+func TestPull_ReportsProgress(t *testing.T) {
+	var got PullRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/pull" {
+			t.Errorf("path = %q, want /api/pull", r.URL.Path)
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		fmt.Fprint(w, `{"status":"pulling manifest"}`+"\n")
+		fmt.Fprint(w, `{"status":"downloading","digest":"sha256:1","total":100,"completed":40}`+"\n")
+		fmt.Fprint(w, `{"status":"downloading","digest":"sha256:1","total":100,"completed":100}`+"\n")
+		fmt.Fprint(w, `{"status":"success"}`+"\n")
+	}))
+	defer srv.Close()
+
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"})
+
+	var updates []ProgressResponse
+	err := client.Pull(PullRequest{
+		Model: "gemma3:1b",
+		OnProgress: func(p ProgressResponse) error {
+			updates = append(updates, p)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Pull error: %v", err)
+	}
+	if got.Model != "gemma3:1b" {
+		t.Errorf("server got model %q", got.Model)
+	}
+	if len(updates) != 4 {
+		t.Fatalf("got %d progress updates, want 4", len(updates))
+	}
+	if updates[1].Digest != "sha256:1" || updates[1].Total != 100 || updates[1].Completed != 40 {
+		t.Errorf("progress = %+v", updates[1])
+	}
+	if updates[3].Status != "success" {
+		t.Errorf("last status = %q, want success", updates[3].Status)
+	}
+}
+
+func TestCopyDeleteVersion(t *testing.T) {
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		if r.URL.Path == "/api/version" {
+			fmt.Fprint(w, `{"version":"0.9.0"}`)
+		}
+	}))
+	defer srv.Close()
+
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"})
+	if err := client.Copy(CopyRequest{Source: "a", Destination: "b"}); err != nil {
+		t.Fatalf("Copy error: %v", err)
+	}
+	if err := client.Delete(DeleteRequest{Model: "b"}); err != nil {
+		t.Fatalf("Delete error: %v", err)
+	}
+	v, err := client.Version()
+	if err != nil {
+		t.Fatalf("Version error: %v", err)
+	}
+	if v.Version != "0.9.0" {
+		t.Errorf("version = %q", v.Version)
+	}
+
+	want := []string{"POST /api/copy", "DELETE /api/delete", "GET /api/version"}
+	if fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
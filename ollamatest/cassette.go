@@ -0,0 +1,130 @@
+// Package ollamatest helps testing code that uses the ollama client without a live model.
+//
+// Server is an in-process fake Ollama / Open WebUI server with scripted, deterministic
+// models, hash-based embeddings and fault injection:
+//
+//	srv := ollamatest.NewServer()
+//	defer srv.Close()
+//	srv.AddModel("llama3", ollamatest.Canned("Hello!"))
+//	client := ollama.NewOpenWebUiClient(&ollama.DSN{URL: srv.GenerateURL()})
+//
+// A Recorder captures the HTTP interactions of a client with a real Ollama or
+// Open WebUI instance, including the timing of the streamed chunks, into a
+// cassette file; a Replayer serves them again offline. Both are http.RoundTrippers,
+// plugged into a client with ollama.WithHTTPClient:
+//
+//	rec := ollamatest.NewRecorder(nil)
+//	client := ollama.NewOpenWebUiClient(dsn, ollama.WithHTTPClient(&http.Client{Transport: rec}))
+//	// ... use the client ...
+//	err := rec.Save("testdata/hello.json")
+//
+//	cassette, err := ollamatest.LoadCassette("testdata/hello.json")
+//	client := ollama.NewOpenWebUiClient(dsn, ollama.WithHTTPClient(&http.Client{Transport: ollamatest.NewReplayer(cassette)}))
+package ollamatest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+)
+
+// Cassette is a recorded sequence of HTTP interactions
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is a request and the response it got
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a recorded HTTP request, with the scrubbed headers redacted
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// RecordedResponse is a recorded HTTP response, its body split into the chunks it arrived in
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Chunks     []Chunk     `json:"chunks"`
+}
+
+// Body returns the whole response body
+func (r RecordedResponse) Body() string {
+	var b bytes.Buffer
+	for _, c := range r.Chunks {
+		b.WriteString(c.Data)
+	}
+	return b.String()
+}
+
+// Chunk is a piece of a response body with the time it arrived, relative to the start of the request
+type Chunk struct {
+	Offset time.Duration `json:"offset"`
+	Data   string        `json:"data"`
+}
+
+// LoadCassette reads a cassette written by Save
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to decode cassette %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Save writes the cassette to path as indented JSON, creating its directory if needed
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// Matcher reports whether a recorded request answers req, whose body has already been read into body
+type Matcher func(req *http.Request, body []byte, recorded RecordedRequest) bool
+
+// DefaultMatcher matches the method, the URL path and query, and the body.
+// The host is ignored, so a cassette recorded against one server replays for any other.
+// JSON bodies match if they decode to the same value, regardless of key order and spacing.
+func DefaultMatcher(req *http.Request, body []byte, recorded RecordedRequest) bool {
+	if req.Method != recorded.Method {
+		return false
+	}
+	u, err := url.Parse(recorded.URL)
+	if err != nil || u.Path != req.URL.Path || u.Query().Encode() != req.URL.Query().Encode() {
+		return false
+	}
+	return sameBody(body, []byte(recorded.Body))
+}
+
+// sameBody compares JSON bodies by value and other bodies by bytes
+func sameBody(a, b []byte) bool {
+	var va, vb any
+	if json.Unmarshal(a, &va) == nil && json.Unmarshal(b, &vb) == nil {
+		return reflect.DeepEqual(va, vb)
+	}
+	return bytes.Equal(a, b)
+}
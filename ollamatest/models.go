@@ -0,0 +1,108 @@
+package ollamatest
+
+import (
+	"hash/fnv"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Model is a scripted, deterministic model of a fake Server
+type Model interface {
+	// Reply returns the answer to prompt, the last user message for chat requests
+	Reply(prompt string) string
+}
+
+// ModelFunc adapts a function to a Model
+type ModelFunc func(prompt string) string
+
+// Reply implements Model
+func (f ModelFunc) Reply(prompt string) string {
+	return f(prompt)
+}
+
+// Echo returns a Model answering with the prompt itself
+func Echo() Model {
+	return ModelFunc(func(prompt string) string { return prompt })
+}
+
+// Canned returns a Model answering with the given answers in turn, starting over after the last one
+func Canned(answers ...string) Model {
+	return &cannedModel{answers: answers}
+}
+
+type cannedModel struct {
+	mu      sync.Mutex
+	answers []string
+	next    int
+}
+
+func (m *cannedModel) Reply(string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.answers) == 0 {
+		return ""
+	}
+	answer := m.answers[m.next%len(m.answers)]
+	m.next++
+	return answer
+}
+
+// Rule answers prompts matching Pattern with Reply, in which $1, ${name}
+// and so on are replaced by the submatches as in regexp.Regexp.Expand
+type Rule struct {
+	Pattern *regexp.Regexp
+	Reply   string
+}
+
+// Rules returns a Model answering with the first rule matching the prompt, or with fallback
+//
+//	ollamatest.Rules("I don't know.",
+//		ollamatest.Rule{Pattern: regexp.MustCompile(`(?i)capital of (\w+)`), Reply: "The capital of $1 is ..."},
+//	)
+func Rules(fallback string, rules ...Rule) Model {
+	return ModelFunc(func(prompt string) string {
+		for _, rule := range rules {
+			if match := rule.Pattern.FindStringSubmatchIndex(prompt); match != nil {
+				return string(rule.Pattern.ExpandString(nil, rule.Reply, prompt, match))
+			}
+		}
+		return fallback
+	})
+}
+
+// HashEmbedding returns a deterministic, normalized embedding of text with dim dimensions.
+// Each lower-cased word is hashed to a dimension and sign, so texts sharing words are similar
+// and identical texts are identical; text without words gets the zero vector.
+func HashEmbedding(text string, dim int) []float64 {
+	if dim <= 0 {
+		return nil
+	}
+	embedding := make([]float64, dim)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		h := fnv.New64a()
+		h.Write([]byte(word))
+		sum := h.Sum64()
+		sign := 1.0
+		if sum&(1<<63) != 0 {
+			sign = -1
+		}
+		embedding[sum%uint64(dim)] += sign
+	}
+
+	var norm float64
+	for _, v := range embedding {
+		norm += v * v
+	}
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for i := range embedding {
+			embedding[i] /= norm
+		}
+	}
+	return embedding
+}
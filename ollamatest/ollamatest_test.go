@@ -0,0 +1,388 @@
+package ollamatest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eslider/go-ollama"
+)
+
+// streamingServer streams three tokens, 20ms apart, and a final done line
+func streamingServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/ps" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"error":"loading"}`)
+			return
+		}
+		w.Header().Set("Set-Cookie", "session=secret-session")
+		for _, tok := range []string{"one ", "two ", "three"} {
+			fmt.Fprintf(w, `{"model":"m","response":%q,"done":false}`+"\n", tok)
+			w.(http.Flusher).Flush()
+			time.Sleep(20 * time.Millisecond)
+		}
+		fmt.Fprint(w, `{"model":"m","response":"","done":true,"eval_count":3}`+"\n")
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func query(t *testing.T, client *ollama.Client, prompt string) string {
+	t.Helper()
+	var text strings.Builder
+	err := client.Query(ollama.Request{Model: "m", Prompt: prompt, OnJson: func(res ollama.Response) error {
+		text.WriteString(*res.Response)
+		return nil
+	}})
+	if err != nil {
+		t.Fatalf("Query error: %v", err)
+	}
+	return text.String()
+}
+
+func recordCassette(t *testing.T) string {
+	t.Helper()
+	srv := streamingServer(t)
+	rec := NewRecorder(nil)
+	client := ollama.NewOpenWebUiClient(&ollama.DSN{URL: srv.URL + "/api/generate", Token: "sk-secret-token"},
+		ollama.WithHTTPClient(&http.Client{Transport: rec}))
+
+	if got := query(t, client, "count"); got != "one two three" {
+		t.Fatalf("live answer = %q", got)
+	}
+	if _, err := client.Ps(); err == nil {
+		t.Fatal("expected the ps error")
+	}
+	path := filepath.Join(t.TempDir(), "cassettes", "count.json")
+	if err := rec.Save(path); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+	return path
+}
+
+func TestRecorder_CapturesChunksAndScrubsSecrets(t *testing.T) {
+	path := recordCassette(t)
+
+	data, _ := os.ReadFile(path)
+	for _, secret := range []string{"sk-secret-token", "secret-session"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("cassette contains %q", secret)
+		}
+	}
+
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		t.Fatalf("LoadCassette error: %v", err)
+	}
+	if len(cassette.Interactions) != 2 {
+		t.Fatalf("got %d interactions, want 2", len(cassette.Interactions))
+	}
+	generate := cassette.Interactions[0]
+	if generate.Request.Header.Get("Authorization") != Redacted || !strings.Contains(generate.Request.Body, `"prompt":"count"`) {
+		t.Errorf("request = %+v", generate.Request)
+	}
+	chunks := generate.Response.Chunks
+	if len(chunks) < 3 || chunks[len(chunks)-1].Offset < 40*time.Millisecond {
+		t.Errorf("chunks = %+v, want the streamed pieces with their timing", chunks)
+	}
+	if !strings.Contains(generate.Response.Body(), `"done":true`) {
+		t.Errorf("body = %q", generate.Response.Body())
+	}
+}
+
+func TestReplayer_ServesOfflineWithTiming(t *testing.T) {
+	cassette, err := LoadCassette(recordCassette(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		timing   float64
+		min, max time.Duration
+	}{
+		{0, 0, 30 * time.Millisecond},
+		{1, 35 * time.Millisecond, time.Second},
+	} {
+		replayer := &Replayer{Cassette: cassette, Timing: tc.timing}
+		// Another host: only the path and the body are matched
+		client := ollama.NewOpenWebUiClient(&ollama.DSN{URL: "http://offline.invalid/api/generate"},
+			ollama.WithHTTPClient(&http.Client{Transport: replayer}))
+
+		start := time.Now()
+		if got := query(t, client, "count"); got != "one two three" {
+			t.Errorf("timing %v: replayed %q", tc.timing, got)
+		}
+		if elapsed := time.Since(start); elapsed < tc.min || elapsed > tc.max {
+			t.Errorf("timing %v: replay took %v, want %v-%v", tc.timing, elapsed, tc.min, tc.max)
+		}
+
+		var apiErr *ollama.APIError
+		if _, err := client.Ps(); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable || apiErr.Message != "loading" {
+			t.Errorf("ps err = %v, want the recorded 503", err)
+		}
+	}
+}
+
+func TestReplayer_UnmatchedRequestFails(t *testing.T) {
+	cassette, err := LoadCassette(recordCassette(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := ollama.NewOpenWebUiClient(&ollama.DSN{URL: "http://offline.invalid/api/generate"},
+		ollama.WithHTTPClient(&http.Client{Transport: NewReplayer(cassette)}))
+	err = client.Query(ollama.Request{Model: "m", Prompt: "something else"})
+	if err == nil || !strings.Contains(err.Error(), "no recorded interaction for POST /api/generate") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestReplayer_RepeatedRequestsInOrder(t *testing.T) {
+	answer := func(text string) *Interaction {
+		return &Interaction{
+			Request:  RecordedRequest{Method: "POST", URL: "http://host/api/generate", Body: `{"model":"m","prompt":"next"}`},
+			Response: RecordedResponse{StatusCode: 200, Chunks: []Chunk{{Data: fmt.Sprintf(`{"response":%q,"done":true}`+"\n", text)}}},
+		}
+	}
+	replayer := NewReplayer(&Cassette{Interactions: []*Interaction{answer("first"), answer("second")}})
+	client := ollama.NewOpenWebUiClient(&ollama.DSN{URL: "http://other/api/generate"},
+		ollama.WithHTTPClient(&http.Client{Transport: replayer}))
+
+	for _, want := range []string{"first", "second", "second"} {
+		if got := query(t, client, "next"); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestDefaultMatcher(t *testing.T) {
+	recorded := RecordedRequest{Method: "POST", URL: "http://a:1/api/embed?x=1", Body: `{"model":"m","input":["a"]}`}
+	for _, tc := range []struct {
+		method, url, body string
+		want              bool
+	}{
+		{"POST", "http://b:2/api/embed?x=1", `{ "input": ["a"], "model": "m" }`, true},
+		{"GET", "http://b:2/api/embed?x=1", `{"model":"m","input":["a"]}`, false},
+		{"POST", "http://b:2/api/embed", `{"model":"m","input":["a"]}`, false},
+		{"POST", "http://b:2/api/embed?x=1", `{"model":"m","input":["b"]}`, false},
+	} {
+		req, _ := http.NewRequestWithContext(context.Background(), tc.method, tc.url, nil)
+		if got := DefaultMatcher(req, []byte(tc.body), recorded); got != tc.want {
+			t.Errorf("%s %s %s: got %v", tc.method, tc.url, tc.body, got)
+		}
+	}
+}
+
+func TestServer_GenerateStreamsWordByWord(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.AddModel("m", Canned("Hello there, friend!", "Bye."))
+	client := ollama.NewOpenWebUiClient(&ollama.DSN{URL: srv.GenerateURL()})
+
+	var pieces []string
+	var final ollama.Response
+	err := client.Query(ollama.Request{Model: "m:latest", Prompt: "hi you", OnJson: func(res ollama.Response) error {
+		if *res.Done {
+			final = res
+		} else {
+			pieces = append(pieces, *res.Response)
+		}
+		return nil
+	}})
+	if err != nil {
+		t.Fatalf("Query error: %v", err)
+	}
+	if strings.Join(pieces, "|") != "Hello |there, |friend!" {
+		t.Errorf("pieces = %q", pieces)
+	}
+	if final.EvalCount == nil || *final.EvalCount != 3 || *final.PromptEvalCount != 2 || *final.DoneReason != "stop" {
+		t.Errorf("final = %+v", final)
+	}
+	// Canned answers come in turn
+	if got := query(t, client, "again"); got != "Bye." {
+		t.Errorf("second answer = %q", got)
+	}
+	if reqs := srv.Requests(); len(reqs) != 2 || !strings.Contains(reqs[0].Body, `"prompt":"hi you"`) {
+		t.Errorf("requests = %+v", reqs)
+	}
+}
+
+func TestServer_ModelsAndChunking(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.TokenSize = 2
+	srv.AddModel("echo", Echo())
+	srv.AddModel("geo", Rules("I don't know.",
+		Rule{Pattern: regexp.MustCompile(`(?i)capital of (\w+)`), Reply: "The capital of $1 is nice."},
+	))
+	client := ollama.NewOpenWebUiClient(&ollama.DSN{URL: srv.GenerateURL()})
+
+	var pieces []string
+	_ = client.Query(ollama.Request{Model: "echo", Prompt: "héllo", OnJson: func(res ollama.Response) error {
+		pieces = append(pieces, *res.Response)
+		return nil
+	}})
+	if strings.Join(pieces, "|") != "hé|ll|o|" {
+		t.Errorf("pieces = %q, want 2 runes each", pieces)
+	}
+
+	for prompt, want := range map[string]string{"What is the capital of France?": "The capital of France is nice.", "Why?": "I don't know."} {
+		var text strings.Builder
+		_ = client.Query(ollama.Request{Model: "geo", Prompt: prompt, OnJson: func(res ollama.Response) error {
+			text.WriteString(*res.Response)
+			return nil
+		}})
+		if text.String() != want {
+			t.Errorf("%q answered %q, want %q", prompt, text.String(), want)
+		}
+	}
+
+	if err := client.Query(ollama.Request{Model: "missing", Prompt: "p"}); !errors.Is(err, ollama.ErrModelNotFound) {
+		t.Errorf("err = %v, want ErrModelNotFound", err)
+	}
+}
+
+func TestServer_ChatEmbedPsTags(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.ContextLength = 8192
+	srv.AddModel("m", Echo())
+	srv.AddModel("nomic-embed-text", nil)
+	client := ollama.NewOpenWebUiClient(&ollama.DSN{URL: srv.GenerateURL()})
+	ctx := context.Background()
+
+	var reply strings.Builder
+	err := client.ChatContext(ctx, ollama.ChatRequest{
+		Model:    "m",
+		Messages: []ollama.ChatMessage{{Role: ollama.RoleSystem, Content: "Be nice."}, {Role: ollama.RoleUser, Content: "Say it back"}},
+		OnJson: func(res ollama.ChatResponse) error {
+			reply.WriteString(res.Message.Content)
+			return nil
+		},
+	})
+	if err != nil || reply.String() != "Say it back" {
+		t.Errorf("chat = %q, %v", reply.String(), err)
+	}
+
+	res, err := client.EmbedContext(ctx, ollama.EmbedRequest{Model: "nomic-embed-text", Input: []string{"the red car", "a red car", "quantum physics", "the red car"}})
+	if err != nil {
+		t.Fatalf("Embed error: %v", err)
+	}
+	e := res.Embeddings
+	if len(e) != 4 || len(e[0]) != DefaultEmbedDim || !slices.Equal(e[0], e[3]) {
+		t.Fatalf("embeddings = %v", e)
+	}
+	if dot(e[0], e[1]) <= dot(e[0], e[2]) {
+		t.Errorf("texts sharing words are not closer: %v vs %v", dot(e[0], e[1]), dot(e[0], e[2]))
+	}
+	if err := client.Query(ollama.Request{Model: "nomic-embed-text", Prompt: "p"}); err == nil {
+		t.Error("expected error generating with an embedding model")
+	}
+
+	ps, err := client.PsContext(ctx)
+	if err != nil || len(ps.Models) != 2 || ps.Models[0].Name != "m" || ps.Models[0].ContextLength != 8192 {
+		t.Errorf("ps = %+v, %v", ps, err)
+	}
+	tags, err := client.TagsContext(ctx)
+	if err != nil || len(tags.Models) != 2 || tags.Models[1].Name != "nomic-embed-text" {
+		t.Errorf("tags = %+v, %v", tags, err)
+	}
+}
+
+func dot(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+func TestServer_AuthAndOpenWebUIPrefix(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.Token = "sk-good"
+	srv.AddModel("m", Echo())
+	srv.Fail("generate", Fault{Status: http.StatusInternalServerError, Message: "boom"})
+
+	bad := ollama.NewOpenWebUiClient(&ollama.DSN{URL: srv.URL + "/ollama/api/generate", Token: "sk-bad"})
+	if err := bad.Query(ollama.Request{Model: "m", Prompt: "p"}); !errors.Is(err, ollama.ErrUnauthorized) {
+		t.Errorf("err = %v, want ErrUnauthorized", err)
+	}
+	// The rejected request left the fault to the authenticated one
+	good := ollama.NewOpenWebUiClient(&ollama.DSN{URL: srv.URL + "/ollama/api/generate", Token: "sk-good"})
+	var apiErr *ollama.APIError
+	if err := good.Query(ollama.Request{Model: "m", Prompt: "p"}); !errors.As(err, &apiErr) || apiErr.Message != "boom" {
+		t.Errorf("err = %v, want the scripted fault", err)
+	}
+	if got := query(t, good, "hello"); got != "hello" {
+		t.Errorf("answer = %q", got)
+	}
+}
+
+func TestServer_Faults(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.AddModel("m", Canned("one two three four"))
+	client := ollama.NewOpenWebUiClient(&ollama.DSN{URL: srv.GenerateURL()})
+
+	srv.Fail("generate",
+		Fault{Status: http.StatusInternalServerError, Message: "boom"},
+		Fault{Disconnect: true, After: 2},
+		Fault{Malformed: true, After: 1},
+		Fault{StreamError: true, After: 1, Message: "out of memory"},
+	)
+	var apiErr *ollama.APIError
+	if err := client.Query(ollama.Request{Model: "m"}); !errors.As(err, &apiErr) || apiErr.StatusCode != 500 || apiErr.Message != "boom" {
+		t.Errorf("500 fault: err = %v", err)
+	}
+
+	var pieces int
+	err := client.Query(ollama.Request{Model: "m", OnJson: func(ollama.Response) error {
+		pieces++
+		return nil
+	}})
+	if err == nil || pieces != 2 {
+		t.Errorf("disconnect fault: err = %v after %d pieces, want an error after 2", err, pieces)
+	}
+	if err := client.Query(ollama.Request{Model: "m"}); err == nil || !strings.Contains(err.Error(), "unmarshal") {
+		t.Errorf("malformed fault: err = %v", err)
+	}
+	if err := client.Query(ollama.Request{Model: "m"}); !errors.As(err, &apiErr) || apiErr.Message != "out of memory" {
+		t.Errorf("stream error fault: err = %v", err)
+	}
+	if got := query(t, client, "p"); got != "one two three four" {
+		t.Errorf("after the faults: %q", got)
+	}
+
+	// A slow first byte runs into the caller's deadline
+	srv.Fail("ps", Fault{FirstByteDelay: time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.PsContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("slow fault: err = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestServer_TokenDelay(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.TokenDelay = 10 * time.Millisecond
+	srv.AddModel("m", Canned("a b c d e"))
+	client := ollama.NewOpenWebUiClient(&ollama.DSN{URL: srv.GenerateURL()})
+
+	start := time.Now()
+	query(t, client, "p")
+	if elapsed := time.Since(start); elapsed < 45*time.Millisecond {
+		t.Errorf("5 tokens took %v, want at least 50ms", elapsed)
+	}
+}
@@ -0,0 +1,132 @@
+package ollamatest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Redacted replaces the values of scrubbed headers in a cassette
+const Redacted = "REDACTED"
+
+// DefaultScrub are the headers a Recorder redacts when Scrub is nil
+var DefaultScrub = []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization"}
+
+// Recorder is an http.RoundTripper that forwards requests to Transport and records
+// the interactions. Response bodies are recorded as they are read, chunk by chunk,
+// so a streamed answer replays with its original pace. Safe for concurrent use.
+type Recorder struct {
+	Transport http.RoundTripper // Sends the requests; http.DefaultTransport if nil
+	Scrub     []string          // Request and response headers to redact; DefaultScrub if nil
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewRecorder creates a Recorder sending requests through transport, http.DefaultTransport if nil
+func NewRecorder(transport http.RoundTripper) *Recorder {
+	return &Recorder{Transport: transport}
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	start := time.Now()
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	interaction := &Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: r.scrub(req.Header),
+			Body:   string(body),
+		},
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     r.scrub(resp.Header),
+			Chunks:     []Chunk{},
+		},
+	}
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.mu.Unlock()
+
+	resp.Body = &recordingBody{body: resp.Body, start: start, recorder: r, response: &interaction.Response}
+	return resp, nil
+}
+
+// Cassette returns a copy of the interactions recorded so far.
+// Bodies still being read are included up to where they are.
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := &Cassette{}
+	for _, in := range r.cassette.Interactions {
+		copied := *in
+		copied.Response.Chunks = slices.Clone(in.Response.Chunks)
+		c.Interactions = append(c.Interactions, &copied)
+	}
+	return c
+}
+
+// Save writes the interactions recorded so far to a cassette file, see Cassette.Save
+func (r *Recorder) Save(path string) error {
+	return r.Cassette().Save(path)
+}
+
+// scrub returns a copy of header with the scrubbed headers redacted
+func (r *Recorder) scrub(header http.Header) http.Header {
+	scrub := r.Scrub
+	if scrub == nil {
+		scrub = DefaultScrub
+	}
+	header = header.Clone()
+	for _, name := range scrub {
+		if values := header.Values(name); len(values) > 0 {
+			header[http.CanonicalHeaderKey(name)] = []string{Redacted}
+		}
+	}
+	return header
+}
+
+// recordingBody records the chunks of a response body as they are read
+type recordingBody struct {
+	body     io.ReadCloser
+	start    time.Time
+	recorder *Recorder
+	response *RecordedResponse
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if n > 0 {
+		b.recorder.mu.Lock()
+		b.response.Chunks = append(b.response.Chunks, Chunk{Offset: time.Since(b.start), Data: string(p[:n])})
+		b.recorder.mu.Unlock()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	return b.body.Close()
+}
@@ -0,0 +1,133 @@
+package ollamatest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Replayer is an http.RoundTripper serving the responses of a cassette without a server.
+// A request is answered by the first matching interaction not replayed yet, or by the
+// last matching one once all were replayed. Safe for concurrent use.
+type Replayer struct {
+	Cassette *Cassette
+	Match    Matcher // Finds the interaction for a request; DefaultMatcher if nil
+	Timing   float64 // Replays the chunks at their recorded offsets scaled by Timing, 1 is the original pace; 0 serves them at once
+
+	mu   sync.Mutex
+	used map[*Interaction]bool
+}
+
+// NewReplayer creates a Replayer serving the interactions of cassette at once
+func NewReplayer(cassette *Cassette) *Replayer {
+	return &Replayer{Cassette: cassette}
+}
+
+// RoundTrip implements http.RoundTripper. A request without a recorded interaction fails with an error naming it.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+
+	interaction := r.find(req, body)
+	if interaction == nil {
+		return nil, fmt.Errorf("ollamatest: no recorded interaction for %s %s", req.Method, req.URL.RequestURI())
+	}
+
+	recorded := interaction.Response
+	header := recorded.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(recorded.StatusCode) + " " + http.StatusText(recorded.StatusCode),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          &replayBody{ctx: req.Context(), chunks: recorded.Chunks, start: time.Now(), timing: r.Timing},
+		ContentLength: -1,
+		Request:       req,
+	}, nil
+}
+
+// find returns the interaction answering req and marks it replayed
+func (r *Replayer) find(req *http.Request, body []byte) *Interaction {
+	match := r.Match
+	if match == nil {
+		match = DefaultMatcher
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.used == nil {
+		r.used = map[*Interaction]bool{}
+	}
+
+	var last *Interaction
+	for _, in := range r.Cassette.Interactions {
+		if !match(req, body, in.Request) {
+			continue
+		}
+		if !r.used[in] {
+			r.used[in] = true
+			return in
+		}
+		last = in
+	}
+	return last
+}
+
+// replayBody serves recorded chunks, waiting for their offsets if timing is positive
+type replayBody struct {
+	ctx    context.Context
+	chunks []Chunk
+	start  time.Time
+	timing float64
+	buf    *bytes.Reader
+}
+
+func (b *replayBody) Read(p []byte) (int, error) {
+	for b.buf == nil || b.buf.Len() == 0 {
+		if len(b.chunks) == 0 {
+			return 0, io.EOF
+		}
+		chunk := b.chunks[0]
+		b.chunks = b.chunks[1:]
+		if err := wait(b.ctx, time.Until(b.start.Add(time.Duration(float64(chunk.Offset)*b.timing)))); err != nil {
+			return 0, err
+		}
+		b.buf = bytes.NewReader([]byte(chunk.Data))
+	}
+	return b.buf.Read(p)
+}
+
+func (b *replayBody) Close() error {
+	b.chunks = nil
+	return nil
+}
+
+// wait waits for d or until ctx is done
+func wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,459 @@
+package ollamatest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultEmbedDim is the dimension of the embeddings of a Server
+const DefaultEmbedDim = 16
+
+// DefaultContextLength is the context length a Server reports for its models
+const DefaultContextLength = 4096
+
+// Fault makes a Server misbehave on one request, see Server.Fail
+type Fault struct {
+	Status         int           // Respond with this status and an {"error": Message} body instead of answering
+	Message        string        // Error message; "injected fault" if empty
+	FirstByteDelay time.Duration // Wait this long before responding
+	After          int           // Chunks streamed before Disconnect, Malformed or StreamError strike
+	Disconnect     bool          // Drop the connection mid-stream, without the final chunk
+	Malformed      bool          // Send a line of broken JSON and end the stream
+	StreamError    bool          // Send an {"error": Message} line and end the stream, as Ollama does for late errors
+}
+
+func (f Fault) message() string {
+	if f.Message == "" {
+		return "injected fault"
+	}
+	return f.Message
+}
+
+// Server is an in-process fake Ollama / Open WebUI server with scripted models.
+// It serves /api/generate, /api/chat, /api/embed, /api/ps and /api/tags, also below a
+// prefix such as Open WebUI's /ollama/api/..., streaming answers chunk by chunk.
+// Set the fields before sending requests.
+//
+//	srv := ollamatest.NewServer()
+//	defer srv.Close()
+//	srv.AddModel("llama3", ollamatest.Canned("Hello!"))
+//	client := ollama.NewOpenWebUiClient(&ollama.DSN{URL: srv.GenerateURL()})
+type Server struct {
+	*httptest.Server
+	Token         string        // Bearer token required by every request; empty accepts any
+	TokenSize     int           // Runes per streamed chunk; 0 streams word by word
+	TokenDelay    time.Duration // Pause before each streamed chunk
+	EmbedDim      int           // Dimension of the embeddings, see HashEmbedding
+	ContextLength int           // Context length reported by /api/ps
+
+	mu       sync.Mutex
+	models   map[string]Model
+	faults   map[string][]Fault
+	requests []RecordedRequest
+}
+
+// NewServer starts a Server without models. The caller must Close it.
+func NewServer() *Server {
+	s := &Server{
+		EmbedDim:      DefaultEmbedDim,
+		ContextLength: DefaultContextLength,
+		models:        map[string]Model{},
+		faults:        map[string][]Fault{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// GenerateURL returns the URL of the generate endpoint, for ollama.DSN
+func (s *Server) GenerateURL() string {
+	return s.URL + "/api/generate"
+}
+
+// AddModel adds or replaces a model. A nil model can only embed.
+func (s *Server) AddModel(name string, model Model) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.models[name] = model
+}
+
+// Fail makes the next requests to endpoint ("generate", "chat", "embed", "ps" or "tags")
+// misbehave, one fault per request in the given order
+func (s *Server) Fail(endpoint string, faults ...Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[endpoint] = append(s.faults[endpoint], faults...)
+}
+
+// Requests returns the requests received so far
+func (s *Server) Requests() []RecordedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.requests)
+}
+
+// model looks up a model by name, with or without the ":latest" tag
+func (s *Server) model(name string) (Model, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m, ok := s.models[name]; ok {
+		return m, true
+	}
+	m, ok := s.models[strings.TrimSuffix(name, ":latest")]
+	return m, ok
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	i := strings.Index(r.URL.Path, "/api/")
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	endpoint := r.URL.Path[i+len("/api/"):]
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, RecordedRequest{Method: r.Method, URL: r.URL.String(), Header: r.Header.Clone(), Body: string(body)})
+	s.mu.Unlock()
+
+	if s.Token != "" && r.Header.Get("Authorization") != "Bearer "+s.Token {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"detail":"Not authenticated"}`)
+		return
+	}
+
+	// Rejected requests leave the faults to the next authenticated one
+	var fault Fault
+	s.mu.Lock()
+	if queue := s.faults[endpoint]; len(queue) > 0 {
+		fault, s.faults[endpoint] = queue[0], queue[1:]
+	}
+	s.mu.Unlock()
+	if wait(r.Context(), fault.FirstByteDelay) != nil {
+		return
+	}
+	if fault.Status != 0 {
+		writeError(w, fault.Status, fault.message())
+		return
+	}
+
+	method := http.MethodPost
+	if endpoint == "ps" || endpoint == "tags" {
+		method = http.MethodGet
+	}
+	if r.Method != method {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	switch endpoint {
+	case "generate":
+		s.generate(w, r, body, fault)
+	case "chat":
+		s.chat(w, r, body, fault)
+	case "embed":
+		s.embed(w, body)
+	case "ps":
+		s.ps(w)
+	case "tags":
+		s.tags(w)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// metrics are the final counts and durations of a generation
+type metrics struct {
+	TotalDuration   int64 `json:"total_duration,omitempty"`
+	PromptEvalCount int   `json:"prompt_eval_count,omitempty"`
+	EvalCount       int   `json:"eval_count,omitempty"`
+	EvalDuration    int64 `json:"eval_duration,omitempty"`
+}
+
+type generateChunk struct {
+	Model      string    `json:"model"`
+	CreatedAt  time.Time `json:"created_at"`
+	Response   string    `json:"response"`
+	Done       bool      `json:"done"`
+	DoneReason string    `json:"done_reason,omitempty"`
+	*metrics
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatChunk struct {
+	Model      string      `json:"model"`
+	CreatedAt  time.Time   `json:"created_at"`
+	Message    chatMessage `json:"message"`
+	Done       bool        `json:"done"`
+	DoneReason string      `json:"done_reason,omitempty"`
+	*metrics
+}
+
+func (s *Server) generate(w http.ResponseWriter, r *http.Request, body []byte, fault Fault) {
+	var req struct {
+		Model  string `json:"model"`
+		Prompt string `json:"prompt"`
+		Stream *bool  `json:"stream"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	model, ok := s.generator(w, req.Model)
+	if !ok {
+		return
+	}
+	s.stream(w, r, fault, req.Stream, req.Prompt, model.Reply(req.Prompt), func(piece string, final *metrics) any {
+		chunk := generateChunk{Model: req.Model, CreatedAt: time.Now().UTC(), Response: piece, metrics: final}
+		if final != nil {
+			chunk.Done, chunk.DoneReason = true, "stop"
+		}
+		return chunk
+	})
+}
+
+func (s *Server) chat(w http.ResponseWriter, r *http.Request, body []byte, fault Fault) {
+	var req struct {
+		Model    string        `json:"model"`
+		Messages []chatMessage `json:"messages"`
+		Stream   *bool         `json:"stream"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	model, ok := s.generator(w, req.Model)
+	if !ok {
+		return
+	}
+	prompt := ""
+	for _, m := range req.Messages {
+		if m.Role == "user" {
+			prompt = m.Content
+		}
+	}
+	s.stream(w, r, fault, req.Stream, prompt, model.Reply(prompt), func(piece string, final *metrics) any {
+		chunk := chatChunk{Model: req.Model, CreatedAt: time.Now().UTC(), Message: chatMessage{Role: "assistant", Content: piece}, metrics: final}
+		if final != nil {
+			chunk.Done, chunk.DoneReason = true, "stop"
+		}
+		return chunk
+	})
+}
+
+// generator returns the named model, or responds with an error if it is unknown or can only embed
+func (s *Server) generator(w http.ResponseWriter, name string) (Model, bool) {
+	model, ok := s.model(name)
+	switch {
+	case !ok:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("model '%s' not found", name))
+	case model == nil:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("%q does not support generate", name))
+	default:
+		return model, true
+	}
+	return nil, false
+}
+
+// stream sends answer as newline-delimited JSON chunks built by chunk, or as one object if
+// streaming is disabled, applying fault. chunk gets the metrics for the final chunk, nil otherwise.
+func (s *Server) stream(w http.ResponseWriter, r *http.Request, fault Fault, streaming *bool, prompt, answer string, chunk func(piece string, final *metrics) any) {
+	start := time.Now()
+	pieces := s.split(answer)
+	final := func() *metrics {
+		elapsed := time.Since(start).Nanoseconds()
+		return &metrics{TotalDuration: elapsed, PromptEvalCount: len(strings.Fields(prompt)), EvalCount: len(pieces), EvalDuration: elapsed}
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	if streaming != nil && !*streaming {
+		_ = enc.Encode(chunk(answer, final()))
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	for i := 0; i <= len(pieces); i++ {
+		if i == fault.After {
+			switch {
+			case fault.Disconnect:
+				flush()
+				panic(http.ErrAbortHandler) // Closes the connection without ending the chunked body
+			case fault.Malformed:
+				fmt.Fprint(w, `{"response": "broken`+"\n")
+				return
+			case fault.StreamError:
+				_ = enc.Encode(map[string]string{"error": fault.message()})
+				return
+			}
+		}
+		if i == len(pieces) {
+			_ = enc.Encode(chunk("", final()))
+			return
+		}
+		if wait(r.Context(), s.TokenDelay) != nil {
+			return
+		}
+		_ = enc.Encode(chunk(pieces[i], nil))
+		flush()
+	}
+}
+
+// split cuts text into the streamed pieces: TokenSize runes each, or words with their trailing space
+func (s *Server) split(text string) []string {
+	var pieces []string
+	if s.TokenSize > 0 {
+		for len(text) > 0 {
+			n, size := 0, 0
+			for n < s.TokenSize && size < len(text) {
+				_, width := utf8.DecodeRuneInString(text[size:])
+				size += width
+				n++
+			}
+			pieces = append(pieces, text[:size])
+			text = text[size:]
+		}
+		return pieces
+	}
+	start := 0
+	for i := 1; i < len(text); i++ {
+		if isSpace(text[i-1]) && !isSpace(text[i]) {
+			pieces = append(pieces, text[start:i])
+			start = i
+		}
+	}
+	if start < len(text) {
+		pieces = append(pieces, text[start:])
+	}
+	return pieces
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\n' || b == '\t' || b == '\r'
+}
+
+func (s *Server) embed(w http.ResponseWriter, body []byte) {
+	var req struct {
+		Model string          `json:"model"`
+		Input json.RawMessage `json:"input"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// The input is a string or a list of strings
+	var inputs []string
+	if err := json.Unmarshal(req.Input, &inputs); err != nil {
+		var input string
+		if err := json.Unmarshal(req.Input, &input); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid input")
+			return
+		}
+		inputs = []string{input}
+	}
+	if _, ok := s.model(req.Model); !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("model '%s' not found", req.Model))
+		return
+	}
+
+	embeddings := make([][]float64, len(inputs))
+	tokens := 0
+	for i, input := range inputs {
+		embeddings[i] = HashEmbedding(input, s.EmbedDim)
+		tokens += len(strings.Fields(input))
+	}
+	writeJSON(w, map[string]any{"model": req.Model, "embeddings": embeddings, "prompt_eval_count": tokens})
+}
+
+type modelDetails struct {
+	Format        string `json:"format"`
+	Family        string `json:"family"`
+	ParameterSize string `json:"parameter_size"`
+	QuantLevel    string `json:"quantization_level"`
+}
+
+var fakeDetails = modelDetails{Format: "gguf", Family: "fake", ParameterSize: "1B", QuantLevel: "Q4_0"}
+
+// names returns the model names in order
+func (s *Server) names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.models))
+	for name := range s.models {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (s *Server) ps(w http.ResponseWriter) {
+	type processModel struct {
+		Name          string       `json:"name"`
+		Model         string       `json:"model"`
+		Size          int64        `json:"size"`
+		Digest        string       `json:"digest"`
+		Details       modelDetails `json:"details"`
+		ExpiresAt     time.Time    `json:"expires_at"`
+		SizeVRAM      int64        `json:"size_vram"`
+		ContextLength int          `json:"context_length"`
+	}
+	models := []processModel{}
+	for _, name := range s.names() {
+		models = append(models, processModel{
+			Name: name, Model: name, Size: 1 << 30, Digest: digest(name), Details: fakeDetails,
+			ExpiresAt: time.Now().Add(5 * time.Minute).UTC(), SizeVRAM: 1 << 30, ContextLength: s.ContextLength,
+		})
+	}
+	writeJSON(w, map[string]any{"models": models})
+}
+
+func (s *Server) tags(w http.ResponseWriter) {
+	type listModel struct {
+		Name       string       `json:"name"`
+		Model      string       `json:"model"`
+		ModifiedAt time.Time    `json:"modified_at"`
+		Size       int64        `json:"size"`
+		Digest     string       `json:"digest"`
+		Details    modelDetails `json:"details"`
+	}
+	models := []listModel{}
+	for _, name := range s.names() {
+		models = append(models, listModel{Name: name, Model: name, Size: 1 << 30, Digest: digest(name), Details: fakeDetails})
+	}
+	writeJSON(w, map[string]any{"models": models})
+}
+
+// digest returns a stable fake digest for a model name
+func digest(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,543 @@
+package ollama
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Backend is the API dialect a Client speaks, selected by DSN.Backend.
+// An empty Backend is detected from DSN.URL: a URL ending in /chat/completions,
+// like Open WebUI's /api/chat/completions, selects BackendOpenAI, any other BackendOllama.
+type Backend string
+
+// Enumerate backends
+const (
+	BackendOllama Backend = "ollama" // Ollama and Open WebUI native API: /api/generate, /api/chat, /api/embed, ...
+	BackendOpenAI Backend = "openai" // OpenAI-compatible API of vLLM, LiteLLM, Ollama /v1, ...: chat/completions and embeddings
+)
+
+// DefaultOpenAIURL is the OpenAI-compatible API of Ollama on the local default port.
+// Used when DSN.URL is empty and DSN.Backend is BackendOpenAI.
+const DefaultOpenAIURL = "http://localhost:11434/v1"
+
+// detectBackend returns the backend implied by the URL of a DSN without Backend
+func detectBackend(url string) Backend {
+	if strings.HasSuffix(strings.TrimSuffix(strings.TrimSpace(url), "/"), "/chat/completions") {
+		return BackendOpenAI
+	}
+	return BackendOllama
+}
+
+// openAIChatRequest is the body of a chat/completions request
+type openAIChatRequest struct {
+	Model            string                `json:"model"`
+	Messages         []openAIMessage       `json:"messages"`
+	Tools            []Tool                `json:"tools,omitempty"`
+	Stream           bool                  `json:"stream"`
+	StreamOptions    *openAIStreamOptions  `json:"stream_options,omitempty"`
+	ResponseFormat   *openAIResponseFormat `json:"response_format,omitempty"`
+	Temperature      *float64              `json:"temperature,omitempty"`
+	TopP             *float64              `json:"top_p,omitempty"`
+	Seed             *int                  `json:"seed,omitempty"`
+	MaxTokens        *int                  `json:"max_tokens,omitempty"`
+	Stop             []string              `json:"stop,omitempty"`
+	PresencePenalty  *float64              `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64              `json:"frequency_penalty,omitempty"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIResponseFormat struct {
+	Type       string            `json:"type"` // "json_object" or "json_schema"
+	JSONSchema *openAIJSONSchema `json:"json_schema,omitempty"`
+}
+
+type openAIJSONSchema struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+}
+
+// openAIMessage is a chat message; Content is a string, or a list of parts when it has images
+type openAIMessage struct {
+	Role       ChatRole         `json:"role"`
+	Content    any              `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIContentPart struct {
+	Type     string          `json:"type"` // "text" or "image_url"
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+}
+
+type openAIImageURL struct {
+	URL string `json:"url"`
+}
+
+// openAIToolCall is a tool call, or a fragment of one in a streamed delta
+type openAIToolCall struct {
+	Index    *int               `json:"index,omitempty"` // Position of the call a streamed fragment belongs to
+	ID       string             `json:"id,omitempty"`
+	Type     string             `json:"type,omitempty"`
+	Function openAIFunctionCall `json:"function"`
+}
+
+type openAIFunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"` // JSON encoded arguments object
+}
+
+// openAIChunk is a streamed chat.completion.chunk, or a whole chat.completion
+type openAIChunk struct {
+	Model   string `json:"model"`
+	Created int64  `json:"created"`
+	Choices []struct {
+		Delta        *openAIDelta `json:"delta"`   // Set in streamed chunks
+		Message      *openAIDelta `json:"message"` // Set in a whole completion
+		FinishReason *string      `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+type openAIDelta struct {
+	Content          string           `json:"content"`
+	ReasoningContent string           `json:"reasoning_content"` // Reasoning of thinking models, as sent by vLLM and DeepSeek
+	Reasoning        string           `json:"reasoning"`         // Reasoning of thinking models, as sent by Ollama and OpenRouter
+	ToolCalls        []openAIToolCall `json:"tool_calls"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// openAIEmbedRequest is the body of an embeddings request
+type openAIEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// openAIEmbedResponse is the response of the embeddings endpoint
+type openAIEmbedResponse struct {
+	Model string `json:"model"`
+	Data  []struct {
+		Index     int       `json:"index"`
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+// openAIModelList is the response of the models endpoint
+type openAIModelList struct {
+	Data []struct {
+		ID      string `json:"id"`
+		Created int64  `json:"created"`
+	} `json:"data"`
+}
+
+// newOpenAIChatRequest translates the parts of a generate or chat request that OpenAI-compatible APIs support.
+// Ollama specific options, Context, Suffix, Raw, KeepAlive and Think are not sent.
+func newOpenAIChatRequest(model string, messages []ChatMessage, tools []Tool, format *RequestFormat, options *RequestOptions, stream *bool) openAIChatRequest {
+	r := openAIChatRequest{
+		Model:    model,
+		Messages: openAIMessages(messages),
+		Tools:    tools,
+		Stream:   stream == nil || *stream,
+	}
+	if r.Stream {
+		// Ask for the token counts in a last chunk, they become the Metrics of the final response
+		r.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	}
+	if format != nil {
+		switch {
+		case format.IsSchema():
+			r.ResponseFormat = &openAIResponseFormat{Type: "json_schema", JSONSchema: &openAIJSONSchema{Name: "response", Schema: json.RawMessage(*format)}}
+		case *format == FormatJson:
+			r.ResponseFormat = &openAIResponseFormat{Type: "json_object"}
+		}
+	}
+	if o := options; o != nil {
+		r.Temperature = o.Temperature
+		r.TopP = o.TopP
+		r.Seed = o.Seed
+		r.MaxTokens = o.NumPredict
+		r.Stop = o.Stop
+		r.PresencePenalty = o.PresencePenalty
+		if o.FrequencyPenalty != nil {
+			r.FrequencyPenalty = new(float64(*o.FrequencyPenalty))
+		}
+	}
+	return r
+}
+
+// openAIMessages translates a conversation. Tool calls without an ID get one,
+// and tool results without a ToolCallID answer the assistant's calls in order.
+func openAIMessages(messages []ChatMessage) []openAIMessage {
+	result := make([]openAIMessage, 0, len(messages))
+	var unanswered []string // IDs of the last assistant tool calls without a result yet
+	for i, m := range messages {
+		msg := openAIMessage{Role: m.Role, Content: m.Content}
+		if len(m.Images) > 0 {
+			parts := []openAIContentPart{{Type: "text", Text: m.Content}}
+			for _, image := range m.Images {
+				parts = append(parts, openAIContentPart{Type: "image_url", ImageURL: &openAIImageURL{URL: imageDataURL(image)}})
+			}
+			msg.Content = parts
+		}
+
+		switch m.Role {
+		case RoleAssistant:
+			unanswered = nil
+			for j, call := range m.ToolCalls {
+				id := call.ID
+				if id == "" {
+					id = fmt.Sprintf("call_%d_%d", i, j)
+				}
+				arguments := string(call.Function.Arguments)
+				if arguments == "" {
+					arguments = "{}"
+				}
+				msg.ToolCalls = append(msg.ToolCalls, openAIToolCall{ID: id, Type: "function", Function: openAIFunctionCall{Name: call.Function.Name, Arguments: arguments}})
+				unanswered = append(unanswered, id)
+			}
+		case RoleTool:
+			msg.ToolCallID = m.ToolCallID
+			if msg.ToolCallID == "" && len(unanswered) > 0 {
+				msg.ToolCallID = unanswered[0]
+			}
+			unanswered = slices.DeleteFunc(unanswered, func(id string) bool { return id == msg.ToolCallID })
+		}
+		result = append(result, msg)
+	}
+	return result
+}
+
+// imageDataURL encodes an image as a data URL with its sniffed content type
+func imageDataURL(image RequestImage) string {
+	return "data:" + http.DetectContentType(image) + ";base64," + base64.StdEncoding.EncodeToString(image)
+}
+
+// openAIGenerate streams the responses to request from the chat/completions endpoint.
+// The prompt is sent as a user message after the system message.
+func (c *Client) openAIGenerate(ctx context.Context, request Request) iter.Seq2[Response, error] {
+	return func(yield func(Response, error) bool) {
+		var messages []ChatMessage
+		if request.System != nil {
+			messages = append(messages, ChatMessage{Role: RoleSystem, Content: *request.System})
+		}
+		messages = append(messages, ChatMessage{Role: RoleUser, Content: request.Prompt, Images: request.Images})
+		body := newOpenAIChatRequest(request.Model, messages, nil, request.Format, request.Options, request.Stream)
+
+		final := Response{Response: new(""), Done: new(true)}
+		err := c.openAIStream(ctx, "generate", body, func(chunk openAIChunk) error {
+			chunkModel(chunk, &final.Model, &final.CreatedAt)
+			final.Metrics = chunkMetrics(chunk, final.Metrics)
+			for _, choice := range chunk.Choices {
+				if choice.FinishReason != nil && *choice.FinishReason != "" {
+					final.DoneReason = choice.FinishReason
+				}
+				delta := choice.Delta
+				if delta == nil {
+					delta = choice.Message
+				}
+				if delta == nil || delta.Content == "" && delta.thinking() == "" {
+					continue
+				}
+				res := Response{Model: final.Model, CreatedAt: final.CreatedAt, Response: new(delta.Content), Done: new(false)}
+				if thinking := delta.thinking(); thinking != "" {
+					res.Thinking = &thinking
+				}
+				if !yield(res, nil) {
+					return errStopIteration
+				}
+			}
+			return nil
+		})
+		if err == nil {
+			yield(final, nil)
+			return
+		}
+		if !errors.Is(err, errStopIteration) {
+			yield(Response{}, err)
+		}
+	}
+}
+
+// openAIChat sends a conversation to the chat/completions endpoint and calls request.OnJson
+// for every streamed fragment. Streamed tool call fragments are assembled and
+// delivered with the final response.
+func (c *Client) openAIChat(ctx context.Context, request ChatRequest) error {
+	body := newOpenAIChatRequest(request.Model, request.Messages, request.Tools, request.Format, request.Options, request.Stream)
+
+	final := ChatResponse{Message: &ChatMessage{Role: RoleAssistant}, Done: new(true)}
+	var calls []openAIToolCall
+	emit := func(res ChatResponse) error {
+		if request.OnJson == nil {
+			return nil
+		}
+		if err := request.OnJson(res); err != nil {
+			return fmt.Errorf("failed to process chat response: %w", err)
+		}
+		return nil
+	}
+	err := c.openAIStream(ctx, "chat", body, func(chunk openAIChunk) error {
+		chunkModel(chunk, &final.Model, &final.CreatedAt)
+		final.Metrics = chunkMetrics(chunk, final.Metrics)
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != nil && *choice.FinishReason != "" {
+				final.DoneReason = choice.FinishReason
+			}
+			delta := choice.Delta
+			if delta == nil {
+				delta = choice.Message
+			}
+			if delta == nil {
+				continue
+			}
+			calls = mergeToolCalls(calls, delta.ToolCalls)
+			if delta.Content == "" && delta.thinking() == "" {
+				continue
+			}
+			err := emit(ChatResponse{
+				Model:     final.Model,
+				CreatedAt: final.CreatedAt,
+				Message:   &ChatMessage{Role: RoleAssistant, Content: delta.Content, Thinking: delta.thinking()},
+				Done:      new(false),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, call := range calls {
+		final.Message.ToolCalls = append(final.Message.ToolCalls, ToolCall{
+			ID:       call.ID,
+			Function: ToolCallFunction{Name: call.Function.Name, Arguments: json.RawMessage(call.Function.Arguments)},
+		})
+	}
+	return emit(final)
+}
+
+// openAIEmbed sends request to the embeddings endpoint.
+// Truncate and KeepAlive are not supported by OpenAI-compatible APIs and not sent.
+func (c *Client) openAIEmbed(ctx context.Context, request EmbedRequest) (*EmbedResponse, error) {
+	var result openAIEmbedResponse
+	body := openAIEmbedRequest{Model: request.Model, Input: request.Input}
+	if err := c.doJSON(ctx, "embed", "POST", c.EndpointURL("embeddings"), body, &result); err != nil {
+		return nil, err
+	}
+
+	if len(result.Data) != len(request.Input) {
+		return nil, fmt.Errorf("embed response: got %d embeddings for %d inputs", len(result.Data), len(request.Input))
+	}
+	embeddings := make([][]float64, len(result.Data))
+	for _, d := range result.Data {
+		if d.Index < 0 || d.Index >= len(embeddings) {
+			return nil, fmt.Errorf("embed response: embedding index %d out of range", d.Index)
+		}
+		embeddings[d.Index] = d.Embedding
+	}
+	// Duplicate indexes leave other slots empty
+	for i, embedding := range embeddings {
+		if embedding == nil {
+			return nil, fmt.Errorf("embed response: missing embedding %d", i)
+		}
+	}
+	response := &EmbedResponse{Model: result.Model, Embeddings: embeddings}
+	if result.Usage != nil {
+		response.PromptEvalCount = result.Usage.PromptTokens
+	}
+	return response, nil
+}
+
+// openAIModels lists the models endpoint as a tags response.
+// Only the names and creation times are known, as ModifiedAt.
+func (c *Client) openAIModels(ctx context.Context) (*ListResponse, error) {
+	var result openAIModelList
+	if err := c.doJSON(ctx, "tags", "GET", c.EndpointURL("models"), nil, &result); err != nil {
+		return nil, err
+	}
+	list := &ListResponse{Models: make([]ListModel, 0, len(result.Data))}
+	for _, m := range result.Data {
+		model := ListModel{Name: m.ID, Model: m.ID}
+		if m.Created > 0 {
+			model.ModifiedAt = new(time.Unix(m.Created, 0))
+		}
+		list.Models = append(list.Models, model)
+	}
+	return list, nil
+}
+
+// openAIStream POSTs body to the chat/completions endpoint and calls onChunk for each
+// chunk of the server-sent events stream, or once with a whole completion if the
+// response is not a stream. A stream closed before its "data: [DONE]" frame fails with ErrStreamTruncated.
+// name identifies the endpoint in error messages.
+func (c *Client) openAIStream(ctx context.Context, name string, body openAIChatRequest, onChunk func(openAIChunk) error) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s request: %w", name, err)
+	}
+	url := c.EndpointURL("chat/completions")
+	resp, err := c.send(ctx, name, "POST", url, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		var chunk openAIChunk
+		if err := json.NewDecoder(resp.Body).Decode(&chunk); err != nil {
+			return contextError(ctx, name, fmt.Errorf("failed to decode %s response: %w", name, err))
+		}
+		return onChunk(chunk)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Split(splitEvents)
+	for scanner.Scan() {
+		// Stop promptly even if the scanner still has buffered events
+		if err = ctx.Err(); err != nil {
+			return contextError(ctx, name, err)
+		}
+		payload, ok := sseData(scanner.Bytes())
+		if !ok {
+			continue
+		}
+		if string(payload) == "[DONE]" {
+			return nil
+		}
+		// Errors after the headers were sent arrive as data: {"error": {...}} events
+		if apiErr := streamError(name, url, payload); apiErr != nil {
+			return apiErr
+		}
+		var chunk openAIChunk
+		if err = json.Unmarshal(payload, &chunk); err != nil {
+			return fmt.Errorf("failed to unmarshal %s response: %w", name, err)
+		}
+		if err = onChunk(chunk); err != nil {
+			return err
+		}
+	}
+
+	// Check for read errors, e.g. a body closed by a cancelled context
+	if err = scanner.Err(); err != nil {
+		return contextError(ctx, name, fmt.Errorf("failed to read %s response: %w", name, err))
+	}
+	return fmt.Errorf("%s response: %w", name, ErrStreamTruncated)
+}
+
+// splitEvents is a bufio.SplitFunc returning the server-sent events of a stream.
+// Events are separated by a blank line; lines may end in "\n", "\r\n" or "\r".
+func splitEvents(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	// lineEnd returns the index after the line break at i, -1 if more data is needed to tell
+	lineEnd := func(i int) int {
+		if data[i] == '\r' {
+			if i+1 == len(data) && !atEOF {
+				return -1
+			}
+			if i+1 < len(data) && data[i+1] == '\n' {
+				return i + 2
+			}
+		}
+		return i + 1
+	}
+	for i := 0; i < len(data); i++ {
+		if data[i] != '\n' && data[i] != '\r' {
+			continue
+		}
+		next := lineEnd(i)
+		if next < 0 || next == len(data) && !atEOF {
+			return 0, nil, nil
+		}
+		if next < len(data) && (data[next] == '\n' || data[next] == '\r') {
+			end := lineEnd(next)
+			if end < 0 {
+				return 0, nil, nil
+			}
+			return end, data[:i], nil
+		}
+		i = next - 1
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// sseData returns the joined data lines of a server-sent event, false if it has none (e.g. a comment)
+func sseData(event []byte) ([]byte, bool) {
+	var data []string
+	lines := strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(string(event))
+	for line := range strings.Lines(lines) {
+		if value, ok := strings.CutPrefix(strings.TrimRight(line, "\n"), "data:"); ok {
+			data = append(data, strings.TrimPrefix(value, " "))
+		}
+	}
+	if len(data) == 0 {
+		return nil, false
+	}
+	return []byte(strings.TrimSpace(strings.Join(data, "\n"))), true
+}
+
+// mergeToolCalls adds tool calls to calls. A streamed fragment whose index
+// is already known continues that call: its arguments are appended.
+func mergeToolCalls(calls, fragments []openAIToolCall) []openAIToolCall {
+	for _, fragment := range fragments {
+		if fragment.Index == nil || *fragment.Index >= len(calls) {
+			calls = append(calls, fragment)
+			continue
+		}
+		call := &calls[*fragment.Index]
+		if fragment.ID != "" {
+			call.ID = fragment.ID
+		}
+		if fragment.Function.Name != "" {
+			call.Function.Name = fragment.Function.Name
+		}
+		call.Function.Arguments += fragment.Function.Arguments
+	}
+	return calls
+}
+
+// thinking returns the reasoning in whichever field the server uses
+func (d *openAIDelta) thinking() string {
+	if d.ReasoningContent != "" {
+		return d.ReasoningContent
+	}
+	return d.Reasoning
+}
+
+// chunkModel updates model and created with the ones of a chunk, if it has them
+func chunkModel(chunk openAIChunk, model **string, created **time.Time) {
+	if chunk.Model != "" {
+		*model = &chunk.Model
+	}
+	if chunk.Created > 0 {
+		*created = new(time.Unix(chunk.Created, 0))
+	}
+}
+
+// chunkMetrics returns metrics updated with the token counts of a chunk, if it has them
+func chunkMetrics(chunk openAIChunk, metrics Metrics) Metrics {
+	if chunk.Usage != nil {
+		metrics.PromptEvalCount = new(chunk.Usage.PromptTokens)
+		metrics.EvalCount = new(chunk.Usage.CompletionTokens)
+	}
+	return metrics
+}
@@ -0,0 +1,370 @@
+package ollama
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// sseBody builds a server-sent events stream of the given chat.completion.chunk payloads, ended by [DONE].
+func sseBody(chunks ...string) string {
+	var sb strings.Builder
+	for _, chunk := range chunks {
+		sb.WriteString("data: " + chunk + "\n\n")
+	}
+	sb.WriteString("data: [DONE]\n\n")
+	return sb.String()
+}
+
+// openAIServer serves body as a server-sent events stream and records the decoded requests by path.
+func openAIServer(t *testing.T, body func(path string, n int) string) (*httptest.Server, *[]map[string]any) {
+	t.Helper()
+	var requests []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		req["path"] = r.URL.Path
+		requests = append(requests, req)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, body(r.URL.Path, len(requests)))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestDetectBackend(t *testing.T) {
+	t.Parallel()
+	for url, want := range map[string]Backend{
+		"":                                  BackendOllama,
+		"http://host/api/generate":          BackendOllama,
+		"http://host/v1/chat/completions":   BackendOpenAI,
+		"http://host/api/chat/completions/": BackendOpenAI,
+	} {
+		if got := NewOpenWebUiClient(&DSN{URL: url}).ds.Backend; got != want {
+			t.Errorf("backend of %q = %q, want %q", url, got, want)
+		}
+	}
+	if got := NewOpenWebUiClient(&DSN{Backend: BackendOpenAI}).ds.URL; got != DefaultOpenAIURL {
+		t.Errorf("default OpenAI URL = %q, want %q", got, DefaultOpenAIURL)
+	}
+}
+
+func TestOpenAI_QueryStreamsSSE(t *testing.T) {
+	srv, requests := openAIServer(t, func(string, int) string {
+		return sseBody(
+			`{"model":"m","created":1700000000,"choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}`,
+			`{"model":"m","created":1700000000,"choices":[{"index":0,"delta":{"content":"Hello"}}]}`,
+			`{"model":"m","created":1700000000,"choices":[{"index":0,"delta":{"content":", world"}}]}`,
+			`{"model":"m","created":1700000000,"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+			`{"model":"m","created":1700000000,"choices":[],"usage":{"prompt_tokens":7,"completion_tokens":3}}`,
+		)
+	})
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/v1", Token: "key", Backend: BackendOpenAI})
+
+	var text strings.Builder
+	var last Response
+	err := client.Query(Request{
+		Model:   "m",
+		Prompt:  "say hello",
+		System:  new("be brief"),
+		Options: &RequestOptions{NumPredict: new(64), Temperature: new(0.5)},
+		OnJson: func(res Response) error {
+			text.WriteString(*res.Response)
+			last = res
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text.String() != "Hello, world" {
+		t.Errorf("text = %q", text.String())
+	}
+	if last.Done == nil || !*last.Done || last.DoneReason == nil || *last.DoneReason != "stop" {
+		t.Errorf("final response = %+v, want done with reason stop", last)
+	}
+	if last.PromptEvalCount == nil || *last.PromptEvalCount != 7 || last.EvalCount == nil || *last.EvalCount != 3 {
+		t.Errorf("metrics = %+v, want 7 prompt and 3 completion tokens", last.Metrics)
+	}
+	if last.Model == nil || *last.Model != "m" || last.CreatedAt == nil || last.CreatedAt.Unix() != 1700000000 {
+		t.Errorf("model/created = %v/%v", last.Model, last.CreatedAt)
+	}
+
+	req := (*requests)[0]
+	if req["path"] != "/v1/chat/completions" || req["stream"] != true || req["max_tokens"] != 64.0 || req["temperature"] != 0.5 {
+		t.Errorf("request = %v", req)
+	}
+	messages := req["messages"].([]any)
+	if len(messages) != 2 || messages[0].(map[string]any)["role"] != "system" || messages[1].(map[string]any)["content"] != "say hello" {
+		t.Errorf("messages = %v", messages)
+	}
+}
+
+func TestSplitEvents(t *testing.T) {
+	t.Parallel()
+	for name, stream := range map[string]string{
+		"LF":   "data: a\n\n: comment\n\ndata: b\ndata: c\n\ndata: d",
+		"CRLF": "data: a\r\n\r\n: comment\r\n\r\ndata: b\r\ndata: c\r\n\r\ndata: d\r\n",
+		"CR":   "data: a\r\r: comment\r\rdata: b\rdata: c\r\rdata: d\r\r",
+	} {
+		sc := bufio.NewScanner(strings.NewReader(stream))
+		sc.Buffer(make([]byte, 0, 4), 1024) // small reads split the terminators
+		sc.Split(splitEvents)
+		var got []string
+		for sc.Scan() {
+			if data, ok := sseData(sc.Bytes()); ok {
+				got = append(got, string(data))
+			}
+		}
+		if strings.Join(got, "|") != "a|b\nc|d" {
+			t.Errorf("%s: events = %q", name, got)
+		}
+	}
+}
+
+func TestOpenAI_QueryStreamsCRLF(t *testing.T) {
+	srv, _ := openAIServer(t, func(string, int) string {
+		return strings.ReplaceAll(sseBody(
+			`{"model":"m","choices":[{"index":0,"delta":{"content":"Hello"}}]}`,
+			`{"model":"m","choices":[{"index":0,"delta":{"content":", world"},"finish_reason":"stop"}]}`,
+		), "\n", "\r\n")
+	})
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/v1", Backend: BackendOpenAI})
+
+	var text strings.Builder
+	err := client.Query(Request{Model: "m", Prompt: "say hello", OnJson: func(res Response) error {
+		text.WriteString(*res.Response)
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text.String() != "Hello, world" {
+		t.Errorf("text = %q", text.String())
+	}
+}
+
+func TestOpenAI_ThinkingAndImages(t *testing.T) {
+	srv, requests := openAIServer(t, func(string, int) string {
+		return sseBody(
+			`{"choices":[{"delta":{"reasoning_content":"hmm"}}]}`,
+			`{"choices":[{"delta":{"content":"a cat"},"finish_reason":"stop"}]}`,
+		)
+	})
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/v1/chat/completions"})
+
+	var thinking, text string
+	for res, err := range client.Stream(context.Background(), Request{Model: "m", Prompt: "what is it?", Images: []RequestImage{[]byte("\x89PNG\r\n\x1a\n")}}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Thinking != nil {
+			thinking += *res.Thinking
+		}
+		text += *res.Response
+	}
+	if thinking != "hmm" || text != "a cat" {
+		t.Errorf("thinking = %q, text = %q", thinking, text)
+	}
+
+	content := (*requests)[0]["messages"].([]any)[0].(map[string]any)["content"].([]any)
+	image := content[1].(map[string]any)["image_url"].(map[string]any)["url"].(string)
+	if len(content) != 2 || !strings.HasPrefix(image, "data:image/png;base64,") {
+		t.Errorf("content = %v", content)
+	}
+}
+
+func TestOpenAI_ChatToolCalls(t *testing.T) {
+	srv, requests := openAIServer(t, func(_ string, n int) string {
+		if n == 1 {
+			return sseBody(
+				`{"choices":[{"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+				`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}`,
+				`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Berlin\"}"}}]},"finish_reason":"tool_calls"}]}`,
+			)
+		}
+		return sseBody(`{"choices":[{"delta":{"content":"It is sunny in Berlin."},"finish_reason":"stop"}]}`)
+	})
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/v1", Backend: BackendOpenAI})
+
+	reg := NewToolRegistry()
+	var gotCity string
+	RegisterTool(reg, "get_weather", "Current weather", func(ctx context.Context, args weatherArgs) (string, error) {
+		gotCity = args.City
+		return "sunny", nil
+	})
+	messages, err := client.RunTools(context.Background(), ChatRequest{
+		Model:    "m",
+		Messages: []ChatMessage{{Role: RoleUser, Content: "Weather in Berlin?"}},
+	}, reg, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotCity != "Berlin" {
+		t.Errorf("tool called with city %q", gotCity)
+	}
+	if last := messages[len(messages)-1]; last.Content != "It is sunny in Berlin." {
+		t.Errorf("answer = %q", last.Content)
+	}
+
+	sent := (*requests)[1]["messages"].([]any)
+	call := sent[1].(map[string]any)["tool_calls"].([]any)[0].(map[string]any)
+	result := sent[2].(map[string]any)
+	if call["id"] != "call_1" || call["function"].(map[string]any)["arguments"] != `{"city":"Berlin"}` {
+		t.Errorf("assistant tool call = %v", call)
+	}
+	if result["role"] != "tool" || result["tool_call_id"] != "call_1" || result["content"] != "sunny" {
+		t.Errorf("tool result = %v", result)
+	}
+	if tools := (*requests)[0]["tools"].([]any); len(tools) != 1 {
+		t.Errorf("tools = %v", tools)
+	}
+}
+
+func TestOpenAIMessages_ToolCallIDs(t *testing.T) {
+	t.Parallel()
+	messages := openAIMessages([]ChatMessage{
+		{Role: RoleAssistant, ToolCalls: []ToolCall{{Function: ToolCallFunction{Name: "a"}}, {Function: ToolCallFunction{Name: "b"}}}},
+		{Role: RoleTool, Content: "1"},
+		{Role: RoleTool, Content: "2"},
+	})
+	if messages[0].ToolCalls[0].ID != "call_0_0" || messages[0].ToolCalls[0].Function.Arguments != "{}" {
+		t.Errorf("tool call = %+v", messages[0].ToolCalls[0])
+	}
+	if messages[1].ToolCallID != "call_0_0" || messages[2].ToolCallID != "call_0_1" {
+		t.Errorf("tool call IDs = %q, %q", messages[1].ToolCallID, messages[2].ToolCallID)
+	}
+}
+
+func TestOpenAI_NonStreamedCompletion(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"model":"m","choices":[{"message":{"role":"assistant","content":"{\"ok\":true}"},"finish_reason":"stop"}],"usage":{"prompt_tokens":2,"completion_tokens":4}}`)
+	}))
+	defer srv.Close()
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/v1", Backend: BackendOpenAI})
+
+	var responses []Response
+	err := client.Query(Request{Model: "m", Prompt: "p", Stream: new(false), Format: new(FormatJson), OnJson: func(res Response) error {
+		responses = append(responses, res)
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 2 || *responses[0].Response != `{"ok":true}` || !*responses[1].Done || *responses[1].EvalCount != 4 {
+		t.Errorf("responses = %+v", responses)
+	}
+}
+
+func TestOpenAI_Errors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "Bearer missing":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"message":"The model 'x' does not exist","type":"invalid_request_error"}}`)
+		case "Bearer midstream":
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: "+`{"choices":[{"delta":{"content":"par"}}]}`+"\n\n")
+			fmt.Fprint(w, "data: "+`{"error":{"message":"engine crashed"}}`+"\n\n")
+		default:
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, ": keep-alive\n\n")
+			fmt.Fprint(w, "data: "+`{"choices":[{"delta":{"content":"cut"}}]}`+"\n\n")
+		}
+	}))
+	defer srv.Close()
+	query := func(token string) error {
+		client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/v1/chat/completions", Token: token})
+		return client.Query(Request{Model: "x", Prompt: "p"})
+	}
+
+	err := query("missing")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Message != "The model 'x' does not exist" || !errors.Is(err, ErrModelNotFound) {
+		t.Errorf("error = %v, want model not found", err)
+	}
+	if err := query("midstream"); !errors.As(err, &apiErr) || apiErr.Message != "engine crashed" {
+		t.Errorf("error = %v, want in-stream error", err)
+	}
+	if err := query("truncated"); !errors.Is(err, ErrStreamTruncated) {
+		t.Errorf("error = %v, want ErrStreamTruncated", err)
+	}
+}
+
+func TestOpenAI_Embed(t *testing.T) {
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"model":"e","data":[{"index":1,"embedding":[0,1]},{"index":0,"embedding":[1,0]}],"usage":{"prompt_tokens":5}}`)
+	}))
+	defer srv.Close()
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/chat/completions"})
+
+	res, err := client.Embed(EmbedRequest{Model: "e", Input: []string{"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/api/embeddings" {
+		t.Errorf("path = %q, want /api/embeddings", path)
+	}
+	if len(res.Embeddings) != 2 || res.Embeddings[0][0] != 1 || res.Embeddings[1][1] != 1 || res.PromptEvalCount != 5 {
+		t.Errorf("response = %+v", res)
+	}
+}
+
+func TestOpenAI_ModelsAndUnsupported(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"object":"list","data":[{"id":"llama3","object":"model","created":1700000000,"owned_by":"vllm"}]}`)
+	}))
+	defer srv.Close()
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/v1", Backend: BackendOpenAI})
+
+	list, err := client.Tags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Models) != 1 || list.Models[0].Name != "llama3" || list.Models[0].ModifiedAt.Unix() != 1700000000 {
+		t.Errorf("models = %+v", list.Models)
+	}
+	if _, err := client.Ps(); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Ps error = %v, want ErrUnsupported", err)
+	}
+	if _, err := client.Show(ShowRequest{Model: "llama3"}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Show error = %v, want ErrUnsupported", err)
+	}
+	if err := client.Pull(PullRequest{Model: "llama3"}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Pull error = %v, want ErrUnsupported", err)
+	}
+	if strings.Join(paths, ",") != "/v1/models" {
+		t.Errorf("requested paths = %v, want only /v1/models", paths)
+	}
+}
+
+func TestOpenAI_EmbedIncomplete(t *testing.T) {
+	for name, body := range map[string]string{
+		"missing":   `{"data":[{"index":0,"embedding":[1,0]}]}`,
+		"duplicate": `{"data":[{"index":0,"embedding":[1,0]},{"index":0,"embedding":[0,1]}]}`,
+		"null":      `{"data":[{"index":0,"embedding":[1,0]},{"index":1,"embedding":null}]}`,
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, body)
+		}))
+		client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/v1", Backend: BackendOpenAI})
+		if res, err := client.Embed(EmbedRequest{Model: "e", Input: []string{"a", "b"}}); err == nil {
+			t.Errorf("%s: Embed = %+v, want error", name, res)
+		}
+		srv.Close()
+	}
+}
@@ -0,0 +1,161 @@
+package ollama
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Option configures the HTTP transport and behaviour of a Client, see NewOpenWebUiClient
+type Option func(*clientOptions) error
+
+// clientOptions collects the options before the HTTP client is built
+type clientOptions struct {
+	httpClient *http.Client
+	tlsConfig  *tls.Config
+	proxy      func(*http.Request) (*url.URL, error)
+	timeout    time.Duration
+	retry      *RetryPolicy
+	embedCache *EmbedCache
+
+	responseCache ResponseCache
+	replayTiming  float64
+}
+
+// WithHTTPClient uses the given HTTP client as is.
+// The transport options (TLS, proxy) are ignored; WithTimeout still applies.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *clientOptions) error {
+		if client == nil {
+			return errors.New("http client is nil")
+		}
+		o.httpClient = client
+		return nil
+	}
+}
+
+// WithTLSConfig uses a copy of config as the base TLS configuration.
+// Options given after it (root CAs, client certificates) are added on top.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(o *clientOptions) error {
+		if config == nil {
+			return errors.New("tls config is nil")
+		}
+		o.tlsConfig = config.Clone()
+		return nil
+	}
+}
+
+// WithRootCAs trusts the PEM encoded CA certificates in pemPath
+// in addition to the system roots, e.g. for a self-hosted Open WebUI with a private CA.
+func WithRootCAs(pemPath string) Option {
+	return func(o *clientOptions) error {
+		data, err := os.ReadFile(pemPath)
+		if err != nil {
+			return fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool := o.tls().RootCAs
+		if pool == nil {
+			if pool, err = x509.SystemCertPool(); err != nil {
+				pool = x509.NewCertPool()
+			}
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates found in CA bundle %s", pemPath)
+		}
+		o.tls().RootCAs = pool
+		return nil
+	}
+}
+
+// WithClientCertificate presents the PEM encoded certificate and key to the server (mutual TLS).
+func WithClientCertificate(certPath, keyPath string) Option {
+	return func(o *clientOptions) error {
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		o.tls().Certificates = append(o.tls().Certificates, cert)
+		return nil
+	}
+}
+
+// WithInsecureSkipVerify disables TLS certificate verification.
+// Only use it against test servers: the connection is open to man-in-the-middle attacks.
+func WithInsecureSkipVerify() Option {
+	return func(o *clientOptions) error {
+		o.tls().InsecureSkipVerify = true
+		return nil
+	}
+}
+
+// WithProxy sends all requests through the given proxy URL, e.g. "http://proxy:3128".
+// Without it the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables are honoured.
+func WithProxy(proxyURL string) Option {
+	return func(o *clientOptions) error {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			return fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		o.proxy = http.ProxyURL(u)
+		return nil
+	}
+}
+
+// WithTimeout limits the total time of a request, including reading a streamed response.
+// The default is no timeout, as generations can take minutes; prefer a context deadline per call.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *clientOptions) error {
+		o.timeout = timeout
+		return nil
+	}
+}
+
+// tls returns the TLS configuration being built, creating it on first use.
+func (o *clientOptions) tls() *tls.Config {
+	if o.tlsConfig == nil {
+		o.tlsConfig = &tls.Config{}
+	}
+	return o.tlsConfig
+}
+
+// applyOptions applies opts in order, collecting their errors.
+// The returned options are usable even if an option fails.
+func applyOptions(opts []Option) (*clientOptions, error) {
+	var o clientOptions
+	var errs []error
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return &o, errors.Join(errs...)
+}
+
+// newHTTPClient builds the HTTP client described by the options.
+func (o *clientOptions) newHTTPClient() *http.Client {
+	if o.httpClient != nil {
+		client := *o.httpClient
+		if o.timeout > 0 {
+			client.Timeout = o.timeout
+		}
+		return &client
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if o.tlsConfig != nil {
+		transport.TLSClientConfig = o.tlsConfig
+	}
+	if o.proxy != nil {
+		transport.Proxy = o.proxy
+	}
+	return &http.Client{
+		Timeout:   o.timeout,
+		Transport: transport,
+	}
+}
@@ -0,0 +1,174 @@
+package ollama
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writePEM writes a PEM block of the given type to dir/name and returns the path.
+func writePEM(t *testing.T, dir, name, typ string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newClientCert creates a self-signed client certificate and returns its pool and PEM file paths.
+func newClientCert(t *testing.T) (pool *x509.CertPool, certPath, keyPath string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "go-ollama test client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool = x509.NewCertPool()
+	pool.AddCert(cert)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	return pool, writePEM(t, dir, "client.pem", "CERTIFICATE", der), writePEM(t, dir, "client.key", "EC PRIVATE KEY", keyDER)
+}
+
+func newTLSPsServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"models":[]}`)
+	}))
+}
+
+func TestTLS_VerifiesByDefault(t *testing.T) {
+	srv := newTLSPsServer(t)
+	srv.StartTLS()
+	defer srv.Close()
+
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"})
+	_, err := client.Ps()
+	if err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Fatalf("error = %v, want certificate verification failure", err)
+	}
+
+	insecure := NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"}, WithInsecureSkipVerify())
+	if _, err := insecure.Ps(); err != nil {
+		t.Fatalf("Ps with WithInsecureSkipVerify: %v", err)
+	}
+}
+
+func TestTLS_WithRootCAs(t *testing.T) {
+	srv := newTLSPsServer(t)
+	srv.StartTLS()
+	defer srv.Close()
+
+	caPath := writePEM(t, t.TempDir(), "ca.pem", "CERTIFICATE", srv.Certificate().Raw)
+	client, err := NewClient(&DSN{URL: srv.URL + "/api/generate"}, WithRootCAs(caPath))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if _, err := client.Ps(); err != nil {
+		t.Fatalf("Ps with trusted CA: %v", err)
+	}
+}
+
+func TestTLS_WithClientCertificate(t *testing.T) {
+	pool, certPath, keyPath := newClientCert(t)
+
+	srv := newTLSPsServer(t)
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	srv.StartTLS()
+	defer srv.Close()
+
+	caPath := writePEM(t, t.TempDir(), "ca.pem", "CERTIFICATE", srv.Certificate().Raw)
+
+	without := NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"}, WithRootCAs(caPath))
+	if _, err := without.Ps(); err == nil {
+		t.Fatal("expected handshake failure without a client certificate")
+	}
+
+	with := NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"},
+		WithRootCAs(caPath),
+		WithClientCertificate(certPath, keyPath),
+	)
+	if _, err := with.Ps(); err != nil {
+		t.Fatalf("Ps with client certificate: %v", err)
+	}
+}
+
+func TestOptions_Errors(t *testing.T) {
+	_, err := NewClient(nil, WithRootCAs(filepath.Join(t.TempDir(), "missing.pem")))
+	if err == nil || !strings.Contains(err.Error(), "CA bundle") {
+		t.Fatalf("NewClient error = %v, want CA bundle error", err)
+	}
+
+	// The lenient constructor reports the error on every request.
+	client := NewOpenWebUiClient(nil, WithProxy("://bad"))
+	if _, err := client.Ps(); err == nil || !strings.Contains(err.Error(), "invalid client configuration") {
+		t.Fatalf("Ps error = %v, want configuration error", err)
+	}
+}
+
+func TestOptions_WithHTTPClientAndTimeout(t *testing.T) {
+	var used bool
+	hc := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		used = true
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"models":[]}`)
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(&DSN{URL: srv.URL + "/api/generate"}, WithHTTPClient(hc), WithTimeout(time.Second))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if _, err := client.Ps(); err != nil {
+		t.Fatalf("Ps: %v", err)
+	}
+	if !used {
+		t.Error("custom HTTP client was not used")
+	}
+	if client.client.Timeout != time.Second {
+		t.Errorf("timeout = %v, want 1s", client.client.Timeout)
+	}
+	if hc.Timeout != 0 {
+		t.Error("WithTimeout modified the caller's HTTP client")
+	}
+}
+
+// roundTripFunc adapts a function to http.RoundTripper.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
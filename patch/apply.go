@@ -0,0 +1,329 @@
+package patch
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/eslider/go-ollama"
+)
+
+// DefaultFuzz is the number of context lines a Patcher created by New may ignore at either end of a hunk
+const DefaultFuzz = 2
+
+// Patcher applies diffs to the files below Root
+type Patcher struct {
+	Root   string // Directory the diff paths are relative to, the working directory if empty
+	Fuzz   int    // Context lines that may be ignored at either end of a hunk, like patch -F
+	DryRun bool   // Only report what would be applied
+}
+
+// New creates a Patcher for the files below root with DefaultFuzz
+func New(root string) *Patcher {
+	return &Patcher{Root: root, Fuzz: DefaultFuzz}
+}
+
+// Reject is a hunk that could not be applied
+type Reject struct {
+	Path   string // Path of the file, as named by the diff
+	Index  int    // Position of the hunk in its file diff, from 0
+	Hunk   *Hunk
+	Reason string
+}
+
+// Error describes the rejected hunk, e.g. to report it back to the model
+func (r Reject) Error() string {
+	return fmt.Sprintf("%s: hunk #%d %s: %s", r.Path, r.Index+1, r.Hunk.Header(), r.Reason)
+}
+
+// FileResult is the outcome of a FileDiff
+type FileResult struct {
+	Path    string   // Path of the file, as named by the diff
+	Created bool     // The file did not exist before
+	Deleted bool     // The file was removed
+	Applied int      // Number of hunks applied
+	Fuzzy   int      // Number of applied hunks that needed whitespace-insensitive or fuzz matching
+	Rejects []Reject // Hunks that could not be applied
+}
+
+// Result is the outcome of applying a diff
+type Result struct {
+	Files []FileResult
+}
+
+// Rejects returns the rejected hunks of all files
+func (r *Result) Rejects() []Reject {
+	var rejects []Reject
+	for _, f := range r.Files {
+		rejects = append(rejects, f.Rejects...)
+	}
+	return rejects
+}
+
+// IsDiff reports whether a code block is a diff, i.e. its Type is "diff" or "patch"
+func IsDiff(block *ollama.CodeBlock) bool {
+	return strings.EqualFold(block.Type, "diff") || strings.EqualFold(block.Type, "patch")
+}
+
+// ApplyText extracts the diff blocks of a model answer with ollama.ParseCodeBlock and applies them
+func (p *Patcher) ApplyText(text string) (*Result, error) {
+	return p.ApplyBlocks(ollama.ParseCodeBlock(&text))
+}
+
+// ApplyBlocks applies the diff blocks among blocks, other blocks are ignored.
+// Hunks of a block without file headers apply to the block's "filename" attribute.
+func (p *Patcher) ApplyBlocks(blocks []*ollama.CodeBlock) (*Result, error) {
+	result := &Result{}
+	for _, block := range blocks {
+		if !IsDiff(block) {
+			continue
+		}
+		diffs, err := Parse(block.Code)
+		if err != nil {
+			return result, err
+		}
+		for _, d := range diffs {
+			if d.Path() == "" {
+				d.OldPath = block.Attr("filename")
+				d.NewPath = d.OldPath
+			}
+		}
+		r, err := p.Apply(diffs)
+		result.Files = append(result.Files, r.Files...)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// Apply applies the file diffs in order.
+// Applied hunks are written even if other hunks of the same file are rejected, like patch does.
+// The error reports I/O failures; hunks that do not apply are returned as Rejects.
+func (p *Patcher) Apply(diffs []*FileDiff) (*Result, error) {
+	result := &Result{}
+	for _, d := range diffs {
+		r, err := p.applyFile(d)
+		result.Files = append(result.Files, r)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+func (p *Patcher) applyFile(d *FileDiff) (FileResult, error) {
+	res := FileResult{Path: d.Path()}
+	rejectAll := func(reason string) (FileResult, error) {
+		for i, h := range d.Hunks {
+			res.Rejects = append(res.Rejects, Reject{Path: res.Path, Index: i, Hunk: h, Reason: reason})
+		}
+		return res, nil
+	}
+
+	rel := filepath.FromSlash(res.Path)
+	if res.Path == "" {
+		return rejectAll("diff does not name a file")
+	}
+	if !filepath.IsLocal(rel) {
+		return rejectAll("path escapes the root directory")
+	}
+	path := filepath.Join(p.Root, rel)
+
+	// Files are accessed through the root so that symlinks below it cannot lead outside
+	root, err := os.OpenRoot(cmp.Or(p.Root, "."))
+	if err != nil {
+		return res, fmt.Errorf("failed to open root directory %s: %w", p.Root, err)
+	}
+	defer root.Close()
+
+	var lines []string
+	eol := true
+	if d.OldPath == DevNull {
+		if _, err := root.Lstat(rel); err == nil {
+			return rejectAll("file already exists")
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return res, fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		res.Created = true
+	} else {
+		data, err := root.ReadFile(rel)
+		if errors.Is(err, fs.ErrNotExist) {
+			return rejectAll("file does not exist")
+		} else if err != nil {
+			return res, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		lines, eol = splitLines(string(data))
+	}
+
+	// shift is how far the previous hunk landed from its header position
+	start, shift := 0, 0
+	for i, h := range d.Hunks {
+		m, ok := p.locate(lines, h, start, shift)
+		if !ok {
+			res.Rejects = append(res.Rejects, Reject{Path: res.Path, Index: i, Hunk: h, Reason: "context not found"})
+			continue
+		}
+		replacement, n := m.replace(lines)
+		lines = slices.Replace(lines, m.pos, m.pos+n, replacement...)
+		start = m.pos + len(replacement)
+		if h.OldStart > 0 {
+			shift = m.pos - (h.OldStart - 1 + m.skipped) + len(replacement) - n
+		}
+		res.Applied++
+		if m.fuzzy {
+			res.Fuzzy++
+		}
+	}
+
+	if p.DryRun || res.Applied == 0 {
+		return res, nil
+	}
+	if d.NewPath == DevNull && len(lines) == 0 {
+		res.Deleted = true
+		if err := root.Remove(rel); err != nil {
+			return res, fmt.Errorf("failed to delete %s: %w", path, err)
+		}
+		return res, nil
+	}
+	if err := ollama.WriteRootFile(root, rel, []byte(joinLines(lines, eol))); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// match is where a hunk, possibly without some of its context, applies
+type match struct {
+	pos     int    // index of the first file line replaced
+	lines   []Line // hunk lines without the context ignored by fuzz
+	skipped int    // leading context lines ignored by fuzz
+	fuzzy   bool
+}
+
+// replace returns the lines replacing the match and the number of file lines they replace.
+// Context lines keep the file's version, which may differ in whitespace.
+func (m match) replace(lines []string) ([]string, int) {
+	var out []string
+	n := 0
+	for _, l := range m.lines {
+		switch l.Kind {
+		case Context:
+			out = append(out, lines[m.pos+n])
+			n++
+		case Delete:
+			n++
+		case Insert:
+			out = append(out, l.Text)
+		}
+	}
+	return out, n
+}
+
+// locate finds the position of a hunk at or after start, nearest to the position its header claims.
+// It tries an exact match first, then ignores whitespace, then drops context lines up to the fuzz factor.
+func (p *Patcher) locate(lines []string, h *Hunk, start, shift int) (match, bool) {
+	for fuzz := 0; fuzz <= max(p.Fuzz, 0); fuzz++ {
+		hunk, skipped, ok := trimContext(h.Lines, fuzz)
+		if !ok {
+			break
+		}
+		var old []string
+		for _, l := range hunk {
+			if l.Kind != Insert {
+				old = append(old, l.Text)
+			}
+		}
+		want := start
+		if h.OldStart > 0 {
+			want = h.OldStart - 1 + skipped + shift
+		}
+		if len(old) == 0 {
+			// Pure insertion: a header without context names the line to insert after
+			if h.OldStart > 0 && h.OldLines == 0 {
+				want++
+			}
+			pos := min(max(want, start), len(lines))
+			return match{pos: pos, lines: hunk, skipped: skipped, fuzzy: fuzz > 0}, true
+		}
+		for loose, equal := range []func(a, b string) bool{exactEqual, looseEqual} {
+			if pos, ok := search(lines, old, start, want, equal); ok {
+				return match{pos: pos, lines: hunk, skipped: skipped, fuzzy: fuzz > 0 || loose > 0}, true
+			}
+		}
+	}
+	return match{}, false
+}
+
+// trimContext drops up to fuzz context lines from both ends of a hunk.
+// It reports false when the hunk has no more context to drop.
+func trimContext(lines []Line, fuzz int) ([]Line, int, bool) {
+	lead, trail := 0, 0
+	for lead < fuzz && lead < len(lines) && lines[lead].Kind == Context {
+		lead++
+	}
+	for trail < fuzz && trail < len(lines)-lead && lines[len(lines)-1-trail].Kind == Context {
+		trail++
+	}
+	if fuzz > 0 && lead < fuzz && trail < fuzz {
+		return nil, 0, false
+	}
+	return lines[lead : len(lines)-trail], lead, true
+}
+
+// search finds old in lines at or after start, trying positions by distance from want
+func search(lines, old []string, start, want int, equal func(a, b string) bool) (int, bool) {
+	last := len(lines) - len(old)
+	want = min(max(want, start), max(last, start))
+	for d := 0; want-d >= start || want+d <= last; d++ {
+		if pos := want - d; pos >= start && pos <= last && matches(lines, old, pos, equal) {
+			return pos, true
+		}
+		if pos := want + d; d > 0 && pos >= start && pos <= last && matches(lines, old, pos, equal) {
+			return pos, true
+		}
+	}
+	return 0, false
+}
+
+func matches(lines, old []string, pos int, equal func(a, b string) bool) bool {
+	for i, l := range old {
+		if !equal(lines[pos+i], l) {
+			return false
+		}
+	}
+	return true
+}
+
+func exactEqual(a, b string) bool {
+	return a == b
+}
+
+// looseEqual compares lines ignoring differences in whitespace
+func looseEqual(a, b string) bool {
+	return strings.Join(strings.Fields(a), " ") == strings.Join(strings.Fields(b), " ")
+}
+
+// splitLines splits text into lines and reports whether it ends with a newline
+func splitLines(text string) ([]string, bool) {
+	if text == "" {
+		return nil, true
+	}
+	eol := strings.HasSuffix(text, "\n")
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n"), eol
+}
+
+func joinLines(lines []string, eol bool) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	text := strings.Join(lines, "\n")
+	if eol {
+		text += "\n"
+	}
+	return text
+}
@@ -0,0 +1,171 @@
+// Package patch applies unified diffs, such as the ```diff blocks models answer
+// change requests with, to the files below a root directory.
+//
+// Model-written diffs are often slightly off: hunk line numbers drift, counts
+// are wrong or missing, indentation of context lines differs. Hunks are
+// therefore located by their content, nearest to the position the header
+// claims, ignoring whitespace differences and up to Patcher.Fuzz context
+// lines at either end. Hunks that cannot be located are reported as Rejects.
+package patch
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DevNull is the path of the missing side of a created or deleted file
+const DevNull = "/dev/null"
+
+// LineKind is the first character of a hunk line
+type LineKind byte
+
+// Enumerate hunk line kinds
+const (
+	Context LineKind = ' '
+	Delete  LineKind = '-'
+	Insert  LineKind = '+'
+)
+
+// Line is a single line of a hunk, without the newline
+type Line struct {
+	Kind LineKind
+	Text string
+}
+
+// Hunk is a "@@ -a,b +c,d @@" section of a diff.
+// Start and line counts are 0 when the header omits them.
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Section  string // Text after the closing "@@", usually the enclosing function
+	Lines    []Line
+}
+
+// Header formats the "@@ -a,b +c,d @@ section" line of the hunk
+func (h *Hunk) Header() string {
+	header := fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+	if h.Section != "" {
+		header += " " + h.Section
+	}
+	return header
+}
+
+// String formats the hunk in unified diff format
+func (h *Hunk) String() string {
+	var sb strings.Builder
+	sb.WriteString(h.Header() + "\n")
+	for _, l := range h.Lines {
+		sb.WriteByte(byte(l.Kind))
+		sb.WriteString(l.Text)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// FileDiff holds the hunks of a single file
+type FileDiff struct {
+	OldPath string // Path before the change, DevNull for a created file
+	NewPath string // Path after the change, DevNull for a deleted file
+	Hunks   []*Hunk
+}
+
+// Path returns the path of the file the diff applies to
+func (d *FileDiff) Path() string {
+	if d.NewPath == "" || d.NewPath == DevNull {
+		return d.OldPath
+	}
+	return d.NewPath
+}
+
+var hunkHeaderRegExp = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@ ?(.*)$`)
+
+// Parse parses a unified diff into per-file diffs.
+// Lines outside of file headers and hunks, such as "diff --git" or "index" lines
+// and surrounding prose, are ignored. A bare "@@ ... @@" header is accepted.
+func Parse(text string) ([]*FileDiff, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	var files []*FileDiff
+	var file *FileDiff
+	var hunk *Hunk
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			file = &FileDiff{OldPath: parsePath(line[4:]), NewPath: parsePath(lines[i+1][4:])}
+			files = append(files, file)
+			hunk = nil
+			i++
+		case strings.HasPrefix(line, "@@"):
+			if file == nil {
+				// Hunks without file headers, the caller has to name the file
+				file = &FileDiff{}
+				files = append(files, file)
+			}
+			hunk = parseHunkHeader(line)
+			file.Hunks = append(file.Hunks, hunk)
+		case hunk == nil:
+		case line == "":
+			// Models often drop the leading space of empty context lines
+			hunk.Lines = append(hunk.Lines, Line{Kind: Context})
+		case line[0] == ' ' || line[0] == '-' || line[0] == '+':
+			hunk.Lines = append(hunk.Lines, Line{Kind: LineKind(line[0]), Text: line[1:]})
+		case line[0] == '\\':
+			// "\ No newline at end of file"
+		default:
+			hunk = nil
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no unified diff found")
+	}
+	for _, f := range files {
+		for _, h := range f.Hunks {
+			// Trailing empty context lines are usually the end of the text, not part of the hunk
+			for n := len(h.Lines); n > 0 && h.Lines[n-1] == (Line{Kind: Context}); n-- {
+				h.Lines = h.Lines[:n-1]
+			}
+		}
+	}
+	return files, nil
+}
+
+// parsePath strips the timestamp and the a/ or b/ prefix from a file header path
+func parsePath(s string) string {
+	s, _, _ = strings.Cut(s, "\t")
+	s = strings.TrimSpace(s)
+	if s == DevNull {
+		return s
+	}
+	if strings.HasPrefix(s, "a/") || strings.HasPrefix(s, "b/") {
+		s = s[2:]
+	}
+	return s
+}
+
+// parseHunkHeader parses "@@ -a,b +c,d @@ section"; a malformed header yields a hunk without positions
+func parseHunkHeader(line string) *Hunk {
+	match := hunkHeaderRegExp.FindStringSubmatch(line)
+	if match == nil {
+		return &Hunk{}
+	}
+	atoi := func(s string, def int) int {
+		if s == "" {
+			return def
+		}
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	return &Hunk{
+		OldStart: atoi(match[1], 0),
+		OldLines: atoi(match[2], 1),
+		NewStart: atoi(match[3], 0),
+		NewLines: atoi(match[4], 1),
+		Section:  strings.TrimSpace(match[5]),
+	}
+}
@@ -0,0 +1,256 @@
+package patch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eslider/go-ollama"
+)
+
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		if err := ollama.WriteFile(filepath.Join(root, name), []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func readFile(t *testing.T, root, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(root, name))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	return string(data)
+}
+
+const mainGo = `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("hello")
+}
+
+func helper() int {
+	return 1
+}
+`
+
+func TestParse(t *testing.T) {
+	diffs, err := Parse("diff --git a/main.go b/main.go\nindex 123..456 100644\n" +
+		"--- a/main.go\t2024-01-01\n+++ b/main.go\n@@ -5,3 +5,3 @@ func main() {\n func main() {\n-\tfmt.Println(\"hello\")\n+\tfmt.Println(\"bye\")\n }\n" +
+		"--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1 @@\n+new\n")
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if len(diffs) != 2 {
+		t.Fatalf("got %d file diffs, want 2", len(diffs))
+	}
+	d := diffs[0]
+	if d.OldPath != "main.go" || d.NewPath != "main.go" {
+		t.Errorf("paths = %q, %q", d.OldPath, d.NewPath)
+	}
+	h := d.Hunks[0]
+	if h.OldStart != 5 || h.OldLines != 3 || h.Section != "func main() {" || len(h.Lines) != 4 {
+		t.Errorf("hunk = %+v", h)
+	}
+	if h.Lines[1] != (Line{Kind: Delete, Text: "\tfmt.Println(\"hello\")"}) {
+		t.Errorf("line 1 = %+v", h.Lines[1])
+	}
+	if diffs[1].OldPath != DevNull || diffs[1].Path() != "new.txt" || diffs[1].Hunks[0].NewLines != 1 {
+		t.Errorf("new file diff = %+v", diffs[1])
+	}
+}
+
+func TestParse_NoDiff(t *testing.T) {
+	if _, err := Parse("just some prose"); err == nil {
+		t.Error("expected error for text without a diff")
+	}
+}
+
+func TestApply_ExactAndShifted(t *testing.T) {
+	root := writeTree(t, map[string]string{"main.go": mainGo})
+	// Line numbers are off by two, as models often write them
+	diff := "--- a/main.go\n+++ b/main.go\n" +
+		"@@ -3,3 +3,3 @@\n func main() {\n-\tfmt.Println(\"hello\")\n+\tfmt.Println(\"bye\")\n }\n" +
+		"@@ -11,2 +11,2 @@\n func helper() int {\n-\treturn 1\n+\treturn 2\n"
+	diffs, err := Parse(diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := New(root).Apply(diffs)
+	if err != nil {
+		t.Fatalf("Apply error: %v", err)
+	}
+	if len(res.Rejects()) != 0 || res.Files[0].Applied != 2 {
+		t.Fatalf("result = %+v", res.Files[0])
+	}
+	want := strings.NewReplacer(`"hello"`, `"bye"`, "return 1", "return 2").Replace(mainGo)
+	if got := readFile(t, root, "main.go"); got != want {
+		t.Errorf("main.go =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestApply_WhitespaceAndFuzz(t *testing.T) {
+	root := writeTree(t, map[string]string{"main.go": mainGo})
+	// Context indented with spaces instead of tabs, and a wrong first context line
+	diff := "--- main.go\n+++ main.go\n@@ -1,1 +1,1 @@\n // not in the file\n func main() {\n-    fmt.Println(\"hello\")\n+\tfmt.Println(\"fuzzy\")\n }\n"
+	diffs, err := Parse(diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := New(root).Apply(diffs)
+	if err != nil {
+		t.Fatalf("Apply error: %v", err)
+	}
+	if len(res.Rejects()) != 0 || res.Files[0].Fuzzy != 1 {
+		t.Fatalf("result = %+v", res.Files[0])
+	}
+	if got := readFile(t, root, "main.go"); !strings.Contains(got, "\tfmt.Println(\"fuzzy\")\n}\n") {
+		t.Errorf("main.go =\n%s", got)
+	}
+
+	// Without fuzz the wrong context line rejects the hunk
+	diffs, _ = Parse(strings.ReplaceAll(diff, "fuzzy", "strict"))
+	res, err = (&Patcher{Root: root}).Apply(diffs)
+	if err != nil {
+		t.Fatalf("Apply error: %v", err)
+	}
+	if len(res.Rejects()) != 1 {
+		t.Errorf("rejects = %v, want 1", res.Rejects())
+	}
+}
+
+func TestApply_RejectsAreStructured(t *testing.T) {
+	root := writeTree(t, map[string]string{"main.go": mainGo})
+	diff := "--- a/main.go\n+++ b/main.go\n" +
+		"@@ -1,2 +1,2 @@\n-package lib\n+package other\n" +
+		"@@ -9,2 +9,2 @@\n func helper() int {\n-\treturn 1\n+\treturn 3\n" +
+		"--- a/../outside.go\n+++ b/../outside.go\n@@ -1 +1 @@\n-a\n+b\n" +
+		"--- a/missing.go\n+++ b/missing.go\n@@ -1 +1 @@\n-a\n+b\n"
+	diffs, err := Parse(diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := New(root).Apply(diffs)
+	if err != nil {
+		t.Fatalf("Apply error: %v", err)
+	}
+	rejects := res.Rejects()
+	if len(rejects) != 3 {
+		t.Fatalf("got %d rejects, want 3: %v", len(rejects), rejects)
+	}
+	if rejects[0].Path != "main.go" || rejects[0].Index != 0 || rejects[0].Reason != "context not found" {
+		t.Errorf("reject[0] = %v", rejects[0])
+	}
+	if rejects[1].Reason != "path escapes the root directory" {
+		t.Errorf("reject[1] = %v", rejects[1])
+	}
+	if rejects[2].Reason != "file does not exist" {
+		t.Errorf("reject[2] = %v", rejects[2])
+	}
+	if !strings.Contains(rejects[0].Error(), "main.go: hunk #1 @@ -1,2 +1,2 @@") {
+		t.Errorf("Error() = %q", rejects[0].Error())
+	}
+	// The hunk that applied is written anyway
+	if got := readFile(t, root, "main.go"); !strings.Contains(got, "return 3") {
+		t.Errorf("applied hunk not written:\n%s", got)
+	}
+}
+
+func TestApplyText_CreateAndDelete(t *testing.T) {
+	root := writeTree(t, map[string]string{"old.txt": "a\nb\n"})
+	answer := "Here is the change:\n\n```diff\n--- /dev/null\n+++ b/docs/new.md\n@@ -0,0 +1,2 @@\n+# Title\n+text\n" +
+		"--- a/old.txt\n+++ /dev/null\n@@ -1,2 +0,0 @@\n-a\n-b\n```\n\nAnd some Go:\n\n```go\npackage x\n```\n"
+
+	res, err := New(root).ApplyText(answer)
+	if err != nil {
+		t.Fatalf("ApplyText error: %v", err)
+	}
+	if len(res.Files) != 2 || !res.Files[0].Created || !res.Files[1].Deleted {
+		t.Fatalf("result = %+v", res.Files)
+	}
+	if got := readFile(t, root, "docs/new.md"); got != "# Title\ntext\n" {
+		t.Errorf("new.md = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "old.txt")); !os.IsNotExist(err) {
+		t.Error("old.txt still exists")
+	}
+}
+
+func TestApplyBlocks_FilenameAttrAndDryRun(t *testing.T) {
+	root := writeTree(t, map[string]string{"a.txt": "one\ntwo\n"})
+	blocks := []*ollama.CodeBlock{
+		{Type: "diff", Info: "diff filename=a.txt", Code: "@@ -1,2 +1,2 @@\n one\n-two\n+2\n"},
+		{Type: "go", Code: "package x\n"},
+	}
+
+	p := New(root)
+	p.DryRun = true
+	res, err := p.ApplyBlocks(blocks)
+	if err != nil {
+		t.Fatalf("ApplyBlocks error: %v", err)
+	}
+	if len(res.Files) != 1 || res.Files[0].Path != "a.txt" || res.Files[0].Applied != 1 {
+		t.Fatalf("result = %+v", res.Files)
+	}
+	if got := readFile(t, root, "a.txt"); got != "one\ntwo\n" {
+		t.Errorf("dry run changed a.txt: %q", got)
+	}
+}
+
+func TestApply_CreateOverExisting(t *testing.T) {
+	root := writeTree(t, map[string]string{"new.txt": "keep\n"})
+	diffs, err := Parse("--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1 @@\n+replaced\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := New(root).Apply(diffs)
+	if err != nil {
+		t.Fatalf("Apply error: %v", err)
+	}
+	rejects := res.Rejects()
+	if len(rejects) != 1 || rejects[0].Reason != "file already exists" || res.Files[0].Created {
+		t.Fatalf("result = %+v", res.Files)
+	}
+	if got := readFile(t, root, "new.txt"); got != "keep\n" {
+		t.Errorf("new.txt = %q, want it untouched", got)
+	}
+}
+
+func TestApply_RefusesSymlinkEscape(t *testing.T) {
+	root := t.TempDir()
+	outside := writeTree(t, map[string]string{"a.txt": "a\n"})
+	if err := os.Symlink(outside, filepath.Join(root, "out")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	for _, diff := range []string{
+		"--- a/out/a.txt\n+++ b/out/a.txt\n@@ -1 +1 @@\n-a\n+b\n",
+		"--- /dev/null\n+++ b/out/new.txt\n@@ -0,0 +1 @@\n+new\n",
+	} {
+		diffs, err := Parse(diff)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res, err := New(root).Apply(diffs); err == nil && res.Files[0].Applied > 0 {
+			t.Errorf("Apply through a symlink out of the root succeeded: %+v", res.Files)
+		}
+	}
+	if got := readFile(t, outside, "a.txt"); got != "a\n" {
+		t.Errorf("a.txt outside the root = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new.txt")); !os.IsNotExist(err) {
+		t.Errorf("file created outside the root: %v", err)
+	}
+}
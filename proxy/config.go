@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/eslider/go-ollama"
+)
+
+// DefaultListen is the address the ollama-proxy command listens on when Config.Listen is empty.
+// It is only reachable from the local host; listen on ":8080" to serve the network.
+const DefaultListen = "127.0.0.1:8080"
+
+// DefaultMaxBodyBytes limits the size of a request body when Config.MaxBodyBytes is 0.
+// It leaves room for a few base64 images.
+const DefaultMaxBodyBytes = 32 << 20
+
+// Config configures a Handler, usually loaded from a JSON file by LoadConfig:
+//
+//	{
+//	  "upstream": "https://ai.example.com/ollama/api/generate",
+//	  "keys": {
+//	    "sk-team-a": "owui-token-of-team-a",
+//	    "sk-team-b": "owui-token-of-team-b"
+//	  }
+//	}
+type Config struct {
+	Upstream       string            `json:"upstream"`                  // URL or DSN string (see ollama.ParseDSN) of the Ollama or Open WebUI API; local Ollama if empty
+	Backend        ollama.Backend    `json:"backend,omitempty"`         // DSN backend of Upstream; detected from the URL if empty, must match the scheme of a DSN string
+	Endpoints      map[string]string `json:"endpoints,omitempty"`       // Upstream endpoint paths overriding the defaults, see ollama.DSN.Endpoints
+	Token          string            `json:"token,omitempty"`           // Upstream token of every caller when Keys is empty
+	Keys           map[string]string `json:"keys,omitempty"`            // Caller API key to upstream DSN token; required unless AllowAnonymous
+	AllowAnonymous bool              `json:"allow_anonymous,omitempty"` // Let every caller in with Token when Keys is empty, exposing the upstream to anyone reaching the proxy
+	MaxBodyBytes   int64             `json:"max_body_bytes,omitempty"`  // Largest request body accepted, DefaultMaxBodyBytes if 0
+	Listen         string            `json:"listen,omitempty"`          // Address of the ollama-proxy command, DefaultListen if empty
+}
+
+// LoadConfig reads a JSON Config file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read proxy config: %w", err)
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to decode proxy config %s: %w", path, err)
+	}
+	return &config, nil
+}
+
+// dsn returns the upstream DSN of a caller whose key maps to token
+func (c *Config) dsn(token string) (*ollama.DSN, error) {
+	if scheme, _, _ := strings.Cut(c.Upstream, "://"); strings.Contains(scheme, "+") {
+		d, err := ollama.ParseDSN(c.Upstream)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upstream: %w", err)
+		}
+		if c.Backend != "" && c.Backend != d.Backend {
+			return nil, fmt.Errorf("invalid upstream: backend %q conflicts with the %q backend of the DSN", c.Backend, d.Backend)
+		}
+		if token != "" {
+			d.Token = token
+		}
+		for name, path := range c.Endpoints {
+			if d.Endpoints == nil {
+				d.Endpoints = map[string]string{}
+			}
+			d.Endpoints[name] = path
+		}
+		return d, nil
+	}
+	return &ollama.DSN{URL: c.Upstream, Token: token, Backend: c.Backend, Endpoints: c.Endpoints}, nil
+}
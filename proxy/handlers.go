@@ -0,0 +1,535 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eslider/go-ollama"
+)
+
+// stringList is a JSON string or array of strings, as in "stop", "prompt" and "input"
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		*l = stringList{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return errors.New("expected a string or an array of strings")
+	}
+	*l = list
+	return nil
+}
+
+// samplingParams are the request parameters shared by chat and text completions
+type samplingParams struct {
+	Model         string `json:"model"`
+	Stream        bool   `json:"stream"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+	Temperature         *float64   `json:"temperature"`
+	TopP                *float64   `json:"top_p"`
+	Seed                *int       `json:"seed"`
+	MaxTokens           *int       `json:"max_tokens"`
+	MaxCompletionTokens *int       `json:"max_completion_tokens"`
+	Stop                stringList `json:"stop"`
+	PresencePenalty     *float64   `json:"presence_penalty"`
+}
+
+// options translates the parameters to the model options; frequency_penalty is not
+// forwarded because RequestOptions.FrequencyPenalty only holds whole numbers
+func (p samplingParams) options() *ollama.RequestOptions {
+	maxTokens := p.MaxCompletionTokens
+	if maxTokens == nil {
+		maxTokens = p.MaxTokens
+	}
+	return &ollama.RequestOptions{
+		Temperature:     p.Temperature,
+		TopP:            p.TopP,
+		Seed:            p.Seed,
+		NumPredict:      maxTokens,
+		Stop:            p.Stop,
+		PresencePenalty: p.PresencePenalty,
+	}
+}
+
+// includeUsage reports whether a streaming caller asked for a last chunk with the token counts
+func (p samplingParams) includeUsage() bool {
+	return p.StreamOptions != nil && p.StreamOptions.IncludeUsage
+}
+
+type chatCompletionRequest struct {
+	samplingParams
+	Messages       []chatMessage `json:"messages"`
+	Tools          []ollama.Tool `json:"tools"`
+	ResponseFormat *struct {
+		Type       string `json:"type"` // "text", "json_object" or "json_schema"
+		JSONSchema *struct {
+			Schema json.RawMessage `json:"schema"`
+		} `json:"json_schema"`
+	} `json:"response_format"`
+}
+
+type chatMessage struct {
+	Role       string         `json:"role"`
+	Content    messageContent `json:"content"`
+	ToolCalls  []toolCall     `json:"tool_calls,omitempty"`
+	ToolCallID string         `json:"tool_call_id,omitempty"`
+}
+
+// messageContent is the text and images of a message: a string, or a list of text and image_url parts
+type messageContent struct {
+	Text   string
+	Images []ollama.RequestImage
+}
+
+func (c *messageContent) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" || json.Unmarshal(data, &c.Text) == nil {
+		return nil
+	}
+	var parts []struct {
+		Type     string `json:"type"`
+		Text     string `json:"text"`
+		ImageURL struct {
+			URL string `json:"url"`
+		} `json:"image_url"`
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return errors.New("expected a string or an array of content parts")
+	}
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			c.Text += part.Text
+		case "image_url":
+			image, err := decodeDataURL(part.ImageURL.URL)
+			if err != nil {
+				return err
+			}
+			c.Images = append(c.Images, image)
+		default:
+			return fmt.Errorf("unsupported content part type %q", part.Type)
+		}
+	}
+	return nil
+}
+
+func (c messageContent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.Text)
+}
+
+// decodeDataURL returns the bytes of a base64 data URL; the upstream cannot fetch remote images
+func decodeDataURL(url string) ([]byte, error) {
+	header, data, ok := strings.Cut(url, ",")
+	if !strings.HasPrefix(header, "data:") || !strings.HasSuffix(header, ";base64") || !ok {
+		return nil, errors.New("only base64 data URLs are supported as image_url")
+	}
+	image, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image data URL: %w", err)
+	}
+	return image, nil
+}
+
+type toolCall struct {
+	Index    *int   `json:"index,omitempty"` // Set in streamed chunks
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"` // JSON encoded arguments object
+	} `json:"function"`
+}
+
+// chatRequest translates a chat completion request
+func (req *chatCompletionRequest) chatRequest() (ollama.ChatRequest, error) {
+	request := ollama.ChatRequest{
+		Model:   req.Model,
+		Tools:   req.Tools,
+		Options: req.options(),
+	}
+	if f := req.ResponseFormat; f != nil {
+		switch {
+		case f.Type == "json_schema" && f.JSONSchema != nil:
+			request.Format = new(ollama.RequestFormat(f.JSONSchema.Schema))
+		case f.Type == "json_object":
+			request.Format = new(ollama.FormatJson)
+		}
+	}
+
+	toolNames := map[string]string{} // Tool call IDs to the names of the called tools
+	for _, m := range req.Messages {
+		role := ollama.ChatRole(m.Role)
+		if role == "developer" {
+			role = ollama.RoleSystem
+		}
+		message := ollama.ChatMessage{Role: role, Content: m.Content.Text, Images: m.Content.Images, ToolCallID: m.ToolCallID}
+		for _, call := range m.ToolCalls {
+			// Clients send "" for calls without arguments
+			arguments := call.Function.Arguments
+			if strings.TrimSpace(arguments) == "" {
+				arguments = "{}"
+			} else if !json.Valid([]byte(arguments)) {
+				return request, fmt.Errorf("invalid arguments of tool call %q: not valid JSON", call.ID)
+			}
+			toolNames[call.ID] = call.Function.Name
+			message.ToolCalls = append(message.ToolCalls, ollama.ToolCall{
+				ID:       call.ID,
+				Function: ollama.ToolCallFunction{Name: call.Function.Name, Arguments: json.RawMessage(arguments)},
+			})
+		}
+		if role == ollama.RoleTool {
+			message.ToolName = toolNames[m.ToolCallID]
+		}
+		request.Messages = append(request.Messages, message)
+	}
+	return request, nil
+}
+
+// chatCompletion is a chat.completion, or a chat.completion.chunk when streaming
+type chatCompletion struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"`
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []chatChoice `json:"choices"`
+	Usage   *usage       `json:"usage,omitempty"`
+}
+
+type chatChoice struct {
+	Index        int        `json:"index"`
+	Message      *chatReply `json:"message,omitempty"`
+	Delta        *chatReply `json:"delta,omitempty"`
+	FinishReason *string    `json:"finish_reason"`
+}
+
+type chatReply struct {
+	Role             string     `json:"role,omitempty"`
+	Content          string     `json:"content"`
+	ReasoningContent string     `json:"reasoning_content,omitempty"`
+	ToolCalls        []toolCall `json:"tool_calls,omitempty"`
+}
+
+type usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// newUsage returns the token counts of the final metrics
+func newUsage(m ollama.Metrics) *usage {
+	u := &usage{}
+	if m.PromptEvalCount != nil {
+		u.PromptTokens = *m.PromptEvalCount
+	}
+	if m.EvalCount != nil {
+		u.CompletionTokens = *m.EvalCount
+	}
+	u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	return u
+}
+
+// finishReason translates the done reason of the final response
+func finishReason(doneReason *string, toolCalls bool) *string {
+	switch {
+	case toolCalls:
+		return new("tool_calls")
+	case doneReason != nil && *doneReason == "length":
+		return new("length")
+	}
+	return new("stop")
+}
+
+// chatCompletions serves POST /v1/chat/completions with Client.ChatContext
+func (h *Handler) chatCompletions(w http.ResponseWriter, r *http.Request, client *ollama.Client) {
+	var req chatCompletionRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	request, err := req.chatRequest()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "", "Invalid request body: "+err.Error())
+		return
+	}
+	completion := chatCompletion{ID: newID("chatcmpl-"), Object: "chat.completion", Created: time.Now().Unix(), Model: req.Model}
+	var sse *sseWriter
+	if req.Stream {
+		sse = &sseWriter{w: w}
+		completion.Object = "chat.completion.chunk"
+	}
+
+	var reply chatReply
+	var final ollama.ChatResponse
+	var calls []ollama.ToolCall
+	request.OnJson = func(res ollama.ChatResponse) error {
+		if res.Done != nil && *res.Done {
+			final = res
+		}
+		if res.Message == nil {
+			return nil
+		}
+		calls = append(calls, res.Message.ToolCalls...)
+		if sse == nil {
+			reply.Content += res.Message.Content
+			reply.ReasoningContent += res.Message.Thinking
+			return nil
+		}
+		if res.Message.Content == "" && res.Message.Thinking == "" {
+			return nil
+		}
+		delta := &chatReply{Content: res.Message.Content, ReasoningContent: res.Message.Thinking}
+		if !sse.started {
+			delta.Role = string(ollama.RoleAssistant)
+		}
+		return sse.send(completion.with(chatChoice{Delta: delta}))
+	}
+	if err := client.ChatContext(r.Context(), request); err != nil {
+		fail(w, sse, err)
+		return
+	}
+
+	for i, call := range calls {
+		tc := toolCall{ID: call.ID, Type: "function"}
+		if tc.ID == "" {
+			tc.ID = newID("call_")
+		}
+		tc.Function.Name = call.Function.Name
+		tc.Function.Arguments = string(call.Function.Arguments)
+		if sse != nil {
+			tc.Index = new(i)
+		}
+		reply.ToolCalls = append(reply.ToolCalls, tc)
+	}
+	reason := finishReason(final.DoneReason, len(calls) > 0)
+
+	if sse == nil {
+		reply.Role = string(ollama.RoleAssistant)
+		completion.Choices = []chatChoice{{Message: &reply, FinishReason: reason}}
+		completion.Usage = newUsage(final.Metrics)
+		writeJSON(w, http.StatusOK, completion)
+		return
+	}
+	if len(reply.ToolCalls) > 0 {
+		if err := sse.send(completion.with(chatChoice{Delta: &chatReply{Role: string(ollama.RoleAssistant), ToolCalls: reply.ToolCalls}})); err != nil {
+			return
+		}
+	}
+	_ = sse.send(completion.with(chatChoice{Delta: &chatReply{}, FinishReason: reason}))
+	if req.includeUsage() {
+		last := completion
+		last.Choices, last.Usage = []chatChoice{}, newUsage(final.Metrics)
+		_ = sse.send(last)
+	}
+	_ = sse.done()
+}
+
+// with returns a copy of the completion with a single choice
+func (c chatCompletion) with(choice chatChoice) chatCompletion {
+	c.Choices = []chatChoice{choice}
+	return c
+}
+
+type completionRequest struct {
+	samplingParams
+	Prompt stringList `json:"prompt"`
+	Suffix *string    `json:"suffix"`
+}
+
+// textCompletion is a text_completion, streamed or not
+type textCompletion struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"`
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []textChoice `json:"choices"`
+	Usage   *usage       `json:"usage,omitempty"`
+}
+
+type textChoice struct {
+	Index        int     `json:"index"`
+	Text         string  `json:"text"`
+	Logprobs     any     `json:"logprobs"`
+	FinishReason *string `json:"finish_reason"`
+}
+
+// completions serves POST /v1/completions with Client.Stream
+func (h *Handler) completions(w http.ResponseWriter, r *http.Request, client *ollama.Client) {
+	var req completionRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if len(req.Prompt) != 1 {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "", "Exactly one prompt is supported.")
+		return
+	}
+	completion := textCompletion{ID: newID("cmpl-"), Object: "text_completion", Created: time.Now().Unix(), Model: req.Model}
+	var sse *sseWriter
+	if req.Stream {
+		sse = &sseWriter{w: w}
+	}
+
+	var text strings.Builder
+	var final ollama.Response
+	request := ollama.Request{Model: req.Model, Prompt: req.Prompt[0], Suffix: req.Suffix, Options: req.options()}
+	for res, err := range client.Stream(r.Context(), request) {
+		if err != nil {
+			fail(w, sse, err)
+			return
+		}
+		if res.Done != nil && *res.Done {
+			final = res
+		}
+		if res.Response == nil || *res.Response == "" {
+			continue
+		}
+		if sse == nil {
+			text.WriteString(*res.Response)
+			continue
+		}
+		chunk := completion
+		chunk.Choices = []textChoice{{Text: *res.Response}}
+		if err := sse.send(chunk); err != nil {
+			return
+		}
+	}
+
+	reason := finishReason(final.DoneReason, false)
+	if sse == nil {
+		completion.Choices = []textChoice{{Text: text.String(), FinishReason: reason}}
+		completion.Usage = newUsage(final.Metrics)
+		writeJSON(w, http.StatusOK, completion)
+		return
+	}
+	chunk := completion
+	chunk.Choices = []textChoice{{FinishReason: reason}}
+	_ = sse.send(chunk)
+	if req.includeUsage() {
+		chunk.Choices, chunk.Usage = []textChoice{}, newUsage(final.Metrics)
+		_ = sse.send(chunk)
+	}
+	_ = sse.done()
+}
+
+type embeddingRequest struct {
+	Model          string     `json:"model"`
+	Input          stringList `json:"input"`
+	EncodingFormat string     `json:"encoding_format"` // "float" (default) or "base64"
+}
+
+type embeddingList struct {
+	Object string      `json:"object"`
+	Data   []embedding `json:"data"`
+	Model  string      `json:"model"`
+	Usage  usage       `json:"usage"`
+}
+
+type embedding struct {
+	Object    string `json:"object"`
+	Index     int    `json:"index"`
+	Embedding any    `json:"embedding"` // []float64, or base64 of little-endian float32s
+}
+
+// embeddings serves POST /v1/embeddings with Client.EmbedContext
+func (h *Handler) embeddings(w http.ResponseWriter, r *http.Request, client *ollama.Client) {
+	var req embeddingRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if req.EncodingFormat != "" && req.EncodingFormat != "float" && req.EncodingFormat != "base64" {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "", fmt.Sprintf("Unsupported encoding_format %q.", req.EncodingFormat))
+		return
+	}
+	res, err := client.EmbedContext(r.Context(), ollama.EmbedRequest{Model: req.Model, Input: req.Input})
+	if err != nil {
+		fail(w, nil, err)
+		return
+	}
+
+	list := embeddingList{Object: "list", Data: []embedding{}, Model: req.Model}
+	for i, values := range res.Embeddings {
+		var e any = values
+		if req.EncodingFormat == "base64" {
+			e = encodeFloat32s(values)
+		}
+		list.Data = append(list.Data, embedding{Object: "embedding", Index: i, Embedding: e})
+	}
+	list.Usage.PromptTokens = res.PromptEvalCount
+	list.Usage.TotalTokens = res.PromptEvalCount
+	writeJSON(w, http.StatusOK, list)
+}
+
+// encodeFloat32s encodes values as base64 of little-endian float32s, as OpenAI does
+func encodeFloat32s(values []float64) string {
+	buf := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(float32(v)))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+type modelObject struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+type modelList struct {
+	Object string        `json:"object"`
+	Data   []modelObject `json:"data"`
+}
+
+// listModels returns the installed models of the upstream
+func listModels(r *http.Request, client *ollama.Client) ([]modelObject, error) {
+	tags, err := client.TagsContext(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	models := make([]modelObject, 0, len(tags.Models))
+	for _, m := range tags.Models {
+		model := modelObject{ID: m.Name, Object: "model", OwnedBy: "ollama"}
+		if m.ModifiedAt != nil {
+			model.Created = m.ModifiedAt.Unix()
+		}
+		models = append(models, model)
+	}
+	return models, nil
+}
+
+// models serves GET /v1/models with Client.TagsContext
+func (h *Handler) models(w http.ResponseWriter, r *http.Request, client *ollama.Client) {
+	models, err := listModels(r, client)
+	if err != nil {
+		fail(w, nil, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, modelList{Object: "list", Data: models})
+}
+
+// model serves GET /v1/models/{model}
+func (h *Handler) model(w http.ResponseWriter, r *http.Request, client *ollama.Client) {
+	models, err := listModels(r, client)
+	if err != nil {
+		fail(w, nil, err)
+		return
+	}
+	name := r.PathValue("model")
+	for _, m := range models {
+		if m.ID == name || m.ID == name+":latest" {
+			writeJSON(w, http.StatusOK, m)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "invalid_request_error", "model_not_found", fmt.Sprintf("The model '%s' does not exist", name))
+}
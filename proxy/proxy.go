@@ -0,0 +1,229 @@
+// Package proxy serves an OpenAI-compatible API backed by an ollama.Client, so tools
+// that only speak the OpenAI API can use an Ollama or authenticated Open WebUI instance.
+// Handler serves /v1/chat/completions, /v1/completions, /v1/embeddings and /v1/models,
+// streams answers as server-sent events and reports failures as OpenAI error objects.
+// Caller API keys are mapped to upstream DSN tokens by the Config:
+//
+//	config, err := proxy.LoadConfig("proxy.json")
+//	handler, err := proxy.New(*config)
+//	err = http.ListenAndServe(proxy.DefaultListen, handler)
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/eslider/go-ollama"
+)
+
+// Handler is an http.Handler serving the OpenAI API from the upstream of its Config.
+// Safe for concurrent use.
+type Handler struct {
+	config Config
+	opts   []ollama.Option
+	mux    *http.ServeMux
+
+	mu      sync.Mutex
+	clients map[string]*ollama.Client // Upstream clients by token
+}
+
+// New creates a Handler. The options configure the upstream clients, e.g. TLS or retries;
+// an invalid upstream DSN or option error is reported here. A config without Keys is
+// refused unless AllowAnonymous is set.
+func New(config Config, opts ...ollama.Option) (*Handler, error) {
+	if len(config.Keys) == 0 && !config.AllowAnonymous {
+		return nil, errors.New("proxy config has no keys: add caller keys or set allow_anonymous to let every caller in")
+	}
+	dsn, err := config.dsn(config.Token)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ollama.NewClient(dsn, opts...); err != nil {
+		return nil, fmt.Errorf("invalid upstream client options: %w", err)
+	}
+	h := &Handler{
+		config:  config,
+		opts:    opts,
+		mux:     http.NewServeMux(),
+		clients: map[string]*ollama.Client{},
+	}
+	h.handle("POST /v1/chat/completions", h.chatCompletions)
+	h.handle("POST /v1/completions", h.completions)
+	h.handle("POST /v1/embeddings", h.embeddings)
+	h.handle("GET /v1/models", h.models)
+	h.handle("GET /v1/models/{model...}", h.model)
+	h.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "invalid_request_error", "unknown_url", fmt.Sprintf("Unknown request URL: %s %s", r.Method, r.URL.Path))
+	})
+	return h, nil
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// handle registers an endpoint that requires a known API key
+func (h *Handler) handle(pattern string, fn func(w http.ResponseWriter, r *http.Request, client *ollama.Client)) {
+	h.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		client, ok := h.client(r)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "invalid_request_error", "invalid_api_key", "Incorrect API key provided.")
+			return
+		}
+		limit := h.config.MaxBodyBytes
+		if limit <= 0 {
+			limit = DefaultMaxBodyBytes
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		fn(w, r, client)
+	})
+}
+
+// client returns the upstream client for the API key of r, false if the key is unknown
+func (h *Handler) client(r *http.Request) (*ollama.Client, bool) {
+	token := h.config.Token
+	if len(h.config.Keys) > 0 || !h.config.AllowAnonymous {
+		key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			return nil, false
+		}
+		if token, ok = h.config.Keys[strings.TrimSpace(key)]; !ok {
+			return nil, false
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	client, ok := h.clients[token]
+	if !ok {
+		// The upstream and the options were checked by New
+		dsn, _ := h.config.dsn(token)
+		client = ollama.NewOpenWebUiClient(dsn, h.opts...)
+		h.clients[token] = client
+	}
+	return client, true
+}
+
+// errorResponse is an OpenAI error object
+type errorResponse struct {
+	Error apiError `json:"error"`
+}
+
+type apiError struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    *string `json:"code"`
+}
+
+func newErrorResponse(typ, code, message string) errorResponse {
+	e := errorResponse{Error: apiError{Message: message, Type: typ}}
+	if code != "" {
+		e.Error.Code = &code
+	}
+	return e
+}
+
+// writeError writes an OpenAI error object with status
+func writeError(w http.ResponseWriter, status int, typ, code, message string) {
+	writeJSON(w, status, newErrorResponse(typ, code, message))
+}
+
+// upstreamError maps a Client error to a status and OpenAI error object
+func upstreamError(err error) (int, errorResponse) {
+	var apiErr *ollama.APIError
+	switch {
+	case errors.Is(err, ollama.ErrModelNotFound):
+		return http.StatusNotFound, newErrorResponse("invalid_request_error", "model_not_found", err.Error())
+	case errors.Is(err, ollama.ErrContextOverflow):
+		return http.StatusBadRequest, newErrorResponse("invalid_request_error", "context_length_exceeded", err.Error())
+	case errors.Is(err, ollama.ErrUnauthorized):
+		// The caller's key was accepted, the upstream token it maps to was not
+		return http.StatusBadGateway, newErrorResponse("api_error", "upstream_unauthorized", err.Error())
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests:
+		return http.StatusTooManyRequests, newErrorResponse("rate_limit_error", "rate_limit_exceeded", err.Error())
+	case errors.As(err, &apiErr) && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500:
+		return apiErr.StatusCode, newErrorResponse("invalid_request_error", "", err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, newErrorResponse("api_error", "timeout", err.Error())
+	}
+	return http.StatusBadGateway, newErrorResponse("api_error", "", err.Error())
+}
+
+// writeJSON writes v as a JSON response with status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// sseWriter streams server-sent events, sending the headers with the first event
+type sseWriter struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+// send writes v as a data event and flushes it to the caller
+func (s *sseWriter) send(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.write("data: " + string(data) + "\n\n")
+}
+
+// done ends the stream
+func (s *sseWriter) done() error {
+	return s.write("data: [DONE]\n\n")
+}
+
+func (s *sseWriter) write(event string) error {
+	if !s.started {
+		s.started = true
+		s.w.Header().Set("Content-Type", "text/event-stream")
+		s.w.Header().Set("Cache-Control", "no-cache")
+		s.w.WriteHeader(http.StatusOK)
+	}
+	if _, err := fmt.Fprint(s.w, event); err != nil {
+		return err
+	}
+	return http.NewResponseController(s.w).Flush()
+}
+
+// fail reports err to the caller: as an error response if nothing was streamed yet,
+// else as an error event ending the stream
+func fail(w http.ResponseWriter, sse *sseWriter, err error) {
+	status, body := upstreamError(err)
+	if sse != nil && sse.started {
+		_ = sse.send(body)
+		return
+	}
+	writeJSON(w, status, body)
+}
+
+// decode reads the JSON request body into v, writing an error response if it is invalid
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "invalid_request_error", "request_too_large",
+				fmt.Sprintf("Request body exceeds the limit of %d bytes.", tooLarge.Limit))
+			return false
+		}
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "", "Invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// newID returns a random ID with prefix, e.g. "chatcmpl-"
+func newID(prefix string) string {
+	return prefix + rand.Text()
+}
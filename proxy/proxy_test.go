@@ -0,0 +1,417 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eslider/go-ollama"
+	"github.com/eslider/go-ollama/ollamatest"
+)
+
+// newUpstream starts a fake Open WebUI requiring the token "owui", with the model "m"
+func newUpstream(t *testing.T, model ollamatest.Model) *ollamatest.Server {
+	t.Helper()
+	upstream := ollamatest.NewServer()
+	t.Cleanup(upstream.Close)
+	upstream.Token = "owui"
+	upstream.AddModel("m", model)
+	upstream.AddModel("e", nil)
+	return upstream
+}
+
+// newProxy serves a Handler for upstreamURL letting in the key "sk-a", mapped to the token "owui"
+func newProxy(t *testing.T, upstreamURL string) *httptest.Server {
+	t.Helper()
+	h, err := New(Config{Upstream: upstreamURL, Keys: map[string]string{"sk-a": "owui", "sk-wrong": "nope"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// openAIClient is a client of the proxy speaking the OpenAI API
+func openAIClient(srv *httptest.Server, key string) *ollama.Client {
+	return ollama.NewOpenWebUiClient(&ollama.DSN{URL: srv.URL + "/v1", Token: key, Backend: ollama.BackendOpenAI})
+}
+
+// post sends body to path of the proxy with the key "sk-a" and returns the status and response body
+func post(t *testing.T, srv *httptest.Server, path, body string) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest("POST", srv.URL+path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer sk-a")
+	return do(t, req)
+}
+
+func do(t *testing.T, req *http.Request) (int, string) {
+	t.Helper()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+// events returns the data of the server-sent events of body
+func events(body string) []string {
+	var data []string
+	sc := bufio.NewScanner(strings.NewReader(body))
+	for sc.Scan() {
+		if d, ok := strings.CutPrefix(sc.Text(), "data: "); ok {
+			data = append(data, d)
+		}
+	}
+	return data
+}
+
+func TestHandler_ChatStream(t *testing.T) {
+	upstream := newUpstream(t, ollamatest.Canned("Hello there, world"))
+	srv := newProxy(t, upstream.URL+"/ollama/api/generate")
+
+	var text strings.Builder
+	var final ollama.ChatResponse
+	err := openAIClient(srv, "sk-a").Chat(ollama.ChatRequest{
+		Model:    "m",
+		Messages: []ollama.ChatMessage{{Role: ollama.RoleUser, Content: "hi there"}},
+		OnJson: func(res ollama.ChatResponse) error {
+			text.WriteString(res.Message.Content)
+			final = res
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text.String() != "Hello there, world" {
+		t.Errorf("text = %q", text.String())
+	}
+	if final.DoneReason == nil || *final.DoneReason != "stop" || final.EvalCount == nil || *final.EvalCount != 3 || *final.PromptEvalCount != 2 {
+		t.Errorf("final = %+v", final)
+	}
+
+	requests := upstream.Requests()
+	if len(requests) != 1 || requests[0].URL != "/ollama/api/chat" || requests[0].Header.Get("Authorization") != "Bearer owui" {
+		t.Errorf("upstream requests = %+v", requests)
+	}
+}
+
+func TestHandler_ChatCompletion(t *testing.T) {
+	upstream := newUpstream(t, ollamatest.Echo())
+	srv := newProxy(t, upstream.GenerateURL())
+
+	status, body := post(t, srv, "/v1/chat/completions", `{
+		"model": "m",
+		"messages": [
+			{"role": "developer", "content": "be brief"},
+			{"role": "user", "content": [{"type": "text", "text": "look "}, {"type": "text", "text": "here"}, {"type": "image_url", "image_url": {"url": "data:image/png;base64,iVBORw0K"}}]}
+		],
+		"max_tokens": 10, "temperature": 0, "stop": "END"
+	}`)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, body %s", status, body)
+	}
+	var completion chatCompletion
+	_ = json.Unmarshal([]byte(body), &completion)
+	if completion.Object != "chat.completion" || !strings.HasPrefix(completion.ID, "chatcmpl-") || completion.Model != "m" {
+		t.Errorf("completion = %s", body)
+	}
+	if c := completion.Choices[0]; c.Message.Content != "look here" || c.Message.Role != "assistant" || *c.FinishReason != "stop" {
+		t.Errorf("choice = %s", body)
+	}
+	if completion.Usage == nil || completion.Usage.CompletionTokens != 2 || completion.Usage.TotalTokens != 4 {
+		t.Errorf("usage = %+v", completion.Usage)
+	}
+
+	var sent ollama.ChatRequest
+	_ = json.Unmarshal([]byte(upstream.Requests()[0].Body), &sent)
+	if sent.Messages[0].Role != ollama.RoleSystem || len(sent.Messages[1].Images) != 1 {
+		t.Errorf("upstream messages = %+v", sent.Messages)
+	}
+	if *sent.Options.NumPredict != 10 || *sent.Options.Temperature != 0 || sent.Options.Stop[0] != "END" {
+		t.Errorf("upstream options = %+v", sent.Options)
+	}
+}
+
+func TestHandler_Completions(t *testing.T) {
+	upstream := newUpstream(t, ollamatest.Canned("one two"))
+	srv := newProxy(t, upstream.GenerateURL())
+
+	status, body := post(t, srv, "/v1/completions", `{"model":"m","prompt":"count"}`)
+	var completion textCompletion
+	_ = json.Unmarshal([]byte(body), &completion)
+	if status != http.StatusOK || completion.Object != "text_completion" || completion.Choices[0].Text != "one two" || completion.Usage.CompletionTokens != 2 {
+		t.Errorf("status %d, completion %s", status, body)
+	}
+
+	status, body = post(t, srv, "/v1/completions", `{"model":"m","prompt":["count"],"stream":true,"stream_options":{"include_usage":true}}`)
+	data := events(body)
+	want := []string{`"text":"one "`, `"text":"two"`, `"finish_reason":"stop"`, `"completion_tokens":2`, `[DONE]`}
+	if status != http.StatusOK || len(data) != len(want) {
+		t.Fatalf("status %d, events %q", status, data)
+	}
+	for i, w := range want {
+		if !strings.Contains(data[i], w) {
+			t.Errorf("event %d = %s, want it to contain %s", i, data[i], w)
+		}
+	}
+
+	if status, body = post(t, srv, "/v1/completions", `{"model":"m","prompt":["a","b"]}`); status != http.StatusBadRequest {
+		t.Errorf("two prompts: status %d, body %s", status, body)
+	}
+}
+
+func TestHandler_ToolCalls(t *testing.T) {
+	var sent []ollama.ChatRequest
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollama.ChatRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		sent = append(sent, req)
+		if len(sent) == 1 {
+			fmt.Fprint(w, `{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"add","arguments":{"a":1,"b":2}}}]},"done":false}`+"\n")
+			fmt.Fprint(w, `{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop"}`+"\n")
+			return
+		}
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":"3"},"done":true,"done_reason":"stop"}`+"\n")
+	}))
+	defer upstream.Close()
+	srv := newProxy(t, upstream.URL+"/api/generate")
+
+	type addArgs struct{ A, B int }
+	reg := ollama.NewToolRegistry()
+	ollama.RegisterTool(reg, "add", "Adds two numbers", func(ctx context.Context, args addArgs) (string, error) {
+		return fmt.Sprint(args.A + args.B), nil
+	})
+	messages, err := openAIClient(srv, "sk-a").RunTools(context.Background(), ollama.ChatRequest{
+		Model:    "m",
+		Messages: []ollama.ChatMessage{{Role: ollama.RoleUser, Content: "1+2?"}},
+	}, reg, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer := messages[len(messages)-1]; answer.Content != "3" {
+		t.Errorf("answer = %q", answer.Content)
+	}
+	if len(sent) != 2 || len(sent[0].Tools) != 1 {
+		t.Fatalf("upstream requests = %+v", sent)
+	}
+	call, result := sent[1].Messages[1], sent[1].Messages[2]
+	if call.ToolCalls[0].ID == "" || string(call.ToolCalls[0].Function.Arguments) != `{"a":1,"b":2}` {
+		t.Errorf("assistant message = %+v", call)
+	}
+	if result.Role != ollama.RoleTool || result.ToolName != "add" || result.ToolCallID != call.ToolCalls[0].ID || result.Content != "3" {
+		t.Errorf("tool message = %+v", result)
+	}
+}
+
+func TestHandler_EmptyToolArguments(t *testing.T) {
+	var sent ollama.ChatRequest
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&sent)
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":"ok"},"done":true,"done_reason":"stop"}`+"\n")
+	}))
+	defer upstream.Close()
+	srv := newProxy(t, upstream.URL+"/api/generate")
+
+	status, body := post(t, srv, "/v1/chat/completions", `{"model":"m","messages":[`+
+		`{"role":"assistant","content":null,"tool_calls":[{"id":"c1","type":"function","function":{"name":"now","arguments":""}}]},`+
+		`{"role":"tool","tool_call_id":"c1","content":"noon"}]}`)
+	if status != http.StatusOK {
+		t.Fatalf("status %d, body %s", status, body)
+	}
+	if len(sent.Messages) != 2 || string(sent.Messages[0].ToolCalls[0].Function.Arguments) != "{}" {
+		t.Errorf("upstream request = %+v", sent)
+	}
+}
+
+func TestHandler_Embeddings(t *testing.T) {
+	upstream := newUpstream(t, nil)
+	srv := newProxy(t, upstream.GenerateURL())
+
+	res, err := openAIClient(srv, "sk-a").Embed(ollama.EmbedRequest{Model: "e", Input: []string{"red apple", "green pear"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, input := range []string{"red apple", "green pear"} {
+		want := ollamatest.HashEmbedding(input, ollamatest.DefaultEmbedDim)
+		if fmt.Sprint(res.Embeddings[i]) != fmt.Sprint(want) {
+			t.Errorf("embedding %d = %v, want %v", i, res.Embeddings[i], want)
+		}
+	}
+
+	status, body := post(t, srv, "/v1/embeddings", `{"model":"e","input":"red apple","encoding_format":"base64"}`)
+	var list struct {
+		Data []struct {
+			Embedding string `json:"embedding"`
+		} `json:"data"`
+	}
+	_ = json.Unmarshal([]byte(body), &list)
+	raw, _ := base64.StdEncoding.DecodeString(list.Data[0].Embedding)
+	want := ollamatest.HashEmbedding("red apple", ollamatest.DefaultEmbedDim)
+	if status != http.StatusOK || len(raw) != 4*len(want) {
+		t.Fatalf("status %d, body %s", status, body)
+	}
+	if got := math.Float32frombits(binary.LittleEndian.Uint32(raw)); got != float32(want[0]) {
+		t.Errorf("first value = %v, want %v", got, want[0])
+	}
+}
+
+func TestHandler_Models(t *testing.T) {
+	upstream := newUpstream(t, ollamatest.Echo())
+	srv := newProxy(t, upstream.GenerateURL())
+
+	get := func(path string) (int, string) {
+		req, _ := http.NewRequest("GET", srv.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer sk-a")
+		return do(t, req)
+	}
+	status, body := get("/v1/models")
+	var list modelList
+	_ = json.Unmarshal([]byte(body), &list)
+	if status != http.StatusOK || list.Object != "list" || len(list.Data) != 2 || list.Data[0].Object != "model" {
+		t.Errorf("status %d, models %s", status, body)
+	}
+	if status, body = get("/v1/models/" + list.Data[0].ID); status != http.StatusOK || !strings.Contains(body, list.Data[0].ID) {
+		t.Errorf("status %d, model %s", status, body)
+	}
+	if status, body = get("/v1/models/missing"); status != http.StatusNotFound || !strings.Contains(body, "model_not_found") {
+		t.Errorf("status %d, body %s", status, body)
+	}
+}
+
+func TestHandler_Errors(t *testing.T) {
+	upstream := newUpstream(t, ollamatest.Canned("a b c"))
+	srv := newProxy(t, upstream.GenerateURL())
+
+	for _, tc := range []struct {
+		name   string
+		key    string
+		body   string
+		status int
+		code   string
+	}{
+		{"no key", "", `{"model":"m"}`, http.StatusUnauthorized, "invalid_api_key"},
+		{"unknown key", "sk-unknown", `{"model":"m"}`, http.StatusUnauthorized, "invalid_api_key"},
+		{"rejected upstream token", "sk-wrong", `{"model":"m"}`, http.StatusBadGateway, "upstream_unauthorized"},
+		{"unknown model", "sk-a", `{"model":"x"}`, http.StatusNotFound, "model_not_found"},
+		{"invalid body", "sk-a", `{"model":`, http.StatusBadRequest, ""},
+		{"invalid tool arguments", "sk-a", `{"model":"m","messages":[{"role":"assistant","tool_calls":[{"id":"c1","type":"function","function":{"name":"add","arguments":"{\"a\":"}}]}]}`, http.StatusBadRequest, ""},
+		{"remote image", "sk-a", `{"model":"m","messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]}]}`, http.StatusBadRequest, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", srv.URL+"/v1/chat/completions", strings.NewReader(tc.body))
+			if tc.key != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.key)
+			}
+			status, body := do(t, req)
+			var e errorResponse
+			if err := json.Unmarshal([]byte(body), &e); err != nil || status != tc.status || e.Error.Message == "" {
+				t.Fatalf("status %d, body %s", status, body)
+			}
+			if tc.code != "" && (e.Error.Code == nil || *e.Error.Code != tc.code) {
+				t.Errorf("code = %v, want %s", e.Error.Code, tc.code)
+			}
+		})
+	}
+
+	if status, body := post(t, srv, "/v2/nothing", `{}`); status != http.StatusNotFound || !strings.Contains(body, "unknown_url") {
+		t.Errorf("unknown URL: status %d, body %s", status, body)
+	}
+
+	// A failure after the first chunk ends the stream with an error event
+	upstream.Fail("chat", ollamatest.Fault{After: 1, StreamError: true, Message: "engine crashed"})
+	err := openAIClient(srv, "sk-a").Chat(ollama.ChatRequest{Model: "m", Messages: []ollama.ChatMessage{{Role: ollama.RoleUser, Content: "go"}}})
+	var apiErr *ollama.APIError
+	if !errors.As(err, &apiErr) || !strings.Contains(apiErr.Message, "engine crashed") {
+		t.Errorf("error = %v, want the upstream stream error", err)
+	}
+}
+
+func TestHandler_BodyLimit(t *testing.T) {
+	upstream := newUpstream(t, ollamatest.Canned("ok"))
+	h, err := New(Config{Upstream: upstream.GenerateURL(), Keys: map[string]string{"sk-a": "owui"}, MaxBodyBytes: 128})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	body := `{"model":"m","messages":[{"role":"user","content":"` + strings.Repeat("x", 256) + `"}]}`
+	status, resp := post(t, srv, "/v1/chat/completions", body)
+	var e errorResponse
+	_ = json.Unmarshal([]byte(resp), &e)
+	if status != http.StatusRequestEntityTooLarge || e.Error.Code == nil || *e.Error.Code != "request_too_large" {
+		t.Errorf("status %d, body %s", status, resp)
+	}
+	if status, resp = post(t, srv, "/v1/chat/completions", `{"model":"m","messages":[{"role":"user","content":"hi"}]}`); status != http.StatusOK {
+		t.Errorf("small body: status %d, body %s", status, resp)
+	}
+}
+
+func TestHandler_NoKeys(t *testing.T) {
+	upstream := newUpstream(t, ollamatest.Canned("ok"))
+	if _, err := New(Config{Upstream: upstream.GenerateURL(), Token: "owui"}); err == nil {
+		t.Fatal("config without keys accepted without AllowAnonymous")
+	}
+	h, err := New(Config{Upstream: upstream.GenerateURL(), Token: "owui", AllowAnonymous: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	err = openAIClient(srv, "").Chat(ollama.ChatRequest{Model: "m", Messages: []ollama.ChatMessage{{Role: ollama.RoleUser, Content: "hi"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy.json")
+	_ = os.WriteFile(path, []byte(`{"upstream":"https://ai.example.com/ollama/api/generate","endpoints":{"embed":"/v2/embed"},"keys":{"sk-a":"owui"},"listen":":9000"}`), 0600)
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Upstream != "https://ai.example.com/ollama/api/generate" || config.Keys["sk-a"] != "owui" || config.Listen != ":9000" {
+		t.Errorf("config = %+v", config)
+	}
+	if dsn, _ := config.dsn("owui"); dsn.Endpoints["embed"] != "/v2/embed" {
+		t.Errorf("upstream DSN = %+v, want the embed endpoint of the config", dsn)
+	}
+	config.Upstream = "ollama+https://ai.example.com/ollama?ps=/status"
+	if dsn, _ := config.dsn("owui"); dsn.Endpoints["embed"] != "/v2/embed" || dsn.Endpoints["ps"] != "/status" {
+		t.Errorf("upstream DSN = %+v, want the endpoints of the DSN string and the config", dsn)
+	}
+	config.Backend = ollama.BackendOpenAI
+	if _, err := New(*config); err == nil || !strings.Contains(err.Error(), "conflicts") {
+		t.Errorf("New with a backend conflicting with the DSN: error = %v", err)
+	}
+	config.Backend = ollama.BackendOllama
+	if _, err := New(*config); err != nil {
+		t.Errorf("New with the backend of the DSN: %v", err)
+	}
+
+	_ = os.WriteFile(path, []byte(`{"keys":`), 0600)
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("broken config loaded")
+	}
+	if _, err := New(Config{AllowAnonymous: true}, ollama.WithRootCAs(filepath.Join(t.TempDir(), "missing.pem"))); err == nil {
+		t.Error("option error not reported")
+	}
+}
@@ -0,0 +1,223 @@
+// Package rag implements retrieval-augmented generation on top of Client.Embed
+// and Client.Query: documents are split into chunks and embedded into a
+// vector.Collection, and the chunks most similar to a question are injected
+// into the prompt as numbered sources the model cites as [n].
+package rag
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/eslider/go-ollama"
+	"github.com/eslider/go-ollama/vector"
+)
+
+// DefaultContextLength is the context size assumed when neither the request nor Ps reports one
+const DefaultContextLength = 2048
+
+// DefaultTopK is the number of chunks a Pipeline retrieves when TopK is not positive
+const DefaultTopK = 5
+
+// DefaultAnswerTokens is the part of the context a Pipeline keeps free for the answer when AnswerTokens is not positive
+const DefaultAnswerTokens = 512
+
+// SystemPrompt instructs the model to answer from the sources and cite them
+const SystemPrompt = "Answer the question using only the numbered sources below. " +
+	"Cite the sources you use as [n]. If the sources do not contain the answer, say so."
+
+// Pipeline ingests documents and answers questions about them
+type Pipeline struct {
+	Client       *ollama.Client
+	Collection   *vector.Collection
+	Splitter     Splitter // Splits ingested documents, a MarkdownSplitter if nil
+	TopK         int      // Chunks retrieved per question
+	AnswerTokens int      // Tokens of the context kept free for the answer
+}
+
+// New creates a Pipeline embedding with embedModel into a new collection
+func New(client *ollama.Client, embedModel string) *Pipeline {
+	return &Pipeline{
+		Client:     client,
+		Collection: vector.NewCollection(embedModel),
+	}
+}
+
+// Ingest splits text into chunks and embeds them into the collection.
+// Chunks are named after source, which is kept in their "source" metadata;
+// ingesting the same source again replaces its chunks.
+// Returns the number of chunks.
+func (p *Pipeline) Ingest(ctx context.Context, source, text string) (int, error) {
+	splitter := p.Splitter
+	if splitter == nil {
+		splitter = MarkdownSplitter{}
+	}
+	chunks := splitter.Split(text)
+
+	docs := make([]vector.Document, len(chunks))
+	for i, chunk := range chunks {
+		docs[i] = vector.Document{
+			ID:       chunkID(source, i),
+			Text:     chunk,
+			Metadata: map[string]string{"source": source, "chunk": strconv.Itoa(i)},
+		}
+	}
+	if err := p.Collection.Add(ctx, p.Client, docs); err != nil {
+		return 0, fmt.Errorf("failed to ingest %s: %w", source, err)
+	}
+	// Drop the chunks of a previous, longer version
+	for i := len(chunks); p.Collection.Delete(chunkID(source, i)); i++ {
+	}
+	return len(chunks), nil
+}
+
+func chunkID(source string, i int) string {
+	return source + "#" + strconv.Itoa(i)
+}
+
+// Retrieve returns the k chunks most similar to the question, most similar first
+func (p *Pipeline) Retrieve(ctx context.Context, question string, k int) ([]vector.Match, error) {
+	if k <= 0 {
+		k = DefaultTopK
+	}
+	return p.Collection.Query(ctx, p.Client, question, k)
+}
+
+// Source is a chunk given to the model, numbered as the model cites it
+type Source struct {
+	N int
+	vector.Match
+}
+
+// Name returns the source the chunk was ingested from
+func (s Source) Name() string {
+	return s.Metadata["source"]
+}
+
+// Answer is the model's answer with the sources it was given and cited
+type Answer struct {
+	Text     string          // The answer
+	Sources  []Source        // Chunks injected into the prompt
+	Cited    []Source        // Sources referenced as [n] in Text, in order of first citation
+	Response ollama.Response // The final response, with the metrics
+}
+
+// Ask retrieves the chunks for request.Prompt, injects them into the prompt as sources and
+// queries the model. The sources are limited to what fits the model's context length:
+// request.Options.NumContext if set, else the ContextLength Ps reports for the loaded model,
+// else DefaultContextLength, minus AnswerTokens.
+// request.System is kept and followed by SystemPrompt. request.OnJson, if set, receives every fragment.
+func (p *Pipeline) Ask(ctx context.Context, request ollama.Request) (*Answer, error) {
+	question := request.Prompt
+	matches, err := p.Retrieve(ctx, question, p.TopK)
+	if err != nil {
+		return nil, err
+	}
+
+	system := SystemPrompt
+	if request.System != nil && *request.System != "" {
+		system = *request.System + "\n\n" + SystemPrompt
+	}
+	answerTokens := p.AnswerTokens
+	if answerTokens <= 0 {
+		answerTokens = DefaultAnswerTokens
+	}
+	budget := p.contextLength(ctx, request) - answerTokens - EstimateTokens(system)
+
+	answer := &Answer{}
+	request.Prompt, answer.Sources = AssemblePrompt(question, matches, budget)
+	request.System = &system
+
+	var text strings.Builder
+	onJson := request.OnJson
+	request.OnJson = func(res ollama.Response) error {
+		if res.Response != nil {
+			text.WriteString(*res.Response)
+		}
+		if res.Done != nil && *res.Done {
+			answer.Response = res
+		}
+		if onJson != nil {
+			return onJson(res)
+		}
+		return nil
+	}
+	if err := p.Client.QueryContext(ctx, request); err != nil {
+		return nil, err
+	}
+
+	answer.Text = text.String()
+	answer.Cited = Citations(answer.Text, answer.Sources)
+	return answer, nil
+}
+
+// contextLength returns the context size the request will run with
+func (p *Pipeline) contextLength(ctx context.Context, request ollama.Request) int {
+	if request.Options != nil && request.Options.NumContext != nil && *request.Options.NumContext > 0 {
+		return *request.Options.NumContext
+	}
+	// Backends without /api/ps, such as some proxies, fall back to the default
+	if ps, err := p.Client.PsContext(ctx); err == nil {
+		for _, m := range ps.Models {
+			if (m.Name == request.Model || m.Model == request.Model) && m.ContextLength > 0 {
+				return m.ContextLength
+			}
+		}
+	}
+	return DefaultContextLength
+}
+
+// AssemblePrompt formats the question with the matches as numbered sources, adding
+// matches in order as long as the prompt stays within budget tokens (see EstimateTokens).
+// Returns the prompt and the sources it contains.
+func AssemblePrompt(question string, matches []vector.Match, budget int) (string, []Source) {
+	tail := "Question: " + question
+	used := EstimateTokens("Sources:\n\n" + tail)
+
+	var sb strings.Builder
+	var sources []Source
+	for _, m := range matches {
+		n := len(sources) + 1
+		entry := fmt.Sprintf("[%d]", n)
+		if name := m.Metadata["source"]; name != "" {
+			entry += " (" + name + ")"
+		}
+		entry += "\n" + m.Text + "\n\n"
+		if used+EstimateTokens(entry) > budget {
+			continue
+		}
+		used += EstimateTokens(entry)
+		sb.WriteString(entry)
+		sources = append(sources, Source{N: n, Match: m})
+	}
+	if len(sources) == 0 {
+		return tail, nil
+	}
+	return "Sources:\n\n" + sb.String() + tail, sources
+}
+
+var citationRegExp = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// Citations returns the sources referenced as [n] or [n, m] in text, in order of first citation
+func Citations(text string, sources []Source) []Source {
+	var cited []Source
+	var seen []int
+	for _, match := range citationRegExp.FindAllStringSubmatch(text, -1) {
+		for _, num := range strings.Split(match[1], ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(num))
+			if err != nil || slices.Contains(seen, n) {
+				continue
+			}
+			for _, s := range sources {
+				if s.N == n {
+					cited = append(cited, s)
+					seen = append(seen, n)
+				}
+			}
+		}
+	}
+	return cited
+}
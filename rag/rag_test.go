@@ -0,0 +1,274 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/eslider/go-ollama"
+	"github.com/eslider/go-ollama/vector"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	for text, want := range map[string]int{"": 0, "abcd": 1, "abcde": 2, "äöüß": 1} {
+		if got := EstimateTokens(text); got != want {
+			t.Errorf("EstimateTokens(%q) = %d, want %d", text, got, want)
+		}
+	}
+}
+
+func TestTokenSplitter(t *testing.T) {
+	text := strings.Repeat("word ", 100) // 100 words of 2 tokens each
+	chunks := TokenSplitter{MaxTokens: 20, Overlap: 4}.Split(text)
+	if len(chunks) < 10 {
+		t.Fatalf("got %d chunks, want at least 10", len(chunks))
+	}
+	for i, c := range chunks {
+		if EstimateTokens(c) > 20 {
+			t.Errorf("chunk %d has %d tokens: %q", i, EstimateTokens(c), c)
+		}
+	}
+	// Consecutive chunks share the overlap
+	if !strings.HasPrefix(chunks[1], "word word") || strings.Count(strings.Join(chunks, " "), "word") <= 100 {
+		t.Errorf("chunks do not overlap: %q", chunks[:2])
+	}
+	if got := (TokenSplitter{}).Split("  "); len(got) != 0 {
+		t.Errorf("blank text split into %q", got)
+	}
+}
+
+func TestSentenceSplitter(t *testing.T) {
+	text := "The first sentence is here. The second one asks why? The third one shouts!\n\nA paragraph v1.2 stays whole."
+	chunks := SentenceSplitter{MaxTokens: 15}.Split(text)
+	want := []string{
+		"The first sentence is here. The second one asks why?",
+		"The third one shouts! A paragraph v1.2 stays whole.",
+	}
+	if strings.Join(chunks, "|") != strings.Join(want, "|") {
+		t.Errorf("chunks = %q, want %q", chunks, want)
+	}
+}
+
+func TestMarkdownSplitter(t *testing.T) {
+	text := "Intro text.\n\n# Guide\n\nAbout the guide.\n\n## Install\n\nRun go get.\n\n```sh\n# not a heading\ngo get example.com\n```\n\n### Linux\n\nUse apt.\n\n## Usage\n\nCall Query.\n"
+	chunks := MarkdownSplitter{}.Split(text)
+	want := []string{
+		"Intro text.",
+		"# Guide\n\nAbout the guide.",
+		"# Guide > ## Install\n\nRun go get.",
+		"# Guide > ## Install > ### Linux\n\nUse apt.",
+		"# Guide > ## Usage\n\nCall Query.",
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("got %d chunks, want %d: %q", len(chunks), len(want), chunks)
+	}
+	for i := range want {
+		if i == 2 {
+			if !strings.HasPrefix(chunks[i], want[i]) || !strings.Contains(chunks[i], "# not a heading") {
+				t.Errorf("chunk %d = %q, want the fenced block kept in Install", i, chunks[i])
+			}
+			continue
+		}
+		if chunks[i] != want[i] {
+			t.Errorf("chunk %d = %q, want %q", i, chunks[i], want[i])
+		}
+	}
+}
+
+func TestCodeSplitter(t *testing.T) {
+	text := `package main
+
+import "fmt"
+
+// Hello greets
+func Hello() {
+	fmt.Println("hello")
+}
+
+// World greets the world
+// at length
+func World() {
+	fmt.Println("world")
+}
+`
+	chunks := CodeSplitter{MaxTokens: 20}.Split(text)
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks, want 3: %q", len(chunks), chunks)
+	}
+	if !strings.HasPrefix(chunks[1], "// Hello greets\nfunc Hello()") {
+		t.Errorf("doc comment not kept with its function: %q", chunks[1])
+	}
+	if !strings.HasPrefix(chunks[2], "// World greets the world\n// at length\nfunc World()") {
+		t.Errorf("doc comment not kept with its function: %q", chunks[2])
+	}
+
+	// Small declarations are packed together
+	if chunks := (CodeSplitter{}).Split(text); len(chunks) != 1 {
+		t.Errorf("got %d chunks with the default size, want 1", len(chunks))
+	}
+}
+
+func TestAssemblePromptWithinBudget(t *testing.T) {
+	matches := []vector.Match{
+		{Document: vector.Document{Text: "short one", Metadata: map[string]string{"source": "a.md"}}},
+		{Document: vector.Document{Text: strings.Repeat("long ", 100), Metadata: map[string]string{"source": "b.md"}}},
+		{Document: vector.Document{Text: "short two", Metadata: map[string]string{"source": "c.md"}}},
+	}
+	prompt, sources := AssemblePrompt("What?", matches, 40)
+	if EstimateTokens(prompt) > 40 {
+		t.Errorf("prompt has %d tokens, budget 40", EstimateTokens(prompt))
+	}
+	if len(sources) != 2 || sources[0].Name() != "a.md" || sources[1].Name() != "c.md" || sources[1].N != 2 {
+		t.Errorf("sources = %+v, want a.md and c.md numbered 1 and 2", sources)
+	}
+	if !strings.Contains(prompt, "[2] (c.md)\nshort two") || !strings.HasSuffix(prompt, "Question: What?") {
+		t.Errorf("prompt = %q", prompt)
+	}
+
+	if prompt, sources := AssemblePrompt("What?", matches, 1); prompt != "Question: What?" || sources != nil {
+		t.Errorf("with no room: prompt %q, sources %+v", prompt, sources)
+	}
+}
+
+func TestCitations(t *testing.T) {
+	sources := []Source{{N: 1}, {N: 2}, {N: 3}}
+	cited := Citations("Yes [2]. Also [3, 1] and again [2]; not [7] or [x].", sources)
+	if len(cited) != 3 || cited[0].N != 2 || cited[1].N != 3 || cited[2].N != 1 {
+		t.Errorf("cited = %+v, want 2, 3, 1", cited)
+	}
+}
+
+// ragServer fakes /api/embed, /api/ps and /api/generate. Texts mentioning "install" embed
+// one way, anything else the other; generate answers citing source 1 and records the request.
+func ragServer(t *testing.T, contextLength int, generated *ollama.Request) *ollama.Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/embed":
+			var req ollama.EmbedRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			res := ollama.EmbedResponse{Model: req.Model}
+			for _, in := range req.Input {
+				if strings.Contains(strings.ToLower(in), "install") {
+					res.Embeddings = append(res.Embeddings, []float64{1, 0.1})
+				} else {
+					res.Embeddings = append(res.Embeddings, []float64{0.1, 1})
+				}
+			}
+			_ = json.NewEncoder(w).Encode(res)
+		case "/api/ps":
+			_ = json.NewEncoder(w).Encode(ollama.ProcessStatus{Models: []ollama.ProcessModel{
+				{Name: "other", ContextLength: 100000},
+				{Name: "llama3", Model: "llama3", ContextLength: contextLength},
+			}})
+		case "/api/generate":
+			_ = json.NewDecoder(r.Body).Decode(generated)
+			_, _ = w.Write([]byte(`{"response":"Run go get [1]."}` + "\n"))
+			_, _ = w.Write([]byte(`{"response":"","done":true,"eval_count":5}` + "\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return ollama.NewOpenWebUiClient(&ollama.DSN{URL: srv.URL + "/api/generate"})
+}
+
+const guide = "# Guide\n\n## Install\n\nRun go get to install.\n\n## Usage\n\nCall Query with a request.\n\n## License\n\nMIT.\n"
+
+func TestPipeline_IngestAndRetrieve(t *testing.T) {
+	var generated ollama.Request
+	p := New(ragServer(t, 4096, &generated), "embed-model")
+	ctx := context.Background()
+
+	n, err := p.Ingest(ctx, "guide.md", guide)
+	if err != nil || n != 3 {
+		t.Fatalf("Ingest = %d, %v; want 3 chunks", n, err)
+	}
+	matches, err := p.Retrieve(ctx, "how to install?", 1)
+	if err != nil {
+		t.Fatalf("Retrieve error: %v", err)
+	}
+	if len(matches) != 1 || matches[0].ID != "guide.md#0" || matches[0].Metadata["source"] != "guide.md" || matches[0].Score <= 0 {
+		t.Errorf("matches = %+v, want the install chunk", matches)
+	}
+
+	// Re-ingesting a shorter version drops the stale chunks
+	if n, err := p.Ingest(ctx, "guide.md", "# Guide\n\nInstall with go get.\n"); err != nil || n != 1 {
+		t.Fatalf("re-Ingest = %d, %v", n, err)
+	}
+	if p.Collection.Len() != 1 {
+		t.Errorf("Len = %d after re-ingest, want 1", p.Collection.Len())
+	}
+}
+
+func TestPipeline_Ask(t *testing.T) {
+	var generated ollama.Request
+	p := New(ragServer(t, 4096, &generated), "embed-model")
+	p.TopK = 2
+	ctx := context.Background()
+	if _, err := p.Ingest(ctx, "guide.md", guide); err != nil {
+		t.Fatal(err)
+	}
+
+	var fragments int
+	system := "Be brief."
+	answer, err := p.Ask(ctx, ollama.Request{
+		Model:  "llama3",
+		Prompt: "How do I install it?",
+		System: &system,
+		OnJson: func(ollama.Response) error {
+			fragments++
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Ask error: %v", err)
+	}
+	if answer.Text != "Run go get [1]." || fragments != 2 {
+		t.Errorf("answer %q after %d fragments", answer.Text, fragments)
+	}
+	if len(answer.Sources) != 2 || len(answer.Cited) != 1 || answer.Cited[0].ID != "guide.md#0" {
+		t.Errorf("sources %+v, cited %+v", answer.Sources, answer.Cited)
+	}
+	if answer.Response.EvalCount == nil || *answer.Response.EvalCount != 5 {
+		t.Errorf("final response not kept: %+v", answer.Response)
+	}
+	if !strings.HasPrefix(generated.Prompt, "Sources:\n\n[1] (guide.md)\n# Guide > ## Install") ||
+		!strings.HasSuffix(generated.Prompt, "Question: How do I install it?") {
+		t.Errorf("prompt sent = %q", generated.Prompt)
+	}
+	if generated.System == nil || !strings.HasPrefix(*generated.System, "Be brief.\n\n") || !strings.HasSuffix(*generated.System, SystemPrompt) {
+		t.Errorf("system sent = %v", generated.System)
+	}
+}
+
+func TestPipeline_AskFitsContextLength(t *testing.T) {
+	var generated ollama.Request
+	// Room for the question and the system prompt, but not for a source
+	p := New(ragServer(t, DefaultAnswerTokens+EstimateTokens(SystemPrompt)+12, &generated), "embed-model")
+	ctx := context.Background()
+	if _, err := p.Ingest(ctx, "guide.md", guide); err != nil {
+		t.Fatal(err)
+	}
+
+	answer, err := p.Ask(ctx, ollama.Request{Model: "llama3", Prompt: "How do I install it?"})
+	if err != nil {
+		t.Fatalf("Ask error: %v", err)
+	}
+	if len(answer.Sources) != 0 || len(answer.Cited) != 0 || generated.Prompt != "Question: How do I install it?" {
+		t.Errorf("sources %+v, prompt %q; want none to fit", answer.Sources, generated.Prompt)
+	}
+
+	// NumContext in the request wins over Ps
+	numCtx := 4096
+	answer, err = p.Ask(ctx, ollama.Request{Model: "llama3", Prompt: "How do I install it?", Options: &ollama.RequestOptions{NumContext: &numCtx}})
+	if err != nil {
+		t.Fatalf("Ask error: %v", err)
+	}
+	if len(answer.Sources) != 3 {
+		t.Errorf("got %d sources with NumContext, want 3", len(answer.Sources))
+	}
+}
@@ -0,0 +1,255 @@
+package rag
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultChunkTokens is the chunk size of the splitters when their MaxTokens is not positive
+const DefaultChunkTokens = 256
+
+// Splitter splits a document into chunks of text
+type Splitter interface {
+	Split(text string) []string
+}
+
+// EstimateTokens estimates the number of tokens of text at four characters per token,
+// a rough average for English text and code with the common tokenizers
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+func maxTokens(n int) int {
+	if n <= 0 {
+		return DefaultChunkTokens
+	}
+	return n
+}
+
+// TokenSplitter splits text into chunks of about MaxTokens tokens at word boundaries.
+// Consecutive chunks share Overlap tokens, so a passage cut in two is still found whole in one of them.
+type TokenSplitter struct {
+	MaxTokens int
+	Overlap   int
+}
+
+var wordRegExp = regexp.MustCompile(`\S+\s*`)
+
+// Split implements Splitter
+func (s TokenSplitter) Split(text string) []string {
+	limit := maxTokens(s.MaxTokens)
+	overlap := min(max(s.Overlap, 0), limit/2)
+	words := wordRegExp.FindAllString(text, -1)
+
+	var chunks []string
+	for start := 0; start < len(words); {
+		end, tokens := start, 0
+		for end < len(words) && (end == start || tokens+EstimateTokens(words[end]) <= limit) {
+			tokens += EstimateTokens(words[end])
+			end++
+		}
+		chunks = append(chunks, strings.TrimSpace(strings.Join(words[start:end], "")))
+		if end == len(words) {
+			break
+		}
+		// Step back over the overlap, but always advance
+		next := end
+		for back := 0; next > start+1 && back+EstimateTokens(words[next-1]) <= overlap; next-- {
+			back += EstimateTokens(words[next-1])
+		}
+		start = next
+	}
+	return chunks
+}
+
+// SentenceSplitter packs whole sentences into chunks of up to MaxTokens tokens.
+// Blank lines end a sentence too. Sentences longer than MaxTokens are split at words.
+type SentenceSplitter struct {
+	MaxTokens int
+}
+
+// Split implements Splitter
+func (s SentenceSplitter) Split(text string) []string {
+	limit := maxTokens(s.MaxTokens)
+	return pack(sentences(text), limit, " ", TokenSplitter{MaxTokens: limit}.Split)
+}
+
+// sentences splits text after ".", "!" or "?" followed by whitespace, and at blank lines
+func sentences(text string) []string {
+	var out []string
+	start := 0
+	for i, r := range text {
+		end := 0
+		switch {
+		case r == '.' || r == '!' || r == '?':
+			next, _ := utf8.DecodeRuneInString(text[i+1:])
+			if i+1 == len(text) || unicode.IsSpace(next) {
+				end = i + 1
+			}
+		case r == '\n' && strings.HasPrefix(text[i+1:], "\n"):
+			end = i + 1
+		}
+		if end > start {
+			if s := strings.TrimSpace(text[start:end]); s != "" {
+				out = append(out, s)
+			}
+			start = end
+		}
+	}
+	if s := strings.TrimSpace(text[start:]); s != "" {
+		out = append(out, s)
+	}
+	return out
+}
+
+// MarkdownSplitter splits markdown at headings. Each chunk starts with the path of
+// headings it belongs to, e.g. "# Guide > ## Install", so it can be retrieved on its own.
+// Sections longer than MaxTokens are split at sentences. Headings inside code fences are ignored.
+type MarkdownSplitter struct {
+	MaxTokens int
+}
+
+var headingRegExp = regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*#*\s*$`)
+
+// Split implements Splitter
+func (s MarkdownSplitter) Split(text string) []string {
+	limit := maxTokens(s.MaxTokens)
+
+	var chunks []string
+	var path []string // headings of the current section, by level
+	var body strings.Builder
+	flush := func() {
+		content := strings.TrimSpace(body.String())
+		body.Reset()
+		if content == "" {
+			return
+		}
+		breadcrumb := ""
+		for _, h := range path {
+			if h == "" {
+				continue
+			}
+			if breadcrumb != "" {
+				breadcrumb += " > "
+			}
+			breadcrumb += h
+		}
+		if breadcrumb == "" {
+			chunks = append(chunks, SentenceSplitter{MaxTokens: limit}.Split(content)...)
+			return
+		}
+		splitter := SentenceSplitter{MaxTokens: max(limit-EstimateTokens(breadcrumb), limit/2)}
+		for _, piece := range splitter.Split(content) {
+			chunks = append(chunks, breadcrumb+"\n\n"+piece)
+		}
+	}
+
+	fence := ""
+	for _, line := range strings.SplitAfter(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+		default:
+			if m := headingRegExp.FindStringSubmatch(strings.TrimRight(line, "\r\n")); m != nil {
+				flush()
+				level := len(m[1])
+				path = append(path[:min(level-1, len(path))], make([]string, max(level-1-len(path), 0))...)
+				path = append(path, m[1]+" "+m[2])
+				continue
+			}
+		}
+		body.WriteString(line)
+	}
+	flush()
+	return chunks
+}
+
+// CodeSplitter splits source code at top-level declarations such as functions, types
+// and classes, keeping the comments and decorators above a declaration with it.
+// Small declarations are packed together up to MaxTokens; longer ones are split at lines.
+type CodeSplitter struct {
+	MaxTokens int
+}
+
+// declarationRegExp matches the first line of a top-level declaration in common languages
+var declarationRegExp = regexp.MustCompile(`^(?:func|type|var|const|def|async def|class|function|async function|export|fn|pub|impl|struct|enum|trait|interface|public|private|protected|static|abstract|final|module|package|CREATE|create)\b`)
+
+// Split implements Splitter
+func (s CodeSplitter) Split(text string) []string {
+	limit := maxTokens(s.MaxTokens)
+	lines := strings.SplitAfter(text, "\n")
+
+	var decls []string
+	start := 0
+	for i, line := range lines {
+		if i == 0 || !declarationRegExp.MatchString(line) {
+			continue
+		}
+		// Keep the comments and decorators right above the declaration with it
+		cut := i
+		for cut > start && isDocLine(lines[cut-1]) {
+			cut--
+		}
+		if cut > start {
+			decls = append(decls, strings.Join(lines[start:cut], ""))
+			start = cut
+		}
+	}
+	decls = append(decls, strings.Join(lines[start:], ""))
+
+	var pieces []string
+	for _, d := range decls {
+		if d = strings.Trim(d, "\n"); strings.TrimSpace(d) != "" {
+			pieces = append(pieces, d)
+		}
+	}
+	return pack(pieces, limit, "\n\n", func(text string) []string {
+		return pack(strings.Split(text, "\n"), limit, "\n", TokenSplitter{MaxTokens: limit}.Split)
+	})
+}
+
+func isDocLine(line string) bool {
+	line = strings.TrimSpace(line)
+	for _, prefix := range []string{"//", "#", "/*", "*", "@", "--", `"""`} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// pack joins consecutive pieces with sep into chunks of up to limit tokens, splitting pieces that are too long with split
+func pack(pieces []string, limit int, sep string, split func(string) []string) []string {
+	var chunks []string
+	var cur []string
+	tokens := 0
+	flush := func() {
+		if s := strings.TrimSpace(strings.Join(cur, sep)); s != "" {
+			chunks = append(chunks, s)
+		}
+		cur = nil
+		tokens = 0
+	}
+	for _, piece := range pieces {
+		n := EstimateTokens(piece + sep)
+		if n > limit {
+			flush()
+			chunks = append(chunks, split(piece)...)
+			continue
+		}
+		if tokens+n > limit {
+			flush()
+		}
+		cur = append(cur, piece)
+		tokens += n
+	}
+	flush()
+	return chunks
+}
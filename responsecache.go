@@ -0,0 +1,217 @@
+package ollama
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// RecordedResponse is a streamed Response with the time it arrived, relative to the start of the request
+type RecordedResponse struct {
+	Offset   time.Duration `json:"offset"`
+	Response Response      `json:"response"`
+}
+
+// ResponseCache stores the recorded streams of generate requests, see WithResponseCache.
+// Keys are hex-encoded hashes; implementations must be safe for concurrent use.
+type ResponseCache interface {
+	// Get returns the stream recorded for key; ok is false if there is none
+	Get(key string) (stream []RecordedResponse, ok bool, err error)
+	// Put stores a complete stream for key, replacing an older one
+	Put(key string, stream []RecordedResponse) error
+}
+
+// WithResponseCache answers deterministic generate requests from cache: requests with
+// Options.Seed set and Options.Temperature 0, which yield the same answer every time.
+// The first such request streams from the server and is recorded; repeating it replays the
+// recorded responses through Stream and Query, including OnJson and OnCodeBlock.
+// Streams cut short by an error, a cancelled context or an early break are not stored;
+// neither is a stream the cache fails to store, which does not fail the request.
+// Requests are keyed by the sha256 of the backend, the base URL and Request.ToJson,
+// so a cache shared by clients of different servers keeps their answers apart.
+func WithResponseCache(cache ResponseCache) Option {
+	return func(o *clientOptions) error {
+		if cache == nil {
+			return errors.New("response cache is nil")
+		}
+		o.responseCache = cache
+		return nil
+	}
+}
+
+// WithReplayTiming replays cached responses at their recorded pace, scaled by scale:
+// 1 reproduces the original timing, 0.5 replays twice as fast. By default they are replayed at once.
+func WithReplayTiming(scale float64) Option {
+	return func(o *clientOptions) error {
+		if scale < 0 {
+			return errors.New("replay timing scale must not be negative")
+		}
+		o.replayTiming = scale
+		return nil
+	}
+}
+
+// cacheable reports whether request yields the same answer every time
+func cacheable(request Request) bool {
+	o := request.Options
+	return o != nil && o.Seed != nil && o.Temperature != nil && *o.Temperature == 0
+}
+
+// responseCacheKey hashes the server the client talks to and the canonical JSON of request
+func (c *Client) responseCacheKey(request Request) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s", c.ds.Backend, c.BaseURL(), request.ToJson())
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// MemoryResponseCache is a ResponseCache in memory, e.g. for tests or a single long-running process
+type MemoryResponseCache struct {
+	mu      sync.RWMutex
+	streams map[string][]RecordedResponse
+}
+
+// NewMemoryResponseCache creates an empty MemoryResponseCache
+func NewMemoryResponseCache() *MemoryResponseCache {
+	return &MemoryResponseCache{streams: map[string][]RecordedResponse{}}
+}
+
+// Get implements ResponseCache
+func (m *MemoryResponseCache) Get(key string) ([]RecordedResponse, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stream, ok := m.streams[key]
+	return slices.Clone(stream), ok, nil
+}
+
+// Put implements ResponseCache
+func (m *MemoryResponseCache) Put(key string, stream []RecordedResponse) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.streams[key] = slices.Clone(stream)
+	return nil
+}
+
+// Len returns the number of stored streams
+func (m *MemoryResponseCache) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.streams)
+}
+
+// DirResponseCache is a ResponseCache storing each stream as a JSON Lines file <key>.jsonl
+// in a directory, one RecordedResponse per line, e.g. to commit recorded answers for CI
+type DirResponseCache struct {
+	Dir string
+}
+
+// NewDirResponseCache creates a DirResponseCache in dir; the directory is created on the first Put
+func NewDirResponseCache(dir string) *DirResponseCache {
+	return &DirResponseCache{Dir: dir}
+}
+
+// Get implements ResponseCache
+func (d *DirResponseCache) Get(key string) ([]RecordedResponse, bool, error) {
+	path := filepath.Join(d.Dir, key+".jsonl")
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read cached response: %w", err)
+	}
+
+	var stream []RecordedResponse
+	for line := range bytes.Lines(data) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var rec RecordedResponse
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return nil, false, fmt.Errorf("failed to decode cached response %s: %w", path, err)
+		}
+		stream = append(stream, rec)
+	}
+	return stream, true, nil
+}
+
+// Put implements ResponseCache. The file is replaced atomically, so concurrent readers never see a partial stream.
+func (d *DirResponseCache) Put(key string, stream []RecordedResponse) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, rec := range stream {
+		if err := enc.Encode(rec); err != nil {
+			return fmt.Errorf("failed to encode response for cache: %w", err)
+		}
+	}
+
+	if err := os.MkdirAll(d.Dir, 0755); err != nil {
+		return fmt.Errorf("failed to create response cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(d.Dir, key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to store response in cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to store response in cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to store response in cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(d.Dir, key+".jsonl")); err != nil {
+		return fmt.Errorf("failed to store response in cache: %w", err)
+	}
+	return nil
+}
+
+// cachedStream replays the stream recorded for request, or streams it from the server and records it.
+func (c *Client) cachedStream(ctx context.Context, request Request) iter.Seq2[Response, error] {
+	return func(yield func(Response, error) bool) {
+		key := c.responseCacheKey(request)
+		stream, ok, err := c.responseCache.Get(key)
+		if err != nil {
+			yield(Response{}, err)
+			return
+		}
+
+		start := time.Now()
+		if ok {
+			for _, rec := range stream {
+				delay := time.Until(start.Add(time.Duration(float64(rec.Offset) * c.replayTiming)))
+				if err := sleepContext(ctx, delay); err != nil {
+					yield(Response{}, contextError(ctx, "generate", err))
+					return
+				}
+				if !yield(rec.Response, nil) {
+					return
+				}
+			}
+			return
+		}
+
+		var recorded []RecordedResponse
+		for res, err := range c.generate(ctx, request) {
+			if err != nil {
+				yield(Response{}, err)
+				return
+			}
+			recorded = append(recorded, RecordedResponse{Offset: time.Since(start), Response: res})
+			if !yield(res, nil) {
+				return
+			}
+		}
+		// The answer was delivered in full; failing to store it only costs a later request
+		_ = c.responseCache.Put(key, recorded)
+	}
+}
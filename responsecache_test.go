@@ -0,0 +1,236 @@
+package ollama
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// deterministicRequest returns a request the response cache applies to
+func deterministicRequest(prompt string) Request {
+	return Request{Model: "m", Prompt: prompt, Options: &RequestOptions{Seed: new(42), Temperature: new(0.0)}}
+}
+
+func countingStreamServer(t *testing.T, calls *atomic.Int32, tokens []string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		fmt.Fprint(w, simulateStreamBody(tokens, "m"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestResponseCache_ReplaysThroughCallbacks(t *testing.T) {
+	var calls atomic.Int32
+	srv := countingStreamServer(t, &calls, []string{"Here:\n", "```go\n", "x := 1\n", "```\n"})
+	cache := NewMemoryResponseCache()
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"}, WithResponseCache(cache))
+
+	var runs []string
+	for range 2 {
+		var text strings.Builder
+		var blocks int
+		request := deterministicRequest("p")
+		request.OnJson = func(res Response) error {
+			text.WriteString(*res.Response)
+			return nil
+		}
+		request.OnCodeBlock = func(b []*CodeBlock) error {
+			blocks += len(b)
+			return nil
+		}
+		if err := client.Query(request); err != nil {
+			t.Fatalf("Query error: %v", err)
+		}
+		if blocks != 1 {
+			t.Errorf("got %d code blocks, want 1", blocks)
+		}
+		runs = append(runs, text.String())
+	}
+
+	if calls.Load() != 1 {
+		t.Errorf("server called %d times, want 1", calls.Load())
+	}
+	if runs[0] != runs[1] || runs[0] == "" {
+		t.Errorf("replay %q differs from %q", runs[1], runs[0])
+	}
+	if cache.Len() != 1 {
+		t.Errorf("cache has %d streams, want 1", cache.Len())
+	}
+
+	// A different request is a miss
+	if err := client.Query(deterministicRequest("other")); err != nil || calls.Load() != 2 {
+		t.Errorf("other prompt: err %v, %d calls", err, calls.Load())
+	}
+}
+
+func TestResponseCache_SkipsNonDeterministicRequests(t *testing.T) {
+	var calls atomic.Int32
+	srv := countingStreamServer(t, &calls, []string{"a"})
+	cache := NewMemoryResponseCache()
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"}, WithResponseCache(cache))
+
+	for _, request := range []Request{
+		{Model: "m", Prompt: "p"},
+		{Model: "m", Prompt: "p", Options: &RequestOptions{Seed: new(1), Temperature: new(0.7)}},
+		{Model: "m", Prompt: "p", Options: &RequestOptions{Temperature: new(0.0)}},
+	} {
+		for range 2 {
+			if err := client.Query(request); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if calls.Load() != 6 || cache.Len() != 0 {
+		t.Errorf("%d calls, %d cached; want every request sent and none cached", calls.Load(), cache.Len())
+	}
+}
+
+func TestResponseCache_DirStoresJSONLines(t *testing.T) {
+	var calls atomic.Int32
+	srv := countingStreamServer(t, &calls, []string{"a", "b"})
+	dir := filepath.Join(t.TempDir(), "responses")
+
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"}, WithResponseCache(NewDirResponseCache(dir)))
+	if err := client.Query(deterministicRequest("p")); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if len(files) != 1 {
+		t.Fatalf("got files %v, want one .jsonl", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	if lines := strings.Count(string(data), "\n"); lines != 3 {
+		t.Errorf("file has %d lines, want 3:\n%s", lines, data)
+	}
+
+	// Another client, e.g. the next CI run, replays from the directory
+	client = NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"}, WithResponseCache(NewDirResponseCache(dir)))
+	var text string
+	for res, err := range client.Stream(context.Background(), deterministicRequest("p")) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		text += *res.Response
+	}
+	if text != "ab" || calls.Load() != 1 {
+		t.Errorf("replayed %q with %d calls", text, calls.Load())
+	}
+
+	// A corrupt file is reported, not silently refetched
+	_ = os.WriteFile(files[0], []byte("{broken\n"), 0644)
+	if err := client.Query(deterministicRequest("p")); err == nil {
+		t.Error("expected error for a corrupt cache file")
+	}
+}
+
+func TestResponseCache_ReplayTiming(t *testing.T) {
+	cache := NewMemoryResponseCache()
+	request := deterministicRequest("p")
+	_ = cache.Put(NewOpenWebUiClient(&DSN{URL: "http://127.0.0.1:1"}).responseCacheKey(request), []RecordedResponse{
+		{Offset: 0, Response: Response{Response: new("a")}},
+		{Offset: 40 * time.Millisecond, Response: Response{Response: new("b")}},
+		{Offset: 80 * time.Millisecond, Response: Response{Response: new(""), Done: new(true)}},
+	})
+
+	for _, tc := range []struct {
+		scale    float64
+		min, max time.Duration
+	}{
+		{0, 0, 30 * time.Millisecond},
+		{1, 75 * time.Millisecond, time.Second},
+	} {
+		client := NewOpenWebUiClient(&DSN{URL: "http://127.0.0.1:1/api/generate"}, WithResponseCache(cache), WithReplayTiming(tc.scale))
+		start := time.Now()
+		if err := client.Query(request); err != nil {
+			t.Fatalf("scale %v: %v", tc.scale, err)
+		}
+		if elapsed := time.Since(start); elapsed < tc.min || elapsed > tc.max {
+			t.Errorf("scale %v: replay took %v, want %v-%v", tc.scale, elapsed, tc.min, tc.max)
+		}
+	}
+
+	// Cancelling stops a timed replay
+	client := NewOpenWebUiClient(&DSN{URL: "http://127.0.0.1:1/api/generate"}, WithResponseCache(cache), WithReplayTiming(10))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := client.QueryContext(ctx, request); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestResponseCache_KeyIncludesServer(t *testing.T) {
+	var callsA, callsB atomic.Int32
+	a := countingStreamServer(t, &callsA, []string{"from a"})
+	b := countingStreamServer(t, &callsB, []string{"from b"})
+	cache := NewMemoryResponseCache()
+
+	for _, srv := range []*httptest.Server{a, b, a} {
+		var text string
+		client := NewOpenWebUiClient(&DSN{URL: srv.URL}, WithResponseCache(cache))
+		err := client.Query(Request{Model: "m", Prompt: "p", Options: deterministicRequest("p").Options, OnJson: func(res Response) error {
+			text += *res.Response
+			return nil
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[*httptest.Server]string{a: "from a", b: "from b"}[srv]; text != want {
+			t.Errorf("answer = %q, want %q", text, want)
+		}
+	}
+	if callsA.Load() != 1 || callsB.Load() != 1 || cache.Len() != 2 {
+		t.Errorf("calls a %d, b %d, cached %d; want 1, 1, 2", callsA.Load(), callsB.Load(), cache.Len())
+	}
+}
+
+// failingCache finds nothing and fails to store anything
+type failingCache struct{}
+
+func (failingCache) Get(string) ([]RecordedResponse, bool, error) { return nil, false, nil }
+func (failingCache) Put(string, []RecordedResponse) error         { return errors.New("disk full") }
+
+func TestResponseCache_PutFailureKeepsAnswer(t *testing.T) {
+	var calls atomic.Int32
+	srv := countingStreamServer(t, &calls, []string{"a", "b"})
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL}, WithResponseCache(failingCache{}))
+
+	var text string
+	for res, err := range client.Stream(context.Background(), deterministicRequest("p")) {
+		if err != nil {
+			t.Fatalf("stream error %v, want the cache failure ignored", err)
+		}
+		text += *res.Response
+	}
+	if text != "ab" {
+		t.Errorf("text = %q", text)
+	}
+}
+
+func TestResponseCache_IncompleteStreamNotStored(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"response":"a","done":false}`+"\n")
+	}))
+	defer srv.Close()
+	cache := NewMemoryResponseCache()
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"}, WithResponseCache(cache))
+
+	if err := client.Query(deterministicRequest("p")); !errors.Is(err, ErrStreamTruncated) {
+		t.Errorf("err = %v, want ErrStreamTruncated", err)
+	}
+	if cache.Len() != 0 {
+		t.Error("truncated stream was cached")
+	}
+	if _, err := NewClient(nil, WithReplayTiming(-1)); err == nil {
+		t.Error("expected error for a negative replay timing")
+	}
+}
@@ -0,0 +1,123 @@
+package ollama
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how a Client retries transient failures such as
+// connection errors, 429 Too Many Requests and 502/503/504 while
+// Open WebUI restarts or Ollama loads a model.
+type RetryPolicy struct {
+	MaxAttempts int                                       // Total number of attempts including the first one; values below 2 disable retries
+	BaseDelay   time.Duration                             // Delay before the first retry, doubled on each further attempt
+	MaxDelay    time.Duration                             // Upper bound of a single delay, including one requested by Retry-After; 0 means no bound
+	RetryOn     func(resp *http.Response, err error) bool // Decides whether an attempt is retried; nil uses DefaultRetryOn
+}
+
+// DefaultRetryPolicy retries up to 3 times with a backoff of 0.5s, 1s, 2s (plus jitter), never waiting more than 30s.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+// WithRetry enables retries of transient failures with the given policy.
+func WithRetry(policy RetryPolicy) Option {
+	return func(o *clientOptions) error {
+		if policy.MaxAttempts < 0 || policy.BaseDelay < 0 || policy.MaxDelay < 0 {
+			return errors.New("retry policy values must not be negative")
+		}
+		o.retry = &policy
+		return nil
+	}
+}
+
+// DefaultRetryOn retries connection errors and the statuses 429, 502, 503 and 504.
+// Cancelled or expired contexts are never retried.
+func DefaultRetryOn(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// shouldRetry reports whether the given attempt is to be followed by another one.
+func (p *RetryPolicy) shouldRetry(attempt int, resp *http.Response, err error) bool {
+	if p == nil || attempt >= p.MaxAttempts {
+		return false
+	}
+	if err == nil && resp.StatusCode == http.StatusOK {
+		return false
+	}
+	retryOn := p.RetryOn
+	if retryOn == nil {
+		retryOn = DefaultRetryOn
+	}
+	return retryOn(resp, err)
+}
+
+// delay returns how long to wait after the given failed attempt.
+// A Retry-After header takes precedence over the exponential backoff.
+func (p *RetryPolicy) delay(attempt int, resp *http.Response) time.Duration {
+	if d, ok := retryAfter(resp); ok {
+		if p.MaxDelay > 0 && d > p.MaxDelay {
+			d = p.MaxDelay
+		}
+		return d
+	}
+
+	d := p.BaseDelay << (attempt - 1)
+	if d < p.BaseDelay { // shift overflow
+		d = p.MaxDelay
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	// Equal jitter: keep half the backoff, randomize the other half
+	if half := d / 2; half > 0 {
+		d = half + rand.N(half)
+	}
+	return d
+}
+
+// retryAfter parses the Retry-After header, given in seconds or as an HTTP date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+// sleepContext waits for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
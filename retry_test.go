@@ -0,0 +1,149 @@
+package ollama
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var fastRetry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+func TestRetry_TransientStatusThenSuccess(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, simulateStreamBody([]string{"a", "b"}, "m"))
+	}))
+	defer srv.Close()
+
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL}, WithRetry(fastRetry))
+
+	var tokens []string
+	err := client.Query(Request{
+		Model:  "m",
+		Prompt: "p",
+		OnJson: func(res Response) error {
+			tokens = append(tokens, *res.Response)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Query error: %v", err)
+	}
+	if attempts.Load() != 3 {
+		t.Errorf("got %d attempts, want 3", attempts.Load())
+	}
+	// Each token exactly once: retries happen before the first chunk.
+	if strings.Join(tokens, "") != "ab" || len(tokens) != 3 {
+		t.Errorf("tokens = %q", tokens)
+	}
+}
+
+func TestRetry_GivesUpAfterMaxAttempts(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"}, WithRetry(fastRetry))
+	_, err := client.Ps()
+	if err == nil || !strings.Contains(err.Error(), "429") {
+		t.Fatalf("error = %v, want 429", err)
+	}
+	if attempts.Load() != 3 {
+		t.Errorf("got %d attempts, want 3", attempts.Load())
+	}
+}
+
+func TestRetry_NotRetriedStatus(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"}, WithRetry(fastRetry))
+	if _, err := client.Embed(EmbedRequest{Model: "m", Input: []string{"x"}}); err == nil {
+		t.Fatal("expected error for 400")
+	}
+	if attempts.Load() != 1 {
+		t.Errorf("got %d attempts, want 1", attempts.Load())
+	}
+}
+
+func TestRetry_CustomPredicateAndConnectionError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := srv.URL
+	srv.Close() // nothing listens any more
+
+	var seen int
+	policy := fastRetry
+	policy.RetryOn = func(resp *http.Response, err error) bool {
+		seen++
+		return err != nil
+	}
+	client := NewOpenWebUiClient(&DSN{URL: url + "/api/generate"}, WithRetry(policy))
+	if _, err := client.Ps(); err == nil {
+		t.Fatal("expected connection error")
+	}
+	if seen != 2 {
+		t.Errorf("predicate called %d times, want 2", seen)
+	}
+}
+
+func TestRetry_ContextCancelledDuringBackoff(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"}, WithRetry(DefaultRetryPolicy))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.PsContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error = %v, want context.DeadlineExceeded", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("backoff did not stop on context deadline")
+	}
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond} {
+		d := p.delay(attempt, nil)
+		if d < want/2 || d > want {
+			t.Errorf("attempt %d: delay %v not in [%v, %v]", attempt, d, want/2, want)
+		}
+	}
+	if d := p.delay(60, nil); d < time.Second/2 || d > time.Second {
+		t.Errorf("large attempt delay = %v, want capped at 1s", d)
+	}
+
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"0"}}}
+	if d := p.delay(1, resp); d != 0 {
+		t.Errorf("Retry-After 0 delay = %v", d)
+	}
+	resp.Header.Set("Retry-After", "120")
+	if d := p.delay(1, resp); d != time.Second {
+		t.Errorf("Retry-After 120 delay = %v, want capped at 1s", d)
+	}
+}
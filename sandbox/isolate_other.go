@@ -0,0 +1,10 @@
+//go:build !linux
+
+package sandbox
+
+import "os/exec"
+
+// isolate does nothing where network namespaces are not available
+func isolate(cmd *exec.Cmd, network bool) bool {
+	return false
+}
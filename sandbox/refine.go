@@ -0,0 +1,73 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/eslider/go-ollama"
+)
+
+// DefaultAttempts is the number of answers Refine runs when attempts is not positive
+const DefaultAttempts = 3
+
+// ErrNoCode is returned by Refine when an answer has no code block the runner supports
+var ErrNoCode = errors.New("answer contains no runnable code block")
+
+// Refine runs a generate, run, fix loop on top of Client.Stream.
+//
+// It sends request, runs the first code block of the answer the runner supports
+// and, while the run fails, continues the generation with the code and the
+// Result.Feedback, asking the model to fix it. The conversation is carried by
+// Request.Context. request.OnJson, if set, receives every streamed fragment.
+//
+// Returns the last block and its result once it runs fine or after attempts answers.
+func Refine(ctx context.Context, client *ollama.Client, request ollama.Request, runner *Runner, attempts int) (*ollama.CodeBlock, *Result, error) {
+	if attempts <= 0 {
+		attempts = DefaultAttempts
+	}
+	for attempt := 1; ; attempt++ {
+		var block *ollama.CodeBlock
+		blocks := &ollama.CodeBlockStreamer{
+			OnCodeBlockEnd: func(b *ollama.CodeBlock) error {
+				if block == nil && runner.Supports(b) {
+					block = b
+				}
+				return nil
+			},
+		}
+
+		var final ollama.Response
+		for res, err := range client.Stream(ctx, request) {
+			if err != nil {
+				return nil, nil, err
+			}
+			if request.OnJson != nil {
+				if err := request.OnJson(res); err != nil {
+					return nil, nil, fmt.Errorf("failed to process ollama response: %w", err)
+				}
+			}
+			if res.Response != nil {
+				if _, err := blocks.WriteString(*res.Response); err != nil {
+					return nil, nil, err
+				}
+			}
+			final = res
+		}
+		if err := blocks.Close(); err != nil {
+			return nil, nil, err
+		}
+		if block == nil {
+			return nil, nil, ErrNoCode
+		}
+
+		result, err := runner.Run(ctx, block)
+		if err != nil || result.OK() || attempt >= attempts {
+			return block, result, err
+		}
+
+		request.Context = final.Context
+		request.Prompt = fmt.Sprintf("I ran this code:\n\n```%s\n%s```\n\n%s\nFix the code and answer with the complete corrected program in a single code block.",
+			block.Info, block.Code, result.Feedback())
+	}
+}
@@ -0,0 +1,283 @@
+// Package sandbox runs code blocks extracted from model answers in a temporary
+// directory with a timeout, resource limits, a scrubbed environment and, on
+// Linux, without network access.
+//
+// It guards against accidents such as endless loops, fork bombs or a script
+// filling the disk. It is not a security boundary against hostile code: the
+// code runs as the current user and can read what the user can read.
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/eslider/go-ollama"
+)
+
+// DefaultTimeout is the wall-clock time a Runner created by New lets code run
+const DefaultTimeout = 30 * time.Second
+
+// DefaultMaxOutput is the number of bytes of stdout and stderr each a Runner created by New captures
+const DefaultMaxOutput = 64 << 10
+
+// Language describes how to run the code blocks of a fence language
+type Language struct {
+	File    string   // Name the code is written to in the temporary directory
+	Command []string // Command run in the temporary directory
+	Env     []string // Names of variables passed through from the environment, e.g. GOCACHE
+}
+
+var (
+	shell  = Language{File: "main.sh", Command: []string{"bash", "main.sh"}}
+	python = Language{File: "main.py", Command: []string{"python3", "main.py"}, Env: []string{"PYENV_ROOT", "PYENV_VERSION", "VIRTUAL_ENV"}}
+	golang = Language{File: "main.go", Command: []string{"go", "run", "main.go"}, Env: []string{"GOROOT", "GOPATH", "GOCACHE", "GOMODCACHE", "GOPROXY", "GOFLAGS", "GOTOOLCHAIN"}}
+)
+
+// DefaultLanguages are the languages a Runner runs when its Languages are nil, by fence language
+var DefaultLanguages = map[string]Language{
+	"bash":    shell,
+	"shell":   shell,
+	"sh":      {File: "main.sh", Command: []string{"sh", "main.sh"}},
+	"python":  python,
+	"python3": python,
+	"py":      python,
+	"go":      golang,
+	"golang":  golang,
+}
+
+// Limits are resource limits set with ulimit for the code and its child processes.
+// Zero means the limit is inherited.
+type Limits struct {
+	CPUTime   time.Duration // CPU time (ulimit -t), rounded up to seconds
+	Memory    int64         // Virtual memory in bytes (ulimit -v)
+	FileSize  int64         // Size of a written file in bytes (ulimit -f)
+	OpenFiles int           // Open file descriptors (ulimit -n)
+	Processes int           // Processes of the user (ulimit -u); counts all processes of the user, not only the sandboxed ones
+}
+
+// DefaultLimits are the limits of a Runner created by New
+var DefaultLimits = Limits{
+	CPUTime:   30 * time.Second,
+	Memory:    2 << 30,
+	FileSize:  64 << 20,
+	OpenFiles: 256,
+}
+
+// Runner runs code blocks
+type Runner struct {
+	Timeout   time.Duration       // Wall-clock time limit, none if zero
+	Limits    Limits              // Resource limits
+	Languages map[string]Language // Runnable languages, DefaultLanguages if nil
+	Env       []string            // Additional KEY=value environment variables
+	Network   bool                // Allow network access; otherwise the code runs in a new network namespace where the system supports it
+	MaxOutput int                 // Bytes of stdout and stderr each to capture, unlimited if zero
+}
+
+// New creates a Runner with DefaultTimeout, DefaultLimits and DefaultMaxOutput
+func New() *Runner {
+	return &Runner{
+		Timeout:   DefaultTimeout,
+		Limits:    DefaultLimits,
+		MaxOutput: DefaultMaxOutput,
+	}
+}
+
+// Result is the outcome of running a code block
+type Result struct {
+	Language        string        // Fence language of the block
+	Stdout          string        // Captured standard output
+	Stderr          string        // Captured standard error
+	ExitCode        int           // Exit code, -1 if the process was killed by a signal
+	Duration        time.Duration // Wall-clock run time
+	TimedOut        bool          // The process was killed after the Timeout
+	Truncated       bool          // Output beyond MaxOutput was dropped
+	NetworkIsolated bool          // The process ran in its own network namespace
+}
+
+// OK reports whether the code ran to completion with exit code 0
+func (r *Result) OK() bool {
+	return r.ExitCode == 0 && !r.TimedOut
+}
+
+// Feedback formats the result as a prompt, e.g. to ask the model to fix the code
+func (r *Result) Feedback() string {
+	var sb strings.Builder
+	switch {
+	case r.TimedOut:
+		fmt.Fprintf(&sb, "The program was stopped after %s without finishing.\n", r.Duration.Round(time.Millisecond))
+	case r.ExitCode == -1:
+		sb.WriteString("The program was killed, it probably exceeded a resource limit.\n")
+	case r.ExitCode != 0:
+		fmt.Fprintf(&sb, "The program failed with exit code %d.\n", r.ExitCode)
+	default:
+		sb.WriteString("The program ran successfully.\n")
+	}
+	for _, out := range []struct{ name, text string }{{"stdout", r.Stdout}, {"stderr", r.Stderr}} {
+		if out.text == "" {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n%s:\n```\n%s", out.name, out.text)
+		if !strings.HasSuffix(out.text, "\n") {
+			sb.WriteString("\n")
+		}
+		sb.WriteString("```\n")
+	}
+	if r.Truncated {
+		sb.WriteString("\n(output truncated)\n")
+	}
+	return sb.String()
+}
+
+// Supports reports whether the runner can run the code block
+func (r *Runner) Supports(block *ollama.CodeBlock) bool {
+	_, ok := r.language(block)
+	return ok
+}
+
+func (r *Runner) language(block *ollama.CodeBlock) (Language, bool) {
+	languages := r.Languages
+	if languages == nil {
+		languages = DefaultLanguages
+	}
+	lang, ok := languages[strings.ToLower(block.Type)]
+	return lang, ok
+}
+
+// Run writes the code block to a temporary directory and runs it there.
+// A non-zero exit code or a timeout is reported in the Result, not as an error.
+func (r *Runner) Run(ctx context.Context, block *ollama.CodeBlock) (*Result, error) {
+	lang, ok := r.language(block)
+	if !ok {
+		return nil, fmt.Errorf("no runner for %q code blocks", block.Type)
+	}
+
+	dir, err := os.MkdirTemp("", "ollama-sandbox-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sandbox directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ollama.WriteFile(filepath.Join(dir, lang.File), []byte(block.Code)); err != nil {
+		return nil, err
+	}
+
+	runCtx := ctx
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	result := &Result{Language: block.Type}
+	stdout := &limitedBuffer{max: r.MaxOutput}
+	stderr := &limitedBuffer{max: r.MaxOutput}
+	command := func(network bool) (*exec.Cmd, bool) {
+		// The shell sets the limits, then replaces itself with the command
+		args := append([]string{"-c", r.Limits.script(), "sh"}, lang.Command...)
+		cmd := exec.CommandContext(runCtx, "/bin/sh", args...)
+		cmd.Dir = dir
+		cmd.Env = r.environ(dir, lang)
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		cmd.WaitDelay = time.Second
+		return cmd, isolate(cmd, network)
+	}
+
+	start := time.Now()
+	cmd, isolated := command(r.Network)
+	err = cmd.Start()
+	if err != nil && isolated {
+		// Unprivileged namespaces are disabled on this system: run with the network
+		cmd, isolated = command(true)
+		err = cmd.Start()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", lang.Command[0], err)
+	}
+	result.NetworkIsolated = isolated
+	err = cmd.Wait()
+	result.Duration = time.Since(start)
+	result.Stdout = stdout.buf.String()
+	result.Stderr = stderr.buf.String()
+	result.Truncated = stdout.truncated || stderr.truncated
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return result, fmt.Errorf("sandbox run aborted: %w", ctxErr)
+	}
+	result.TimedOut = errors.Is(runCtx.Err(), context.DeadlineExceeded)
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	case result.TimedOut:
+		result.ExitCode = -1
+	default:
+		return result, fmt.Errorf("failed to run %s: %w", lang.Command[0], err)
+	}
+	return result, nil
+}
+
+// environ returns the scrubbed environment: PATH, the language's variables and the runner's Env
+func (r *Runner) environ(dir string, lang Language) []string {
+	env := []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + dir,
+		"TMPDIR=" + dir,
+		"LANG=C.UTF-8",
+	}
+	for _, name := range lang.Env {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return append(env, r.Env...)
+}
+
+// script returns the shell commands setting the limits before running "$@"
+func (l Limits) script() string {
+	var sb strings.Builder
+	if l.CPUTime > 0 {
+		fmt.Fprintf(&sb, "ulimit -t %d || exit 126\n", int64((l.CPUTime+time.Second-1)/time.Second))
+	}
+	if l.Memory > 0 {
+		fmt.Fprintf(&sb, "ulimit -v %d || exit 126\n", (l.Memory+1023)/1024)
+	}
+	if l.FileSize > 0 {
+		// POSIX counts in 512-byte blocks
+		fmt.Fprintf(&sb, "ulimit -f %d || exit 126\n", (l.FileSize+511)/512)
+	}
+	if l.OpenFiles > 0 {
+		fmt.Fprintf(&sb, "ulimit -n %d || exit 126\n", l.OpenFiles)
+	}
+	if l.Processes > 0 {
+		// bash names it -u, dash and busybox -p
+		fmt.Fprintf(&sb, "{ ulimit -u %[1]d || ulimit -p %[1]d; } 2>/dev/null || exit 126\n", l.Processes)
+	}
+	sb.WriteString(`exec "$@"`)
+	return sb.String()
+}
+
+// limitedBuffer keeps the first max bytes written to it, all if max is 0
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if b.max > 0 && b.buf.Len()+len(p) > b.max {
+		p = p[:b.max-b.buf.Len()]
+		b.truncated = true
+	}
+	b.buf.Write(p)
+	return n, nil
+}
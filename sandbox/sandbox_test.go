@@ -0,0 +1,190 @@
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eslider/go-ollama"
+)
+
+func requireBash(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not installed")
+	}
+}
+
+func TestRun_CapturesOutputAndExitCode(t *testing.T) {
+	requireBash(t)
+	res, err := New().Run(context.Background(), &ollama.CodeBlock{
+		Type: "bash",
+		Code: "echo out\necho err >&2\nexit 3\n",
+	})
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if res.Stdout != "out\n" || res.Stderr != "err\n" || res.ExitCode != 3 || res.OK() {
+		t.Errorf("result = %+v", res)
+	}
+}
+
+func TestRun_Timeout(t *testing.T) {
+	requireBash(t)
+	r := New()
+	r.Timeout = 200 * time.Millisecond
+	start := time.Now()
+	res, err := r.Run(context.Background(), &ollama.CodeBlock{Type: "bash", Code: "sleep 10 & sleep 10\n"})
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if !res.TimedOut || res.OK() {
+		t.Errorf("result = %+v, want timed out", res)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run took %s, children were not killed", elapsed)
+	}
+	if !strings.Contains(res.Feedback(), "stopped after") {
+		t.Errorf("Feedback = %q", res.Feedback())
+	}
+}
+
+func TestRun_ScrubsEnvironment(t *testing.T) {
+	requireBash(t)
+	t.Setenv("SANDBOX_SECRET", "hunter2")
+	r := New()
+	r.Env = []string{"GREETING=hi"}
+	res, err := r.Run(context.Background(), &ollama.CodeBlock{
+		Type: "bash",
+		Code: `echo "secret=$SANDBOX_SECRET greeting=$GREETING home=$HOME" && pwd`,
+	})
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(res.Stdout), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "secret= greeting=hi home=") {
+		t.Fatalf("stdout = %q", res.Stdout)
+	}
+	if home := strings.TrimPrefix(lines[0], "secret= greeting=hi home="); home != lines[1] {
+		t.Errorf("HOME = %q, want the sandbox directory %q", home, lines[1])
+	}
+}
+
+func TestRun_Limits(t *testing.T) {
+	requireBash(t)
+	r := New()
+	r.Limits.FileSize = 1 << 20
+	res, err := r.Run(context.Background(), &ollama.CodeBlock{
+		Type: "bash",
+		Code: "head -c 2000000 /dev/zero > big\n",
+	})
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if res.OK() {
+		t.Errorf("writing past the file size limit succeeded: %+v", res)
+	}
+}
+
+func TestRun_MaxOutput(t *testing.T) {
+	requireBash(t)
+	r := New()
+	r.MaxOutput = 10
+	res, err := r.Run(context.Background(), &ollama.CodeBlock{Type: "bash", Code: "seq 1 100\n"})
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if len(res.Stdout) != 10 || !res.Truncated {
+		t.Errorf("stdout = %q, truncated = %v", res.Stdout, res.Truncated)
+	}
+}
+
+func TestRun_NoNetwork(t *testing.T) {
+	requireBash(t)
+	res, err := New().Run(context.Background(), &ollama.CodeBlock{Type: "bash", Code: "cat /proc/net/dev\n"})
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if !res.NetworkIsolated {
+		t.Skip("network namespaces not available")
+	}
+	// Two header lines and the loopback interface only
+	if lines := strings.Split(strings.TrimSpace(res.Stdout), "\n"); len(lines) != 3 || !strings.Contains(lines[2], "lo:") {
+		t.Errorf("interfaces = %q, want loopback only", res.Stdout)
+	}
+}
+
+func TestRun_UnsupportedLanguage(t *testing.T) {
+	r := New()
+	block := &ollama.CodeBlock{Type: "cobol", Code: "DISPLAY 'HI'."}
+	if r.Supports(block) {
+		t.Error("Supports(cobol) = true")
+	}
+	if _, err := r.Run(context.Background(), block); err == nil {
+		t.Error("expected error for unsupported language")
+	}
+}
+
+func TestResult_Feedback(t *testing.T) {
+	res := &Result{ExitCode: 1, Stderr: "boom"}
+	want := "The program failed with exit code 1.\n\nstderr:\n```\nboom\n```\n"
+	if got := res.Feedback(); got != want {
+		t.Errorf("Feedback = %q, want %q", got, want)
+	}
+}
+
+func TestRefine_FixesFailingCode(t *testing.T) {
+	requireBash(t)
+	answers := []string{
+		"Here you go:\n```bash\necho broken; exit 1\n```\n",
+		"Fixed:\n```bash\necho fixed\n```\n",
+	}
+	var requests []ollama.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollama.Request
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+		answer, _ := json.Marshal(answers[len(requests)-1])
+		fmt.Fprintf(w, `{"response":%s,"done":false}`+"\n", answer)
+		fmt.Fprintf(w, `{"response":"","done":true,"context":[%d]}`+"\n", len(requests))
+	}))
+	defer srv.Close()
+
+	client := ollama.NewOpenWebUiClient(&ollama.DSN{URL: srv.URL + "/api/generate"})
+	block, res, err := Refine(context.Background(), client, ollama.Request{Model: "m", Prompt: "print fixed"}, New(), 0)
+	if err != nil {
+		t.Fatalf("Refine error: %v", err)
+	}
+	if !res.OK() || res.Stdout != "fixed\n" || block.Code != "echo fixed\n" {
+		t.Errorf("block = %q, result = %+v", block.Code, res)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	fix := requests[1]
+	if len(fix.Context) != 1 || fix.Context[0] != 1 {
+		t.Errorf("fix request context = %v, want [1]", fix.Context)
+	}
+	if !strings.Contains(fix.Prompt, "echo broken; exit 1") || !strings.Contains(fix.Prompt, "exit code 1") {
+		t.Errorf("fix prompt = %q", fix.Prompt)
+	}
+}
+
+func TestRefine_NoCode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"response":"I cannot help with that.","done":true}`+"\n")
+	}))
+	defer srv.Close()
+
+	client := ollama.NewOpenWebUiClient(&ollama.DSN{URL: srv.URL + "/api/generate"})
+	if _, _, err := Refine(context.Background(), client, ollama.Request{Model: "m"}, New(), 1); !errors.Is(err, ErrNoCode) {
+		t.Errorf("err = %v, want ErrNoCode", err)
+	}
+}
@@ -0,0 +1,281 @@
+package ollama
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON Schema document describing the shape of a JSON value.
+// Only the subset of keywords understood by Ollama is modelled.
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+}
+
+// SchemaFor reflects a JSON Schema from the type of v.
+//
+// Struct fields are named after their `json` tag and are required unless
+// tagged `omitempty` or declared as a pointer; Validate accepts null for optional
+// fields. Two extra tags are honoured:
+//   - `description:"..."` documents the field for the model
+//   - `enum:"a,b,c"` restricts a string, number or boolean field to the listed
+//     values, parsed as the field's kind; SchemaFor panics if one does not parse
+func SchemaFor(v any) *Schema {
+	return schemaOf(reflect.TypeOf(v), map[reflect.Type]bool{})
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaOf builds the schema of t; seen guards against recursive types.
+func schemaOf(t reflect.Type, seen map[reflect.Type]bool) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			// []byte is marshalled as a base64 string, [N]byte as an array of numbers
+			return &Schema{Type: "string"}
+		}
+		return &Schema{Type: "array", Items: schemaOf(t.Elem(), seen)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaOf(t.Elem(), seen)}
+	case reflect.Struct:
+		if seen[t] {
+			return &Schema{Type: "object"}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+
+		s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		addStructFields(s, t, seen)
+		return s
+	}
+	// Interfaces and anything else accept any value
+	return &Schema{}
+}
+
+// addStructFields adds the exported fields of struct type t to s,
+// flattening embedded structs the way encoding/json does.
+func addStructFields(s *Schema, t reflect.Type, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				addStructFields(s, ft, seen)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop := schemaOf(f.Type, seen)
+		prop.Description = f.Tag.Get("description")
+		if enum := f.Tag.Get("enum"); enum != "" {
+			prop.Enum = enumValues(f, prop.Type, enum)
+		}
+		s.Properties[name] = prop
+
+		optional := f.Type.Kind() == reflect.Pointer
+		for _, o := range strings.Split(opts, ",") {
+			if o == "omitempty" || o == "omitzero" {
+				optional = true
+			}
+		}
+		if !optional {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// enumValues parses the comma-separated values of the enum tag of field f
+// as the JSON type of its schema.
+func enumValues(f reflect.StructField, typ, tag string) []any {
+	var values []any
+	for _, raw := range strings.Split(tag, ",") {
+		var (
+			v   any
+			err error
+		)
+		switch typ {
+		case "string":
+			v = raw
+		case "boolean":
+			v, err = strconv.ParseBool(raw)
+		case "integer":
+			v, err = strconv.ParseInt(raw, 10, 64)
+		case "number":
+			v, err = strconv.ParseFloat(raw, 64)
+		default:
+			err = fmt.Errorf("enum is not supported on %s fields", f.Type)
+		}
+		if err != nil {
+			panic(fmt.Sprintf("ollama: enum tag of field %s: %v", f.Name, err))
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// enumContains reports whether the decoded JSON value v is one of values.
+func enumContains(values []any, v any) bool {
+	n, isNumber := v.(json.Number)
+	for _, want := range values {
+		switch want := want.(type) {
+		case int64:
+			if got, err := n.Int64(); isNumber && err == nil && got == want {
+				return true
+			}
+		case float64:
+			if got, err := n.Float64(); isNumber && err == nil && got == want {
+				return true
+			}
+		default:
+			if v == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Validate checks that the JSON document data matches the schema.
+// The returned error names the path of the first offending value, e.g. "$.items[2].name".
+func (s *Schema) Validate(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return s.validate("$", v)
+}
+
+func (s *Schema) validate(path string, v any) error {
+	if s == nil {
+		return nil
+	}
+	if len(s.Enum) > 0 {
+		if !enumContains(s.Enum, v) {
+			values := make([]string, len(s.Enum))
+			for i, e := range s.Enum {
+				values[i] = fmt.Sprint(e)
+			}
+			return fmt.Errorf("%s: must be one of %s", path, strings.Join(values, ", "))
+		}
+	}
+
+	switch s.Type {
+	case "":
+		return nil
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean", path)
+		}
+	case "string":
+		if _, ok := v.(string); !ok {
+			return fmt.Errorf("%s: expected string", path)
+		}
+	case "number":
+		if _, ok := v.(json.Number); !ok {
+			return fmt.Errorf("%s: expected number", path)
+		}
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s: expected integer", path)
+		}
+		if _, err := n.Int64(); err != nil {
+			return fmt.Errorf("%s: expected integer, got %s", path, n)
+		}
+	case "array":
+		items, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expected array", path)
+		}
+		for i, item := range items {
+			if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+				return err
+			}
+		}
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected object", path)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+		// Walk properties in a stable order so the same document reports the same error
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, ok := s.Properties[name]
+			if !ok {
+				prop = s.AdditionalProperties
+			} else if obj[name] == nil && !slices.Contains(s.Required, name) {
+				// Models often write null for optional properties, which decodes fine
+				continue
+			}
+			if err := prop.validate(path+"."+name, obj[name]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
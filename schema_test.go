@@ -0,0 +1,148 @@
+package ollama
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type person struct {
+	Name    string   `json:"name"`
+	Age     int      `json:"age"`
+	Email   *string  `json:"email"`
+	Tags    []string `json:"tags,omitempty"`
+	Mood    string   `json:"mood,omitempty" enum:"happy,sad"`
+	private int
+}
+
+func TestSchemaFor_Struct(t *testing.T) {
+	s := SchemaFor(person{})
+
+	if s.Type != "object" {
+		t.Fatalf("type = %q, want object", s.Type)
+	}
+	if strings.Join(s.Required, ",") != "name,age" {
+		t.Errorf("required = %v, want [name age]", s.Required)
+	}
+	if s.Properties["age"].Type != "integer" {
+		t.Errorf("age type = %q, want integer", s.Properties["age"].Type)
+	}
+	if s.Properties["tags"].Type != "array" || s.Properties["tags"].Items.Type != "string" {
+		t.Errorf("tags schema = %+v", s.Properties["tags"])
+	}
+	if _, ok := s.Properties["private"]; ok {
+		t.Error("unexported field should not be in the schema")
+	}
+}
+
+func TestSchema_Validate(t *testing.T) {
+	s := SchemaFor(person{})
+	for _, tc := range []struct {
+		name    string
+		doc     string
+		wantErr string
+	}{
+		{"valid", `{"name":"Ann","age":30,"tags":["a"]}`, ""},
+		{"null optional", `{"name":"Ann","age":30,"email":null,"tags":null,"mood":null}`, ""},
+		{"null required", `{"name":null,"age":30}`, "$.name: expected string"},
+		{"missing required", `{"name":"Ann"}`, `$: missing required property "age"`},
+		{"wrong type", `{"name":"Ann","age":"30"}`, "$.age: expected integer"},
+		{"fractional integer", `{"name":"Ann","age":30.5}`, "$.age: expected integer"},
+		{"array item", `{"name":"Ann","age":1,"tags":["a",2]}`, "$.tags[1]: expected string"},
+		{"enum", `{"name":"Ann","age":1,"mood":"angry"}`, "$.mood: must be one of happy, sad"},
+		{"not json", `{"name":`, "invalid JSON"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := s.Validate([]byte(tc.doc))
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestSchemaFor_EnumKinds(t *testing.T) {
+	type reading struct {
+		Level  int     `json:"level" enum:"1,2,3"`
+		Scale  float64 `json:"scale" enum:"0.5,1"`
+		Strict bool    `json:"strict" enum:"true"`
+	}
+	s := SchemaFor(reading{})
+	if err := s.Validate([]byte(`{"level":2,"scale":0.5,"strict":true}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for doc, wantErr := range map[string]string{
+		`{"level":4,"scale":1,"strict":true}`:   "$.level: must be one of 1, 2, 3",
+		`{"level":"2","scale":1,"strict":true}`: "$.level: must be one of 1, 2, 3",
+		`{"level":1,"scale":2,"strict":true}`:   "$.scale: must be one of 0.5, 1",
+		`{"level":1,"scale":1,"strict":false}`:  "$.strict: must be one of true",
+	} {
+		if err := s.Validate([]byte(doc)); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("%s: error = %v, want %q", doc, err, wantErr)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("enum value of the wrong kind should panic")
+		}
+	}()
+	SchemaFor(struct {
+		Level int `json:"level" enum:"low,high"`
+	}{})
+}
+
+func TestSchemaFor_ByteArrays(t *testing.T) {
+	s := SchemaFor(struct {
+		Data []byte  `json:"data"`
+		Hash [4]byte `json:"hash"`
+	}{})
+	if s.Properties["data"].Type != "string" {
+		t.Errorf("[]byte schema = %+v, want string", s.Properties["data"])
+	}
+	if s.Properties["hash"].Type != "array" || s.Properties["hash"].Items.Type != "integer" {
+		t.Errorf("[4]byte schema = %+v, want array of integers", s.Properties["hash"])
+	}
+
+	data, err := json.Marshal(struct {
+		Data []byte  `json:"data"`
+		Hash [4]byte `json:"hash"`
+	}{[]byte("hi"), [4]byte{1, 2, 3, 4}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Validate(data); err != nil {
+		t.Errorf("marshalled value does not validate: %v", err)
+	}
+}
+
+func TestRequestFormat_MarshalSchema(t *testing.T) {
+	r := Request{
+		Model:  "m",
+		Prompt: "p",
+		Format: SchemaFormat(&Schema{Type: "object", Properties: map[string]*Schema{"a": {Type: "string"}}}),
+	}
+	js := r.ToJson()
+	if !strings.Contains(js, `"format":{"type":"object","properties":{"a":{"type":"string"}}}`) {
+		t.Errorf("schema not embedded as object: %s", js)
+	}
+
+	js = (&Request{Model: "m", Format: new(FormatJson)}).ToJson()
+	if !strings.Contains(js, `"format":"json"`) {
+		t.Errorf("named format not a string: %s", js)
+	}
+
+	var back Request
+	if err := json.Unmarshal([]byte(`{"format":{"type":"object"}}`), &back); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if back.Format == nil || !back.Format.IsSchema() {
+		t.Errorf("format = %v, want schema", back.Format)
+	}
+}
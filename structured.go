@@ -0,0 +1,62 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// QueryInto asks the model for a value of type T.
+// See QueryIntoContext.
+func QueryInto[T any](client *Client, request Request) (T, error) {
+	return QueryIntoContext[T](context.Background(), client, request, 0)
+}
+
+// QueryIntoContext asks the model for a value of type T and decodes the answer into it.
+//
+// The JSON Schema of T is reflected by SchemaFor and sent as the request Format.
+// The streamed response pieces are accumulated, validated against the schema
+// and unmarshalled. When validation fails the model is re-prompted with the
+// validation error up to retries times before giving up.
+// request.OnJson, if set, still receives every streamed fragment.
+func QueryIntoContext[T any](ctx context.Context, client *Client, request Request, retries int) (T, error) {
+	var zero T
+	schema := SchemaFor(zero)
+	request.Format = SchemaFormat(schema)
+
+	prompt := request.Prompt
+	onJson := request.OnJson
+
+	for attempt := 0; ; attempt++ {
+		var answer strings.Builder
+		request.OnJson = func(res Response) error {
+			if res.Response != nil {
+				answer.WriteString(*res.Response)
+			}
+			if onJson != nil {
+				return onJson(res)
+			}
+			return nil
+		}
+		if err := client.QueryContext(ctx, request); err != nil {
+			return zero, err
+		}
+
+		data := []byte(answer.String())
+		err := schema.Validate(data)
+		if err == nil {
+			var v T
+			if err = json.Unmarshal(data, &v); err == nil {
+				return v, nil
+			}
+		}
+		if attempt >= retries {
+			return zero, fmt.Errorf("model output does not match schema after %d attempt(s): %w", attempt+1, err)
+		}
+
+		// Show the model its own answer and what is wrong with it
+		request.Prompt = fmt.Sprintf("%s\n\nYour previous answer was:\n%s\n\nIt is invalid: %s\nAnswer again with JSON that matches the schema.",
+			prompt, answer.String(), err)
+	}
+}
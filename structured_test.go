@@ -0,0 +1,77 @@
+package ollama
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type cityInfo struct {
+	City       string `json:"city"`
+	Population int    `json:"population"`
+}
+
+func TestQueryInto_DecodesStruct(t *testing.T) {
+	var gotFormat json.RawMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Format json.RawMessage `json:"format"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		gotFormat = body.Format
+		fmt.Fprint(w, simulateStreamBody([]string{`{"city":"Berlin",`, `"population":3850000}`}, "m"))
+	}))
+	defer srv.Close()
+
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL})
+	info, err := QueryInto[cityInfo](client, Request{Model: "m", Prompt: "Largest German city?"})
+	if err != nil {
+		t.Fatalf("QueryInto error: %v", err)
+	}
+	if info.City != "Berlin" || info.Population != 3850000 {
+		t.Errorf("got %+v", info)
+	}
+	if !strings.Contains(string(gotFormat), `"required":["city","population"]`) {
+		t.Errorf("format schema not sent: %s", gotFormat)
+	}
+}
+
+func TestQueryIntoContext_RepromptsOnValidationError(t *testing.T) {
+	var prompts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		prompts = append(prompts, req.Prompt)
+		if len(prompts) == 1 {
+			fmt.Fprint(w, simulateStreamBody([]string{`{"city":"Berlin"}`}, "m"))
+			return
+		}
+		fmt.Fprint(w, simulateStreamBody([]string{`{"city":"Berlin","population":1}`}, "m"))
+	}))
+	defer srv.Close()
+
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL})
+
+	_, err := QueryInto[cityInfo](client, Request{Model: "m", Prompt: "q"})
+	if err == nil || !strings.Contains(err.Error(), "missing required property") {
+		t.Fatalf("error = %v, want validation error", err)
+	}
+
+	prompts = nil
+	info, err := QueryIntoContext[cityInfo](t.Context(), client, Request{Model: "m", Prompt: "q"}, 2)
+	if err != nil {
+		t.Fatalf("QueryIntoContext error: %v", err)
+	}
+	if info.Population != 1 {
+		t.Errorf("got %+v", info)
+	}
+	if len(prompts) != 2 {
+		t.Fatalf("got %d requests, want 2", len(prompts))
+	}
+	if !strings.Contains(prompts[1], `missing required property "population"`) {
+		t.Errorf("retry prompt lacks validation error: %q", prompts[1])
+	}
+}
@@ -0,0 +1,162 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// DefaultMaxToolSteps is the number of chat rounds RunTools allows when maxSteps is not positive.
+const DefaultMaxToolSteps = 10
+
+// Tool is a function the model may call.
+// See: https://github.com/ollama/ollama/blob/main/docs/api.md#chat-request-with-tools
+type Tool struct {
+	Type     string       `json:"type"` // Always "function"
+	Function ToolFunction `json:"function"`
+}
+
+// ToolFunction describes the name, purpose and parameters of a tool
+type ToolFunction struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Parameters  *Schema `json:"parameters"` // JSON Schema of the arguments object
+}
+
+// ToolCall is a request from the model to call a tool
+type ToolCall struct {
+	ID       string           `json:"id,omitempty"` // Set by BackendOpenAI servers, echoed in ChatMessage.ToolCallID
+	Function ToolCallFunction `json:"function"`
+}
+
+// ToolCallFunction is the name of the called tool and its arguments object
+type ToolCallFunction struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// ToolHandler executes a tool call and returns the result passed back to the model
+type ToolHandler func(ctx context.Context, arguments json.RawMessage) (string, error)
+
+// ToolRegistry maps tool names to their definitions and Go handlers
+type ToolRegistry struct {
+	tools    map[string]Tool
+	handlers map[string]ToolHandler
+}
+
+// NewToolRegistry creates an empty ToolRegistry
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{
+		tools:    map[string]Tool{},
+		handlers: map[string]ToolHandler{},
+	}
+}
+
+// Register adds a tool with a raw JSON handler, replacing any tool of the same name
+func (r *ToolRegistry) Register(tool Tool, handler ToolHandler) {
+	if tool.Type == "" {
+		tool.Type = "function"
+	}
+	r.tools[tool.Function.Name] = tool
+	r.handlers[tool.Function.Name] = handler
+}
+
+// RegisterTool adds a typed tool to the registry.
+// The parameters schema is reflected from T (see SchemaFor) and the model's
+// arguments are unmarshalled into a T before fn is called.
+func RegisterTool[T any](r *ToolRegistry, name, description string, fn func(ctx context.Context, args T) (string, error)) {
+	var zero T
+	r.Register(Tool{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        name,
+			Description: description,
+			Parameters:  SchemaFor(zero),
+		},
+	}, func(ctx context.Context, arguments json.RawMessage) (string, error) {
+		var args T
+		if len(arguments) > 0 {
+			if err := json.Unmarshal(arguments, &args); err != nil {
+				return "", fmt.Errorf("invalid arguments for tool %s: %w", name, err)
+			}
+		}
+		return fn(ctx, args)
+	})
+}
+
+// Tools returns the registered tool definitions, sorted by name
+func (r *ToolRegistry) Tools() []Tool {
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tools := make([]Tool, 0, len(names))
+	for _, name := range names {
+		tools = append(tools, r.tools[name])
+	}
+	return tools
+}
+
+// Call executes a tool call with the matching handler
+func (r *ToolRegistry) Call(ctx context.Context, call ToolCall) (string, error) {
+	handler, ok := r.handlers[call.Function.Name]
+	if !ok {
+		return "", fmt.Errorf("unknown tool: %s", call.Function.Name)
+	}
+	return handler(ctx, call.Function.Arguments)
+}
+
+// RunTools runs an agent loop: it sends the conversation with the registry's
+// tools, executes every tool call the model makes and feeds the results back
+// as tool messages, until the model answers without calling a tool.
+//
+// Tool errors are reported to the model as the tool result so it can recover.
+// request.OnJson, if set, still receives every streamed fragment.
+// Returns the conversation including all assistant and tool messages.
+func (c *Client) RunTools(ctx context.Context, request ChatRequest, registry *ToolRegistry, maxSteps int) ([]ChatMessage, error) {
+	if maxSteps <= 0 {
+		maxSteps = DefaultMaxToolSteps
+	}
+	request.Tools = registry.Tools()
+	messages := append([]ChatMessage(nil), request.Messages...)
+	onJson := request.OnJson
+
+	for step := 0; step < maxSteps; step++ {
+		reply := ChatMessage{Role: RoleAssistant}
+		request.Messages = messages
+		request.OnJson = func(res ChatResponse) error {
+			if res.Message != nil {
+				reply.Content += res.Message.Content
+				reply.ToolCalls = append(reply.ToolCalls, res.Message.ToolCalls...)
+			}
+			if onJson != nil {
+				return onJson(res)
+			}
+			return nil
+		}
+		if err := c.ChatContext(ctx, request); err != nil {
+			return messages, err
+		}
+		messages = append(messages, reply)
+
+		if len(reply.ToolCalls) == 0 {
+			return messages, nil
+		}
+		for _, call := range reply.ToolCalls {
+			result, err := registry.Call(ctx, call)
+			if err != nil {
+				result = "error: " + err.Error()
+			}
+			messages = append(messages, ChatMessage{
+				Role:       RoleTool,
+				Content:    result,
+				ToolName:   call.Function.Name,
+				ToolCallID: call.ID,
+			})
+		}
+	}
+	return messages, fmt.Errorf("model still calling tools after %d steps", maxSteps)
+}
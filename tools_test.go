@@ -0,0 +1,126 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type weatherArgs struct {
+	City string `json:"city" description:"Name of the city"`
+	Unit string `json:"unit,omitempty" enum:"celsius,fahrenheit"`
+}
+
+func TestRegisterTool_Schema(t *testing.T) {
+	reg := NewToolRegistry()
+	RegisterTool(reg, "get_weather", "Current weather for a city", func(ctx context.Context, args weatherArgs) (string, error) {
+		return "sunny", nil
+	})
+
+	tools := reg.Tools()
+	if len(tools) != 1 {
+		t.Fatalf("got %d tools, want 1", len(tools))
+	}
+	params := tools[0].Function.Parameters
+	if params.Type != "object" {
+		t.Errorf("parameters type = %q, want object", params.Type)
+	}
+	if len(params.Required) != 1 || params.Required[0] != "city" {
+		t.Errorf("required = %v, want [city]", params.Required)
+	}
+	if params.Properties["city"].Description != "Name of the city" {
+		t.Errorf("city description = %q", params.Properties["city"].Description)
+	}
+	if got := params.Properties["unit"].Enum; len(got) != 2 || got[1] != "fahrenheit" {
+		t.Errorf("unit enum = %v", got)
+	}
+}
+
+func TestRunTools_AgentLoop(t *testing.T) {
+	var requests []ChatRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+
+		if len(requests) == 1 {
+			fmt.Fprint(w, `{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"get_weather","arguments":{"city":"Berlin"}}}]},"done":false}`+"\n")
+			fmt.Fprint(w, `{"message":{"role":"assistant","content":""},"done":true}`+"\n")
+			return
+		}
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":"It is sunny in Berlin."},"done":true}`+"\n")
+	}))
+	defer srv.Close()
+
+	reg := NewToolRegistry()
+	var gotCity string
+	RegisterTool(reg, "get_weather", "Current weather for a city", func(ctx context.Context, args weatherArgs) (string, error) {
+		gotCity = args.City
+		return "sunny, 21°C", nil
+	})
+
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"})
+	messages, err := client.RunTools(context.Background(), ChatRequest{
+		Model:    "m",
+		Messages: []ChatMessage{{Role: RoleUser, Content: "Weather in Berlin?"}},
+	}, reg, 0)
+	if err != nil {
+		t.Fatalf("RunTools error: %v", err)
+	}
+
+	if gotCity != "Berlin" {
+		t.Errorf("tool got city %q, want Berlin", gotCity)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("server got %d requests, want 2", len(requests))
+	}
+	if len(requests[0].Tools) != 1 || requests[0].Tools[0].Function.Name != "get_weather" {
+		t.Errorf("first request tools = %+v", requests[0].Tools)
+	}
+
+	// user, assistant (tool call), tool result, final assistant answer
+	if len(messages) != 4 {
+		t.Fatalf("got %d messages, want 4", len(messages))
+	}
+	if messages[2].Role != RoleTool || messages[2].Content != "sunny, 21°C" || messages[2].ToolName != "get_weather" {
+		t.Errorf("tool message = %+v", messages[2])
+	}
+	if len(requests[1].Messages) != 3 || requests[1].Messages[2].Role != RoleTool {
+		t.Errorf("second request did not carry the tool result: %+v", requests[1].Messages)
+	}
+	if !strings.Contains(messages[3].Content, "sunny") {
+		t.Errorf("final answer = %q", messages[3].Content)
+	}
+}
+
+func TestRunTools_UnknownToolReportedToModel(t *testing.T) {
+	var calls int
+	var lastReq ChatRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_ = json.NewDecoder(r.Body).Decode(&lastReq)
+		if calls == 1 {
+			fmt.Fprint(w, `{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"missing","arguments":{}}}]},"done":true}`+"\n")
+			return
+		}
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":"sorry"},"done":true}`+"\n")
+	}))
+	defer srv.Close()
+
+	client := NewOpenWebUiClient(&DSN{URL: srv.URL + "/api/generate"})
+	_, err := client.RunTools(context.Background(), ChatRequest{
+		Model:    "m",
+		Messages: []ChatMessage{{Role: RoleUser, Content: "hi"}},
+	}, NewToolRegistry(), 3)
+	if err != nil {
+		t.Fatalf("RunTools error: %v", err)
+	}
+	last := lastReq.Messages[len(lastReq.Messages)-1]
+	if last.Role != RoleTool || !strings.Contains(last.Content, "unknown tool") {
+		t.Errorf("tool error not fed back: %+v", last)
+	}
+}
@@ -0,0 +1,70 @@
+package vector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/eslider/go-ollama"
+)
+
+// DefaultBatchSize is the number of documents a Collection embeds per request when BatchSize is not positive
+const DefaultBatchSize = 32
+
+// Collection is an Index whose documents are embedded with an Ollama model
+type Collection struct {
+	*Index
+	Model       string // Embedding model, e.g. "nomic-embed-text"
+	BatchSize   int    // Documents per Embed request
+	Concurrency int    // Embed requests in flight at once, 1 if not positive
+}
+
+// NewCollection creates an empty cosine collection embedding with model
+func NewCollection(model string) *Collection {
+	return &Collection{Index: NewIndex(Cosine), Model: model, BatchSize: DefaultBatchSize}
+}
+
+// Add embeds the documents' texts in batches with Client.EmbedAll and stores them.
+// Documents without an ID get one derived from their text, so adding the same text twice stores it once.
+// If some batches fail, the other documents are stored and the *ollama.EmbedAllError is returned.
+func (c *Collection) Add(ctx context.Context, client *ollama.Client, docs []Document) error {
+	size := c.BatchSize
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	input := make([]string, len(docs))
+	for i, doc := range docs {
+		input[i] = doc.Text
+	}
+
+	embeddings, embedErr := client.EmbedAll(ctx, c.Model, input, ollama.EmbedOptions{BatchSize: size, Concurrency: c.Concurrency})
+	for i, doc := range docs {
+		if embeddings[i] == nil {
+			continue
+		}
+		if doc.ID == "" {
+			sum := sha256.Sum256([]byte(doc.Text))
+			doc.ID = hex.EncodeToString(sum[:8])
+		}
+		if err := c.Index.Add(doc, FromFloat64(embeddings[i])); err != nil {
+			return err
+		}
+	}
+	if embedErr != nil {
+		return fmt.Errorf("failed to embed documents: %w", embedErr)
+	}
+	return nil
+}
+
+// Query embeds text and returns the k most similar documents
+func (c *Collection) Query(ctx context.Context, client *ollama.Client, text string, k int) ([]Match, error) {
+	res, err := client.EmbedContext(ctx, ollama.EmbedRequest{Model: c.Model, Input: []string{text}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	if len(res.Embeddings) != 1 {
+		return nil, fmt.Errorf("embed returned %d embeddings for 1 query", len(res.Embeddings))
+	}
+	return c.Search(FromFloat64(res.Embeddings[0]), k)
+}
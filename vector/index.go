@@ -0,0 +1,251 @@
+package vector
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/eslider/go-ollama"
+)
+
+// Document is a stored text with its metadata
+type Document struct {
+	ID       string
+	Text     string
+	Metadata map[string]string
+}
+
+// Match is a search result
+type Match struct {
+	Document
+	Score float32 // Similarity to the query, higher is more similar
+}
+
+// Index is an in-memory vector index, safe for concurrent use
+type Index struct {
+	metric Metric
+
+	mu      sync.RWMutex
+	dim     int
+	docs    []Document
+	vectors [][]float32
+	byID    map[string]int
+}
+
+// NewIndex creates an empty index comparing vectors with metric
+func NewIndex(metric Metric) *Index {
+	return &Index{metric: metric, byID: map[string]int{}}
+}
+
+// Metric returns the similarity measure of the index
+func (ix *Index) Metric() Metric {
+	return ix.metric
+}
+
+// Dim returns the dimension of the stored vectors, 0 while the index is empty
+func (ix *Index) Dim() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.dim
+}
+
+// Len returns the number of stored documents
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.docs)
+}
+
+// Add stores a document with its embedding, replacing a document with the same ID.
+// All embeddings of an index must have the same dimension.
+func (ix *Index) Add(doc Document, embedding []float32) error {
+	if doc.ID == "" {
+		return fmt.Errorf("document has no ID")
+	}
+	if len(embedding) == 0 {
+		return fmt.Errorf("document %s has an empty embedding", doc.ID)
+	}
+	if ix.metric == Cosine {
+		embedding = Normalize(embedding)
+	} else {
+		embedding = append([]float32(nil), embedding...)
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if ix.dim == 0 {
+		ix.dim = len(embedding)
+	} else if len(embedding) != ix.dim {
+		return fmt.Errorf("document %s has dimension %d, index has %d", doc.ID, len(embedding), ix.dim)
+	}
+	if i, ok := ix.byID[doc.ID]; ok {
+		ix.docs[i] = doc
+		ix.vectors[i] = embedding
+		return nil
+	}
+	ix.byID[doc.ID] = len(ix.docs)
+	ix.docs = append(ix.docs, doc)
+	ix.vectors = append(ix.vectors, embedding)
+	return nil
+}
+
+// Get returns the document with the given ID
+func (ix *Index) Get(id string) (Document, bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	i, ok := ix.byID[id]
+	if !ok {
+		return Document{}, false
+	}
+	return ix.docs[i], true
+}
+
+// Delete removes the document with the given ID and reports whether it was stored
+func (ix *Index) Delete(id string) bool {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	i, ok := ix.byID[id]
+	if !ok {
+		return false
+	}
+	// Move the last document into the gap
+	last := len(ix.docs) - 1
+	ix.docs[i], ix.vectors[i] = ix.docs[last], ix.vectors[last]
+	ix.byID[ix.docs[i].ID] = i
+	ix.docs, ix.vectors = ix.docs[:last], ix.vectors[:last]
+	delete(ix.byID, id)
+	return true
+}
+
+// Search returns the k documents most similar to the query, most similar first
+func (ix *Index) Search(query []float32, k int) ([]Match, error) {
+	return ix.SearchFunc(query, k, nil)
+}
+
+// SearchFunc is like Search but only considers the documents keep returns true for, e.g. to filter by metadata
+func (ix *Index) SearchFunc(query []float32, k int, keep func(Document) bool) ([]Match, error) {
+	if ix.metric == Cosine {
+		query = Normalize(query)
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	if len(ix.docs) == 0 || k <= 0 {
+		return nil, nil
+	}
+	if len(query) != ix.dim {
+		return nil, fmt.Errorf("query has dimension %d, index has %d", len(query), ix.dim)
+	}
+
+	// Keep the best k in a min-heap, so the worst of them is replaced first
+	top := &matchHeap{}
+	for i, v := range ix.vectors {
+		if keep != nil && !keep(ix.docs[i]) {
+			continue
+		}
+		score := ix.metric.score(query, v)
+		if top.Len() < k {
+			heap.Push(top, Match{Document: ix.docs[i], Score: score})
+		} else if score > (*top)[0].Score {
+			(*top)[0] = Match{Document: ix.docs[i], Score: score}
+			heap.Fix(top, 0)
+		}
+	}
+
+	matches := make([]Match, top.Len())
+	for i := len(matches) - 1; i >= 0; i-- {
+		matches[i] = heap.Pop(top).(Match)
+	}
+	return matches, nil
+}
+
+type matchHeap []Match
+
+func (h matchHeap) Len() int           { return len(h) }
+func (h matchHeap) Less(i, j int) bool { return h[i].Score < h[j].Score }
+func (h matchHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *matchHeap) Push(x any)        { *h = append(*h, x.(Match)) }
+func (h *matchHeap) Pop() any {
+	old := *h
+	m := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return m
+}
+
+// indexFile is the gob-encoded form of an Index
+type indexFile struct {
+	Version int
+	Metric  Metric
+	Dim     int
+	Docs    []Document
+	Vectors [][]float32
+}
+
+const indexFileVersion = 1
+
+// Save writes the index to w in gob format
+func (ix *Index) Save(w io.Writer) error {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	err := gob.NewEncoder(w).Encode(indexFile{
+		Version: indexFileVersion,
+		Metric:  ix.metric,
+		Dim:     ix.dim,
+		Docs:    ix.docs,
+		Vectors: ix.vectors,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode index: %w", err)
+	}
+	return nil
+}
+
+// SaveFile writes the index to the file at path, creating its directory if needed
+func (ix *Index) SaveFile(path string) error {
+	var buf bytes.Buffer
+	if err := ix.Save(&buf); err != nil {
+		return err
+	}
+	return ollama.WriteFile(path, buf.Bytes())
+}
+
+// Load reads an index written by Save
+func Load(r io.Reader) (*Index, error) {
+	var f indexFile
+	if err := gob.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("failed to decode index: %w", err)
+	}
+	if f.Version != indexFileVersion {
+		return nil, fmt.Errorf("unsupported index version %d", f.Version)
+	}
+	if len(f.Docs) != len(f.Vectors) {
+		return nil, fmt.Errorf("corrupt index: %d documents, %d vectors", len(f.Docs), len(f.Vectors))
+	}
+	for i, v := range f.Vectors {
+		if len(v) != f.Dim || f.Dim == 0 {
+			return nil, fmt.Errorf("corrupt index: document %s has dimension %d, index has %d", f.Docs[i].ID, len(v), f.Dim)
+		}
+	}
+	ix := NewIndex(f.Metric)
+	ix.dim = f.Dim
+	ix.docs = f.Docs
+	ix.vectors = f.Vectors
+	for i, doc := range f.Docs {
+		ix.byID[doc.ID] = i
+	}
+	return ix, nil
+}
+
+// LoadFile reads an index written by SaveFile
+func LoadFile(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index: %w", err)
+	}
+	defer f.Close()
+	return Load(f)
+}
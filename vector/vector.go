@@ -0,0 +1,100 @@
+// Package vector is an in-memory vector store for embeddings returned by
+// Client.Embed, with cosine, dot product and Euclidean (L2) similarity search.
+package vector
+
+import (
+	"fmt"
+	"math"
+)
+
+// Metric is the similarity measure of an Index
+type Metric int
+
+// Enumerate metrics
+const (
+	Cosine Metric = iota // cosine similarity; vectors are stored normalized
+	Dot                  // dot product
+	L2                   // Euclidean distance; the score of a match is the negated distance
+)
+
+// String returns the name of the metric
+func (m Metric) String() string {
+	switch m {
+	case Cosine:
+		return "cosine"
+	case Dot:
+		return "dot"
+	case L2:
+		return "l2"
+	}
+	return fmt.Sprintf("Metric(%d)", int(m))
+}
+
+// score returns the similarity of a and b under the metric, higher is more similar.
+// For Cosine both vectors must be normalized.
+func (m Metric) score(a, b []float32) float32 {
+	if m == L2 {
+		return -L2Distance(a, b)
+	}
+	return DotProduct(a, b)
+}
+
+// FromFloat64 converts an embedding as returned by Client.Embed to float32
+func FromFloat64(v []float64) []float32 {
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = float32(x)
+	}
+	return out
+}
+
+// Normalize returns a copy of v scaled to unit length, or a copy of v if it is the zero vector
+func Normalize(v []float32) []float32 {
+	out := make([]float32, len(v))
+	n := Norm(v)
+	for i, x := range v {
+		if n == 0 {
+			out[i] = x
+		} else {
+			out[i] = x / n
+		}
+	}
+	return out
+}
+
+// Norm returns the Euclidean length of v
+func Norm(v []float32) float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	return float32(math.Sqrt(sum))
+}
+
+// DotProduct returns the dot product of a and b, which must have the same length
+func DotProduct(a, b []float32) float32 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return float32(sum)
+}
+
+// CosineSimilarity returns the cosine of the angle between a and b, 0 if either is the zero vector
+func CosineSimilarity(a, b []float32) float32 {
+	na, nb := Norm(a), Norm(b)
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return DotProduct(a, b) / (na * nb)
+}
+
+// L2Distance returns the Euclidean distance between a and b
+func L2Distance(a, b []float32) float32 {
+	var sum float64
+	for i := range a {
+		d := float64(a[i]) - float64(b[i])
+		sum += d * d
+	}
+	return float32(math.Sqrt(sum))
+}
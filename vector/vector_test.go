@@ -0,0 +1,196 @@
+package vector
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eslider/go-ollama"
+)
+
+func near(a, b float32) bool {
+	return math.Abs(float64(a-b)) < 1e-5
+}
+
+func TestMetrics(t *testing.T) {
+	a := []float32{1, 0}
+	b := []float32{1, 1}
+	if got := CosineSimilarity(a, b); !near(got, float32(1/math.Sqrt2)) {
+		t.Errorf("CosineSimilarity = %v", got)
+	}
+	if got := DotProduct(a, b); got != 1 {
+		t.Errorf("DotProduct = %v", got)
+	}
+	if got := L2Distance(a, b); got != 1 {
+		t.Errorf("L2Distance = %v", got)
+	}
+	if got := Norm(Normalize([]float32{3, 4})); !near(got, 1) {
+		t.Errorf("Norm(Normalize) = %v", got)
+	}
+	if got := CosineSimilarity([]float32{0, 0}, b); got != 0 {
+		t.Errorf("CosineSimilarity with zero vector = %v", got)
+	}
+}
+
+func TestIndex_SearchTopK(t *testing.T) {
+	for _, metric := range []Metric{Cosine, Dot, L2} {
+		ix := NewIndex(metric)
+		for _, d := range []struct {
+			id string
+			v  []float32
+		}{
+			{"east", []float32{1, 0}},
+			{"north", []float32{0, 1}},
+			{"northeast", []float32{0.7, 0.7}},
+			{"west", []float32{-1, 0}},
+		} {
+			if err := ix.Add(Document{ID: d.id}, d.v); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		matches, err := ix.Search([]float32{0.9, 0.1}, 2)
+		if err != nil {
+			t.Fatalf("%s: Search error: %v", metric, err)
+		}
+		if len(matches) != 2 || matches[0].ID != "east" || matches[1].ID != "northeast" {
+			t.Errorf("%s: matches = %+v, want east, northeast", metric, matches)
+		}
+		if matches[0].Score < matches[1].Score {
+			t.Errorf("%s: matches not sorted by score: %+v", metric, matches)
+		}
+	}
+}
+
+func TestIndex_ReplaceDeleteAndFilter(t *testing.T) {
+	ix := NewIndex(Cosine)
+	_ = ix.Add(Document{ID: "a", Metadata: map[string]string{"lang": "go"}}, []float32{1, 0})
+	_ = ix.Add(Document{ID: "b", Metadata: map[string]string{"lang": "py"}}, []float32{0.9, 0.1})
+	_ = ix.Add(Document{ID: "c", Metadata: map[string]string{"lang": "py"}}, []float32{0, 1})
+	_ = ix.Add(Document{ID: "a", Text: "replaced", Metadata: map[string]string{"lang": "go"}}, []float32{0, 1})
+
+	if ix.Len() != 3 {
+		t.Errorf("Len = %d, want 3", ix.Len())
+	}
+	if doc, _ := ix.Get("a"); doc.Text != "replaced" {
+		t.Errorf("Get(a) = %+v", doc)
+	}
+
+	matches, _ := ix.SearchFunc([]float32{1, 0}, 5, func(d Document) bool { return d.Metadata["lang"] == "py" })
+	if len(matches) != 2 || matches[0].ID != "b" {
+		t.Errorf("filtered matches = %+v", matches)
+	}
+
+	if !ix.Delete("a") || ix.Delete("a") {
+		t.Error("Delete(a) should succeed once")
+	}
+	if _, ok := ix.Get("c"); !ok || ix.Len() != 2 {
+		t.Errorf("after delete: Len = %d", ix.Len())
+	}
+}
+
+func TestIndex_DimensionMismatch(t *testing.T) {
+	ix := NewIndex(Dot)
+	_ = ix.Add(Document{ID: "a"}, []float32{1, 2, 3})
+	if err := ix.Add(Document{ID: "b"}, []float32{1, 2}); err == nil {
+		t.Error("expected dimension error on Add")
+	}
+	if _, err := ix.Search([]float32{1}, 1); err == nil {
+		t.Error("expected dimension error on Search")
+	}
+	if err := ix.Add(Document{}, []float32{1, 2, 3}); err == nil {
+		t.Error("expected error for a document without ID")
+	}
+}
+
+func TestIndex_SaveLoad(t *testing.T) {
+	ix := NewIndex(L2)
+	_ = ix.Add(Document{ID: "a", Text: "alpha", Metadata: map[string]string{"k": "v"}}, []float32{1, 2})
+	_ = ix.Add(Document{ID: "b", Text: "beta"}, []float32{3, 4})
+
+	path := filepath.Join(t.TempDir(), "data", "index.gob")
+	if err := ix.SaveFile(path); err != nil {
+		t.Fatalf("SaveFile error: %v", err)
+	}
+	loaded, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile error: %v", err)
+	}
+	if loaded.Metric() != L2 || loaded.Dim() != 2 || loaded.Len() != 2 {
+		t.Errorf("loaded metric %s, dim %d, len %d", loaded.Metric(), loaded.Dim(), loaded.Len())
+	}
+	if doc, ok := loaded.Get("a"); !ok || doc.Metadata["k"] != "v" {
+		t.Errorf("Get(a) = %+v", doc)
+	}
+	matches, _ := loaded.Search([]float32{3, 4}, 1)
+	if len(matches) != 1 || matches[0].ID != "b" || matches[0].Score != 0 {
+		t.Errorf("matches = %+v", matches)
+	}
+
+	if _, err := Load(bytes.NewReader([]byte("garbage"))); err == nil {
+		t.Error("expected error loading garbage")
+	}
+
+	// A vector that does not match the dimension of the index
+	var buf bytes.Buffer
+	_ = gob.NewEncoder(&buf).Encode(indexFile{Version: indexFileVersion, Metric: L2, Dim: 2,
+		Docs: []Document{{ID: "a"}, {ID: "b"}}, Vectors: [][]float32{{1, 2}, {3}}})
+	if _, err := Load(&buf); err == nil || !strings.Contains(err.Error(), "dimension") {
+		t.Errorf("error = %v, want a dimension error", err)
+	}
+}
+
+// embedServer embeds each input as a 2-d vector: "cat" and "dog" point one way, anything else the other
+func embedServer(t *testing.T, batches *[]int) *ollama.Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollama.EmbedRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		*batches = append(*batches, len(req.Input))
+		res := ollama.EmbedResponse{Model: req.Model}
+		for _, in := range req.Input {
+			switch in {
+			case "cat", "dog":
+				res.Embeddings = append(res.Embeddings, []float64{1, 0.1})
+			default:
+				res.Embeddings = append(res.Embeddings, []float64{0.1, 1})
+			}
+		}
+		_ = json.NewEncoder(w).Encode(res)
+	}))
+	t.Cleanup(srv.Close)
+	return ollama.NewOpenWebUiClient(&ollama.DSN{URL: srv.URL + "/api/generate"})
+}
+
+func TestCollection_AddInBatchesAndQuery(t *testing.T) {
+	var batches []int
+	client := embedServer(t, &batches)
+
+	c := NewCollection("embed-model")
+	c.BatchSize = 2
+	docs := []Document{{Text: "cat"}, {Text: "quantum"}, {ID: "d", Text: "dog"}, {Text: "physics"}, {Text: "cat"}}
+	if err := c.Add(context.Background(), client, docs); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	if len(batches) != 3 || batches[0] != 2 || batches[2] != 1 {
+		t.Errorf("batches = %v, want [2 2 1]", batches)
+	}
+	if c.Len() != 4 {
+		t.Errorf("Len = %d, want 4 (the duplicate cat stored once)", c.Len())
+	}
+
+	matches, err := c.Query(context.Background(), client, "dog", 2)
+	if err != nil {
+		t.Fatalf("Query error: %v", err)
+	}
+	if len(matches) != 2 || matches[0].Text == "quantum" || matches[1].Text == "physics" {
+		t.Errorf("matches = %+v, want cat and dog", matches)
+	}
+}